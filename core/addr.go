@@ -0,0 +1,163 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"time"
+)
+
+// 'addr' 메시지에 담기는 주소 하나
+type NetAddress struct {
+	Addr     string
+	LastSeen int64 // unix
+}
+
+type AddrMsg struct {
+	AddrList []NetAddress
+}
+
+// 'getaddr' 메시지 전송 (상대방이 알고 있는 주소 요청)
+func (s *Server) sendGetAddr(p *Peer) {
+	s.sendMessage(p, "getaddr", struct{}{})
+}
+
+// 'getaddr' 메시지 처리
+// 알고 있는 주소 중 최근에 확인된 것부터 보냄 (요청한 피어 자신은 제외)
+func (s *Server) handleGetAddr(p *Peer) {
+	var addrList []NetAddress
+	for _, ka := range s.peerManager.Addresses(maxAddrPerMsg) {
+		if p.matches(ka.Addr) {
+			continue
+		}
+		addrList = append(addrList, NetAddress{Addr: ka.Addr, LastSeen: ka.LastSeen.Unix()})
+	}
+
+	s.sendMessage(p, "addr", AddrMsg{AddrList: addrList})
+}
+
+// 'addr' 메시지 처리
+func (s *Server) handleAddr(p *Peer, payload []byte) {
+	var msg AddrMsg
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&msg); err != nil {
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed addr: %v", err))
+		return
+	}
+
+	if len(msg.AddrList) > maxAddrPerMsg {
+		s.misbehaving(p, scoreOversized, fmt.Sprintf("addr message with %d addresses (maximum %d)", len(msg.AddrList), maxAddrPerMsg))
+		return
+	}
+
+	logP2P.Debug("Received addresses", "peer", p.String(), "count", len(msg.AddrList))
+
+	for _, na := range msg.AddrList {
+		if na.Addr == s.nodeAddress || s.banManager.IsBanned(na.Addr) {
+			continue
+		}
+		s.peerManager.AddAddress(na.Addr, p.ListenAddr(), time.Unix(na.LastSeen, 0))
+	}
+}
+
+// outbound 연결 수를 s.maxOutbound로 유지하고 피어 목록을 주기적으로 저장
+// 서버가 종료되면 멈춤 (마지막 저장은 Stop에서 함)
+func (s *Server) maintainPeers() {
+	// 다른 노드들이 시작할 시간을 잠시 기다린 뒤 연결을 시작
+	if !s.sleep(peerConnectDelay) {
+		return
+	}
+
+	for {
+		s.fillOutboundPeers()
+
+		s.peerManager.Evict()
+		if err := s.peerManager.Save(); err != nil {
+			logP2P.Warn("Failed to save peers", "err", err)
+		}
+		if err := s.banManager.Save(); err != nil {
+			logP2P.Warn("Failed to save ban list", "err", err)
+		}
+
+		if !s.sleep(peerMaintainInterval) {
+			return
+		}
+	}
+}
+
+// outbound 연결이 부족하면 피어 목록에서 후보를 골라 연결
+// addnode로 추가한 주소는 연결 수와 관계없이 항상 연결을 유지
+// -connect 모드에서는 지정한 주소들에만 연결
+func (s *Server) fillOutboundPeers() {
+	for _, addr := range s.addedNodeList() {
+		s.connectManual(addr)
+	}
+
+	if len(s.connectOnly) > 0 {
+		for _, addr := range s.connectOnly {
+			s.connectManual(addr)
+		}
+		return
+	}
+
+	outbound, _ := s.peerCounts()
+	if outbound >= s.maxOutbound {
+		return
+	}
+
+	candidates := s.peerManager.Candidates(func(addr string) bool {
+		return addr == s.nodeAddress || s.findPeer(addr) != nil || s.banManager.IsBanned(addr)
+	})
+
+	for _, addr := range candidates {
+		if outbound >= s.maxOutbound {
+			return
+		}
+
+		s.peerManager.MarkAttempt(addr)
+		if _, err := s.connectPeer(addr); err != nil {
+			logP2P.Debug("Peer is not available", "addr", addr, "err", err)
+			s.peerManager.MarkFailed(addr)
+			continue
+		}
+		outbound++
+	}
+}
+
+// 직접 지정한 주소에 연결 (이미 연결되어 있으면 무시)
+func (s *Server) connectManual(addr string) error {
+	if addr == s.nodeAddress || s.findPeer(addr) != nil {
+		return nil
+	}
+	if _, err := s.connectPeer(addr); err != nil {
+		logP2P.Debug("Peer is not available", "addr", addr, "err", err)
+		return err
+	}
+	return nil
+}
+
+// addnode로 추가한 주소 목록
+func (s *Server) addedNodeList() []string {
+	s.peersLock.RLock()
+	defer s.peersLock.RUnlock()
+
+	addrs := make([]string, 0, len(s.addedNodes))
+	for addr := range s.addedNodes {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// 연결된 outbound, inbound 피어 수
+func (s *Server) peerCounts() (outbound, inbound int) {
+	s.peersLock.RLock()
+	defer s.peersLock.RUnlock()
+
+	for _, peer := range s.peers {
+		if peer.inbound {
+			inbound++
+		} else {
+			outbound++
+		}
+	}
+	return outbound, inbound
+}
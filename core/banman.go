@@ -0,0 +1,197 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 피어의 잘못된 행동에 매기는 점수
+// 누적 점수가 banThreshold에 도달하면 연결을 끊고 banDuration 동안 차단
+const (
+	banThreshold   = 100
+	banDuration    = 24 * time.Hour
+	scoreMalformed = 50  // 디코딩할 수 없는 메시지
+	scoreInvalid   = 100 // PoW나 트랜잭션 검증에 실패한 블록
+	scoreInvalidTx = 10  // 서명 검증에 실패한 트랜잭션
+	scoreOversized = 20  // 허용 개수를 넘는 항목이 담긴 메시지
+)
+
+// 차단된 주소
+// Addr는 "host:port"(해당 노드만) 또는 "host"(그 호스트의 모든 포트) 형식
+type BanEntry struct {
+	Addr    string    `json:"addr"`
+	Created time.Time `json:"created"`
+	Until   time.Time `json:"until"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// 차단 목록. 파일에 저장하여 재시작 후에도 유지됨
+type BanManager struct {
+	file string
+	bans map[string]*BanEntry
+	lock sync.Mutex
+}
+
+// file에 저장된 차단 목록을 불러옴. 파일이 없으면 빈 목록으로 시작
+func NewBanManager(file string) (*BanManager, error) {
+	bm := &BanManager{
+		file: file,
+		bans: make(map[string]*BanEntry),
+	}
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return bm, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var bans []*BanEntry
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return nil, fmt.Errorf("Failed to parse ban list %s: %w", file, err)
+	}
+	for _, ban := range bans {
+		if ban.Addr != "" {
+			bm.bans[ban.Addr] = ban
+		}
+	}
+	bm.sweep()
+
+	return bm, nil
+}
+
+// 차단 목록을 파일에 저장
+func (bm *BanManager) Save() error {
+	data, err := json.MarshalIndent(bm.List(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := bm.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, bm.file)
+}
+
+// addr을 duration 동안 차단
+func (bm *BanManager) Ban(addr string, duration time.Duration, reason string) {
+	if duration <= 0 {
+		duration = banDuration
+	}
+
+	bm.lock.Lock()
+	now := time.Now()
+	bm.bans[addr] = &BanEntry{Addr: addr, Created: now, Until: now.Add(duration), Reason: reason}
+	bm.lock.Unlock()
+
+	if err := bm.Save(); err != nil {
+		logP2P.Warn("Failed to save ban list", "err", err)
+	}
+}
+
+// 차단 해제. 차단되어 있지 않았으면 false
+func (bm *BanManager) Unban(addr string) bool {
+	bm.lock.Lock()
+	_, ok := bm.bans[addr]
+	delete(bm.bans, addr)
+	bm.lock.Unlock()
+
+	if ok {
+		if err := bm.Save(); err != nil {
+			logP2P.Warn("Failed to save ban list", "err", err)
+		}
+	}
+	return ok
+}
+
+// addr("host:port")이 차단되었는지 확인 (주소 자체 또는 호스트 전체 차단)
+func (bm *BanManager) IsBanned(addr string) bool {
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	now := time.Now()
+	banned := func(key string) bool {
+		ban, ok := bm.bans[key]
+		return ok && now.Before(ban.Until)
+	}
+
+	if banned(addr) {
+		return true
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && banned(host) {
+		return true
+	}
+	return false
+}
+
+// 만료되지 않은 차단 목록 (주소 순)
+func (bm *BanManager) List() []BanEntry {
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	bm.sweep()
+	bans := make([]BanEntry, 0, len(bm.bans))
+	for _, ban := range bm.bans {
+		bans = append(bans, *ban)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Addr < bans[j].Addr })
+	return bans
+}
+
+// 만료된 차단 제거
+func (bm *BanManager) sweep() {
+	now := time.Now()
+	for addr, ban := range bm.bans {
+		if !now.Before(ban.Until) {
+			delete(bm.bans, addr)
+		}
+	}
+}
+
+// 피어가 잘못된 행동을 했을 때 호출
+// 점수를 누적하고, banThreshold에 도달하면 피어의 연결 주소를 차단하고 연결을 끊음
+func (s *Server) misbehaving(p *Peer, score int, reason string) {
+	total := p.addBanScore(score)
+	logP2P.Warn("Peer misbehaving", "peer", p.String(), "score", score, "total", total, "reason", reason)
+
+	if total < banThreshold {
+		return
+	}
+
+	s.banManager.Ban(banAddr(p), banDuration, reason)
+	s.disconnectPeer(p, fmt.Sprintf("banned: %s", reason))
+}
+
+// 피어를 차단할 때 사용하는 주소
+// listen 주소(version.AddrFrom)는 피어가 스스로 알려준 값이라 다른 노드의 주소를 사칭할 수 있으므로 쓰지 않음
+// inbound 피어는 연결해 온 호스트 전체를, outbound 피어는 우리가 연결한 주소를 차단
+// 루프백에서 연결한 inbound 피어는 그 연결 주소만 차단 (로컬 테스트 네트워크는 모두 127.0.0.1에서 연결함)
+func banAddr(p *Peer) string {
+	if p.inbound && !isLoopback(hostOf(p.addr)) {
+		return hostOf(p.addr)
+	}
+	return p.addr
+}
+
+// 차단된 주소와 연결된 피어들의 연결을 끊음
+func (s *Server) disconnectBanned() {
+	s.peersLock.RLock()
+	var banned []*Peer
+	for _, peer := range s.peers {
+		if s.banManager.IsBanned(peer.addr) || s.banManager.IsBanned(peer.ListenAddr()) {
+			banned = append(banned, peer)
+		}
+	}
+	s.peersLock.RUnlock()
+
+	for _, peer := range banned {
+		s.disconnectPeer(peer, "banned")
+	}
+}
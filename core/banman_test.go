@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 가상 네트워크에서 노드를 실행 (connect의 노드들에만 연결)
+func startTestServer(t *testing.T, sim *SimNetwork, port int, connect ...string) *Server {
+	t.Helper()
+	dataDir, err := NewDataDir(filepath.Join(t.TempDir(), fmt.Sprint(port)), scenarioNetwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(ServerConfig{
+		Port:      fmt.Sprint(port),
+		DataDir:   dataDir,
+		Connect:   connect,
+		Transport: sim.Transport(fmt.Sprintf("localhost:%d", port)),
+		NoRPC:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Stop() })
+	return s
+}
+
+// cond가 참이 될 때까지 기다림
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// listen 주소가 addr인 피어
+func peerWithListenAddr(s *Server, addr string) *Peer {
+	for _, peer := range s.connectedPeers() {
+		if peer.ListenAddr() == addr {
+			return peer
+		}
+	}
+	return nil
+}
+
+// 루프백에서 연결한 inbound 피어를 차단해도 같은 호스트의 다른 피어는 연결을 유지함
+func TestBanLoopbackInboundPeerKeepsOtherLocalPeers(t *testing.T) {
+	sim := NewSimNetwork(1)
+	a := startTestServer(t, sim, 21000)
+	startTestServer(t, sim, 21001, "localhost:21000")
+	startTestServer(t, sim, 21002, "localhost:21000")
+
+	waitFor(t, "inbound peers", func() bool {
+		return peerWithListenAddr(a, "localhost:21001") != nil && peerWithListenAddr(a, "localhost:21002") != nil
+	})
+	bad := peerWithListenAddr(a, "localhost:21001")
+	good := peerWithListenAddr(a, "localhost:21002")
+	if host := hostOf(bad.addr); !isLoopback(host) {
+		t.Fatalf("inbound peer address %s is not loopback", bad.addr)
+	}
+
+	a.misbehaving(bad, banThreshold, "test")
+
+	bans := a.banManager.List()
+	if len(bans) != 1 || bans[0].Addr != bad.addr {
+		t.Fatalf("bans = %+v, want only %s", bans, bad.addr)
+	}
+	if !a.banManager.IsBanned(bad.addr) {
+		t.Fatalf("%s is not banned", bad.addr)
+	}
+	if a.banManager.IsBanned(good.addr) {
+		t.Fatalf("%s is banned together with %s", good.addr, bad.addr)
+	}
+
+	waitFor(t, "banned peer to disconnect", func() bool {
+		for _, peer := range a.connectedPeers() {
+			if peer == bad {
+				return false
+			}
+		}
+		return true
+	})
+	a.disconnectBanned()
+	time.Sleep(100 * time.Millisecond)
+	if peerWithListenAddr(a, "localhost:21002") != good {
+		t.Fatal("other loopback peer was disconnected")
+	}
+}
@@ -18,6 +18,18 @@ type Block struct {
 	Nonce         int
 }
 
+// 블록 헤더
+// 트랜잭션(블록 본문)을 제외한 블록 정보. 블록 본문이 prune되어도 헤더는 유지됨
+type BlockHeader struct {
+	Height        int64
+	Timestamp     int64
+	PrevBlockHash []byte
+	Hash          []byte
+	Nonce         int
+	TxHash        []byte // HashTransactions() 결과 (PoW 검증에 사용)
+	Size          int    // 직렬화된 블록 크기 (prune 용량 계산에 사용)
+}
+
 // 블록의 해시 계산 함수
 // 블록의 핵심 데이터(Timestamp, Data, PrevBlochHash)를 묶어 SHA-256 해시를 계산합니다.
 // deprecated: 이제 해시는 PoW 에 의해 계산됨
@@ -71,6 +83,35 @@ func (b *Block) HashTransactions() []byte {
 	return txHash[:]
 }
 
+// 블록의 헤더를 만듦
+func (b *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		Height:        b.Height,
+		Timestamp:     b.Timestamp,
+		PrevBlockHash: b.PrevBlockHash,
+		Hash:          b.Hash,
+		Nonce:         b.Nonce,
+		TxHash:        b.HashTransactions(),
+		Size:          len(b.Serialize()),
+	}
+}
+
+// 블록 헤더를 []byte로 직렬화
+func (h *BlockHeader) Serialize() []byte {
+	return gobEncode(h)
+}
+
+// []byte를 BlockHeader 포인터로 역직렬화
+func DeserializeBlockHeader(bs []byte) (*BlockHeader, error) {
+	var header BlockHeader
+
+	if err := gob.NewDecoder(bytes.NewReader(bs)).Decode(&header); err != nil {
+		return nil, err
+	}
+
+	return &header, nil
+}
+
 // 블록을 []byte로 직렬화
 func (b *Block) Serialize() []byte {
 	var encoded bytes.Buffer
@@ -85,14 +126,13 @@ func (b *Block) Serialize() []byte {
 }
 
 // []byte를 Block 포인터로 역직렬화
-func DeserializeBlock(bs []byte) *Block {
+func DeserializeBlock(bs []byte) (*Block, error) {
 	var block Block
 	dec := gob.NewDecoder(bytes.NewReader(bs))
 
-	err := dec.Decode(&block)
-	if err != nil {
-		log.Panic(err)
+	if err := dec.Decode(&block); err != nil {
+		return nil, err
 	}
 
-	return &block
+	return &block, nil
 }
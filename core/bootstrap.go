@@ -0,0 +1,118 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// 부트스트랩 파일 형식
+// 제네시스 블록부터 순서대로 [매직(4바이트) | 길이(4바이트) | 직렬화된 블록] 프레임이 반복됨
+// 매직과 길이는 big endian
+
+const bootstrapFrameHeaderLen = 8
+
+// 부트스트랩 파일에서 허용하는 블록 하나의 최대 크기
+const maxBootstrapBlockSize = 32 * 1024 * 1024
+
+// 메인 체인의 모든 블록을 제네시스부터 순서대로 w에 기록
+// 내보낸 블록 수를 반환
+func (bc *Blockchain) Export(w io.Writer, magic uint32, progress func(exported int, height int64)) (int, error) {
+	prunedHeight, err := bc.PrunedHeight()
+	if err != nil {
+		return 0, err
+	}
+	if prunedHeight > 0 {
+		return 0, fmt.Errorf("Cannot export a pruned blockchain (pruned up to height %d)", prunedHeight)
+	}
+
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return 0, err
+	}
+	header := make([]byte, bootstrapFrameHeaderLen)
+
+	exported := 0
+	for height := int64(1); height <= bestHeight; height++ {
+		hash, err := bc.GetBlockHashByHeight(height)
+		if err != nil {
+			return exported, err
+		}
+		block, err := bc.GetBlock(hash)
+		if err != nil {
+			return exported, err
+		}
+
+		data := block.Serialize()
+		binary.BigEndian.PutUint32(header[0:4], magic)
+		binary.BigEndian.PutUint32(header[4:8], uint32(len(data)))
+
+		if _, err := w.Write(header); err != nil {
+			return exported, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return exported, err
+		}
+
+		exported++
+		if progress != nil {
+			progress(exported, height)
+		}
+	}
+
+	return exported, nil
+}
+
+// r에서 블록을 읽어 AddBlock으로 검증하며 체인에 추가
+// 이미 가지고 있는 블록(제네시스 포함)은 건너뜀. 추가한 블록 수를 반환
+func (bc *Blockchain) Import(r io.Reader, magic uint32, progress func(imported int, height int64)) (int, error) {
+	header := make([]byte, bootstrapFrameHeaderLen)
+
+	imported := 0
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return imported, nil
+			}
+			return imported, fmt.Errorf("Failed to read block frame: %w", err)
+		}
+
+		if got := binary.BigEndian.Uint32(header[0:4]); got != magic {
+			return imported, fmt.Errorf("Invalid magic %08x (expected %08x). Wrong network or corrupted file", got, magic)
+		}
+
+		// 본문을 읽기 전에 길이를 확인하여 잘못된 파일로 인한 과도한 메모리 할당을 방지
+		size := binary.BigEndian.Uint32(header[4:8])
+		if size == 0 || size > maxBootstrapBlockSize {
+			return imported, fmt.Errorf("Invalid block size %d", size)
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return imported, fmt.Errorf("Failed to read block: %w", err)
+		}
+
+		block, err := DeserializeBlock(data)
+		if err != nil {
+			return imported, fmt.Errorf("Failed to decode block: %w", err)
+		}
+
+		// 이미 가지고 있는 블록이면 건너뜀
+		if hash, err := bc.GetBlockHashByHeight(block.Height); err == nil {
+			if !bytes.Equal(hash, block.Hash) {
+				return imported, fmt.Errorf("Block %x at height %d conflicts with local block %x", block.Hash, block.Height, hash)
+			}
+			continue
+		}
+
+		if err := bc.AddBlock(block); err != nil {
+			return imported, fmt.Errorf("Block %x at height %d rejected: %w", block.Hash, block.Height, err)
+		}
+
+		imported++
+		if progress != nil {
+			progress(imported, block.Height)
+		}
+	}
+}
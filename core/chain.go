@@ -2,21 +2,35 @@ package core
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"time"
-
-	"go.etcd.io/bbolt"
+	"sync"
 )
 
-const dbFileFormat = "blockchain_%s.db"
 const blocksBucket = "blocksBucket"
 
+// 블록 헤더 인덱스 (key: 블록 해시, value: 직렬화된 BlockHeader)
+const headersIndex = "headers"
+
+// 블록 높이 인덱스 (key: 높이(big endian), value: 블록 해시)
+const heightsIndex = "heights"
+
+var ErrBlockPruned = errors.New("block has been pruned")
+
+// 블록 자체가 규칙에 맞지 않음 (PoW, 트랜잭션 검증 실패)
+// 높이나 이전 블록이 맞지 않는 경우와 달리, 어떤 체인에도 추가될 수 없는 블록
+var ErrInvalidBlock = errors.New("invalid block")
+
 type Blockchain struct {
-	tip []byte // 마지막 블록의 해시
-	db  *bbolt.DB
+	tip         []byte  // 마지막 블록의 해시
+	store       Storage // 블록/UTXO 저장소
+	pruneTarget int64   // 블록 본문 보관 용량 (바이트, 0이면 prune 하지 않음)
+	txIndex     bool    // 트랜잭션 인덱스를 사용 (EnableTxIndex)
+	addLock     sync.Mutex
 }
 
 // 제네시스 블록을 고정돤 값으로 생성
@@ -29,8 +43,11 @@ func createGenesisBlock() *Block {
 	const genesisNonce = 196660
 	const genesisHash = "0000575fd1e289dbe9edfc719865b9b3a4e4f3fb938b6c5c7db7ddb26e3691e7"
 
-	// 3. 트랜잭션 생성
-	cbtx := NewCoinbaseTX(genesisRewardAddress, genesisCoinbaseData)
+	// 3. 트랜잭션 생성 (고정된 올바른 주소이므로 실패하지 않음)
+	cbtx, err := NewCoinbaseTX(genesisRewardAddress, genesisCoinbaseData)
+	if err != nil {
+		log.Panic(err)
+	}
 
 	// 4. 완성된 블록 객체 생성 (PoW 실행 없음!)
 	genesis := &Block{
@@ -49,15 +66,20 @@ func createGenesisBlock() *Block {
 // 블록체인에 블록을 추가
 // 블록에 포함될 트랜잭션 검증
 // UTXO Set 업데이트
-func (bc *Blockchain) AddBlock(block *Block) error {
-
-	lastHeight := bc.GetBestHeight()
-
-	// 트랜잭션 검증
-	for _, tx := range block.Transactions {
-		if !bc.VerifyTransaction(tx) {
-			log.Panic("ERROR: Invalid transaction found in block")
+// 검증에 실패한 블록(ErrInvalidBlock)은 무효한 블록으로 기록하여 헤더 체인에서 제외
+func (bc *Blockchain) AddBlock(block *Block) (err error) {
+	// 여러 피어의 블록과 채굴한 블록이 동시에 추가되지 않도록 (tip 확인부터 저장까지 한 번에)
+	bc.addLock.Lock()
+	defer bc.addLock.Unlock()
+	defer func() {
+		if errors.Is(err, ErrInvalidBlock) {
+			bc.invalidateBlock(block)
 		}
+	}()
+
+	lastHash, lastHeight, err := bc.GetTipInfo()
+	if err != nil {
+		return err
 	}
 
 	// 블록 높이 검증
@@ -65,109 +87,178 @@ func (bc *Blockchain) AddBlock(block *Block) error {
 		return fmt.Errorf("Invalid block height. Expected %d, got %d", lastHeight+1, block.Height)
 	}
 
+	// 이전 블록 해시 검증 (현재 tip에 이어지는 블록인지)
+	if !bytes.Equal(block.PrevBlockHash, lastHash) {
+		return fmt.Errorf("Block %x does not connect to tip %x", block.Hash, lastHash)
+	}
+
 	// Proof Of Work 검증
 	if isValid := NewProofOfWork(block).Validate(); !isValid {
-		return fmt.Errorf("Invalid PoW")
+		return fmt.Errorf("%w: invalid PoW", ErrInvalidBlock)
 	}
 
-	// 체인에 새 블록 추가 (DB에 새 블록 저장)
-	// 새 블록 저장과 l키 업데이트는 원자적으로 이루어져야 함(같은 bbolt tx 내에서 작업)
-	err := bc.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-
-		// 새 블록 저장
-		if err := b.Put(block.Hash, block.Serialize()); err != nil {
-			return err
-		}
-		// "l"키를 새 블록의 해시로 업데이트 (마지막 블록 해시 업데이트)
-		if err := b.Put([]byte("l"), block.Hash); err != nil {
-			return err
+	// 트랜잭션 검증
+	for _, tx := range block.Transactions {
+		if err := bc.VerifyTransaction(tx); err != nil {
+			return fmt.Errorf("%w: transaction %x: %w", ErrInvalidBlock, tx.ID, err)
 		}
+	}
 
-		bc.tip = block.Hash
-		return nil
+	// 체인에 새 블록 추가 (DB에 새 블록 저장)
+	// 새 블록 저장, tip 업데이트, 인덱스와 UTXO Set 업데이트는 원자적으로 이루어져야 함(같은 저장소 트랜잭션 내에서 작업)
+	err = bc.store.Update(func(tx StorageTx) error {
+		return bc.connectBlock(tx, block)
 	})
 
 	if err != nil {
-		log.Panic(err)
+		return fmt.Errorf("storing block %x: %w", block.Hash, err)
 	}
+	bc.tip = block.Hash
 
-	// UTXO Set 업데이트
-	utxoSet := UTXOSet{bc}
-	utxoSet.Update(block)
+	// prune 모드이면 오래된 블록 본문 삭제
+	if err := bc.Prune(); err != nil {
+		logChain.Warn("Prune failed", "err", err)
+	}
 
-	fmt.Println("Successfully added a new block!")
+	logChain.Info("Added block", hexAttr("hash", block.Hash), "height", block.Height, "txs", len(block.Transactions))
 	return nil
 }
 
-// 제네시스 블록으로 시작하는 새로운 블록체인 생성
-// DB를 열고, 체인이 없으면 제네시스 블록을 생성
-func NewBlockchain(port string) *Blockchain {
+// 저장소 트랜잭션 안에서 tip 위에 블록을 연결 (검증은 호출한 쪽에서 함)
+// 블록 저장, tip, 인덱스, UTXO Set 업데이트를 함께 하여 블록 추가(AddBlock)와 reorg가 같은 방식으로 연결함
+func (bc *Blockchain) connectBlock(tx StorageTx, block *Block) error {
+	// 새 블록 저장
+	data := block.Serialize()
+	if err := tx.PutBlock(block.Hash, data); err != nil {
+		return err
+	}
+	if err := addBlockDataSize(tx, int64(len(data))); err != nil {
+		return err
+	}
+	// tip을 새 블록의 해시로 업데이트 (마지막 블록 해시 업데이트)
+	if err := tx.SetTip(block.Hash); err != nil {
+		return err
+	}
+	if err := putBlockIndexes(tx, block); err != nil {
+		return err
+	}
+	if err := removeSyncHeader(tx, block); err != nil {
+		return err
+	}
+	if bc.txIndex {
+		if err := indexBlockTxs(tx, block); err != nil {
+			return err
+		}
+	}
+	// UTXO Set 업데이트
+	return updateUTXOs(tx, block)
+}
+
+// 블록 헤더와 높이 인덱스에 블록을 기록
+func putBlockIndexes(tx StorageTx, block *Block) error {
+	if err := tx.PutIndex(headersIndex, block.Hash, block.Header().Serialize()); err != nil {
+		return err
+	}
+	return tx.PutIndex(heightsIndex, heightKey(block.Height), block.Hash)
+}
+
+func heightKey(height int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(height))
+	return key
+}
+
+// bbolt DB 파일로 블록체인을 열거나 새로 생성
+func NewBlockchain(dbFile string) (*Blockchain, error) {
 	// DB 파일이 존재하는지 확인
 	// os.Stat으로 파일 상태정보를 가져옴. 파일이 없거나 접근할 수 없으면 error
 	// os.IsNotExist(err)는 error가 파일이 존재하지 않아 발생한 것인지를 확인
-	dbFile := fmt.Sprintf(dbFileFormat, port)
 	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
-		fmt.Println("Blockchain database not found. Creating new one...")
+		logChain.Info("Blockchain database not found. Creating new one", "file", dbFile)
 	}
 
-	db, err := bbolt.Open(dbFile, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	store, err := NewBoltStorage(dbFile)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
+	bc, err := NewBlockchainWithStorage(store)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return bc, nil
+}
+
+// 주어진 저장소로 블록체인 생성
+// 저장소에 체인이 없으면 제네시스 블록을 저장
+func NewBlockchainWithStorage(store Storage) (*Blockchain, error) {
 	var tip []byte
-	err = db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
+	err := store.Update(func(tx StorageTx) error {
+		// l키에서 마지막 블록 해시(tip)를 가져옴
+		tip = tx.GetTip()
+		if tip != nil {
+			logChain.Debug("Found existing blockchain")
+			// 저장 형식이 다른 DB를 잘못 읽지 않도록 스키마 버전 확인
+			return checkSchemaVersion(tx)
+		}
 
-		// 버킷이 없으면
-		if b == nil {
-			fmt.Println("No existing blockchain found. Creating Genesis Block...")
-			genesisBlock := createGenesisBlock()
+		// tip이 없으면
+		logChain.Info("No existing blockchain found. Creating genesis block")
+		genesisBlock := createGenesisBlock()
 
-			b, err := tx.CreateBucket([]byte(blocksBucket))
-			if err != nil {
-				return err
-			}
+		// 제네시스 블록 직렬화 및 DB 저장
+		genesisData := genesisBlock.Serialize()
+		if err := tx.PutBlock(genesisBlock.Hash, genesisData); err != nil {
+			return err
+		}
+		if err := writeBlockDataSize(tx, int64(len(genesisData))); err != nil {
+			return err
+		}
 
-			// 제네시스 블록 직렬화 및 DB 저장
-			err = b.Put(genesisBlock.Hash, genesisBlock.Serialize())
-			if err != nil {
-				return err
-			}
+		// 마지막 블록 해시(l키)를 제네시스 블록 해시로 저장
+		if err := tx.SetTip(genesisBlock.Hash); err != nil {
+			return err
+		}
+		tip = genesisBlock.Hash
 
-			// 마지막 블록 해시(l키)를 제네시스 블록 해시로 저장
-			err = b.Put([]byte("l"), genesisBlock.Hash)
-			if err != nil {
-				return err
-			}
-			tip = genesisBlock.Hash
-		} else {
-			// 버킷이 이미 존재하는 경우
-			fmt.Println("Found existing blockchain.")
-			// l키에서 마지막 블록 해시(tip)를 가져옴
-			tip = b.Get([]byte("l"))
+		if err := putBlockIndexes(tx, genesisBlock); err != nil {
+			return err
 		}
-		return nil
+		if err := updateUTXOs(tx, genesisBlock); err != nil {
+			return err
+		}
+
+		// 새 DB에는 현재 스키마 버전을 기록
+		return writeSchemaVersion(tx, schemaVersion)
 	})
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
-	// DB 인스턴스와 tip을 가진 Blockchain 구조체 포인터 반환
-	return &Blockchain{tip, db}
+	// 저장소와 tip을 가진 Blockchain 구조체 포인터 반환
+	return &Blockchain{tip: tip, store: store}, nil
 }
 
 // 전체 블록체인을 스캔하여 현재의 UTXO Map을 반환
-func (bc *Blockchain) FindAllUTXO() map[string][]*TXOutput {
-	UTXO := make(map[string][]*TXOutput)
+func (bc *Blockchain) FindAllUTXO() (map[string][]UTXOEntry, error) {
+	return collectUTXOs(bc.Iterator().Next)
+}
+
+// next가 반환하는 블록들(tip에서 제네시스 방향)을 순회하며 UTXO Map을 만듦
+func collectUTXOs(next func() (*Block, error)) (map[string][]UTXOEntry, error) {
+	UTXO := make(map[string][]UTXOEntry)
 	// key: txID, value: 사용된 Output 인덱스
 	spentTXOs := make(map[string][]int)
 
-	bci := bc.Iterator()
-
 	// 블록을 순회
 	for {
-		block := bci.Next()
+		block, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			break
+		}
 
 		// 블록 안의 트랜잭션을 순회
 		for _, tx := range block.Transactions {
@@ -187,9 +278,7 @@ func (bc *Blockchain) FindAllUTXO() map[string][]*TXOutput {
 				}
 
 				// 사용되지 않았다면, UTXO 맵에 추가
-				outs := UTXO[txID]
-				outs = append(outs, out)
-				UTXO[txID] = outs
+				UTXO[txID] = append(UTXO[txID], UTXOEntry{Index: outIdx, Output: out})
 			}
 
 			// Inputs을 순회하며 사용된 Output을 찾아서 spentTXOs 에 추가
@@ -208,18 +297,29 @@ func (bc *Blockchain) FindAllUTXO() map[string][]*TXOutput {
 		}
 	}
 
-	return UTXO
+	return UTXO, nil
 }
 
+// wallet에서 to로 amount를 보내는 서명된 트랜잭션 생성
+// 잔액이 모자라면 *InsufficientFundsError (ErrInsufficientFunds), 받는 주소가 틀리면 ErrInvalidAddress
 func (bc *Blockchain) NewTransaction(wallet *Wallet, to string, amount int) (*Transaction, error) {
 	pubKeyHash := HashPubKey(wallet.PublicKey)
 
+	// 받는 출력을 먼저 만들어 주소를 확인
+	toOutput, err := NewTXOutput(amount, to)
+	if err != nil {
+		return nil, err
+	}
+
 	// 사용할 수 있는 UTXO 찾기
 	utxoSet := UTXOSet{bc}
-	accumulated, spendableOutputs := utxoSet.FindSpendableOutputs(pubKeyHash, amount)
+	accumulated, spendableOutputs, err := utxoSet.FindSpendableOutputs(pubKeyHash, amount)
+	if err != nil {
+		return nil, err
+	}
 
 	if accumulated < amount {
-		return nil, fmt.Errorf("Not enough funds. Balance: %d, Required: %d", accumulated, amount)
+		return nil, &InsufficientFundsError{Balance: accumulated, Required: amount}
 	}
 
 	// 찾은 UTXO를 Input으로 변환
@@ -227,7 +327,7 @@ func (bc *Blockchain) NewTransaction(wallet *Wallet, to string, amount int) (*Tr
 	for txIDHex, outIdxs := range spendableOutputs {
 		txID, err := hex.DecodeString(txIDHex)
 		if err != nil {
-			log.Panic(err)
+			return nil, err
 		}
 		for _, outIdx := range outIdxs {
 			inputs = append(inputs, &TXInput{
@@ -240,11 +340,14 @@ func (bc *Blockchain) NewTransaction(wallet *Wallet, to string, amount int) (*Tr
 	}
 
 	// Outputs 생성 (받는 사람, 거스름돈)
-	var outputs []*TXOutput
-	outputs = append(outputs, NewTXOutput(amount, to))
+	outputs := []*TXOutput{toOutput}
 	// 거스름돈
 	if accumulated > amount {
-		outputs = append(outputs, NewTXOutput(accumulated-amount, string(wallet.GetAddress())))
+		change, err := NewTXOutput(accumulated-amount, string(wallet.GetAddress()))
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, change)
 	}
 
 	// 트랜잭션 생성
@@ -252,121 +355,226 @@ func (bc *Blockchain) NewTransaction(wallet *Wallet, to string, amount int) (*Tr
 	tx.SetID()
 
 	// 서명
-	prevTXs := bc.FindReferencedTransaction(tx)
-	tx.Sign(wallet.PrivateKey, prevTXs)
+	prevTXs, err := bc.FindReferencedTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Sign(wallet.PrivateKey, prevTXs); err != nil {
+		return nil, err
+	}
 
+	logWallet.Info("Created transaction", hexAttr("txid", tx.ID), "from", string(wallet.GetAddress()), "to", to, "amount", amount)
 	return tx, nil
 }
 
 // Input이 참조하는 트랜잭션들을 DB에서 조회
-func (bc *Blockchain) FindReferencedTransaction(tx *Transaction) map[string]*Transaction {
+// UTXO Set에서 먼저 찾고, 없으면 블록을 스캔 (prune된 블록은 스캔할 수 없음)
+// 하나라도 찾지 못하면 ErrTxNotFound (다른 노드에서 받은 트랜잭션은 입력이 없을 수 있음)
+func (bc *Blockchain) FindReferencedTransaction(tx *Transaction) (map[string]*Transaction, error) {
+	var prevTXs map[string]*Transaction
+
+	err := bc.store.View(func(stx StorageTx) error {
+		var err error
+		prevTXs, err = bc.referencedTransactions(stx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prevTXs, nil
+}
+
+// 저장소 트랜잭션 안에서 Input이 참조하는 트랜잭션들을 조회 (FindReferencedTransaction 참고)
+func (bc *Blockchain) referencedTransactions(stx StorageTx, tx *Transaction) (map[string]*Transaction, error) {
 	prevTXs := make(map[string]*Transaction)
 
 	for _, vin := range tx.Vin {
-		prevTX, err := bc.FindTransaction(vin.Txid)
+		prevTX, err := utxoTransaction(stx, vin.Txid)
+		if errors.Is(err, ErrTxNotFound) {
+			prevTX, err = bc.findTransaction(stx, vin.Txid)
+		}
 		if err != nil {
-			log.Panic(err)
+			return nil, err
 		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
-	return prevTXs
+	return prevTXs, nil
 }
 
-// 전체 블록을 스캔하여 특정 txID 찾기
-// 비효율적이지만, 추후 인덱스를 추가하여 개선 예정
+// 특정 txID의 트랜잭션 찾기
+// 트랜잭션 인덱스를 사용하면 인덱스로 찾고, 아니면 tip부터 전체 블록을 스캔
 func (bc *Blockchain) FindTransaction(txID []byte) (*Transaction, error) {
-	bcIter := bc.Iterator()
+	var found *Transaction
 
-	for {
-		block := bcIter.Next()
-		for _, tx := range block.Transactions {
-			if bytes.Equal(txID, tx.ID) {
-				return tx, nil
-			}
-		}
-		if len(block.PrevBlockHash) == 0 {
+	err := bc.store.View(func(tx StorageTx) error {
+		var err error
+		found, err = bc.findTransaction(tx, txID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// 저장소 트랜잭션 안에서 트랜잭션 찾기 (FindTransaction 참고)
+func (bc *Blockchain) findTransaction(tx StorageTx, txID []byte) (*Transaction, error) {
+	if bc.txIndex {
+		return findIndexedTransaction(tx, txID)
+	}
+
+	hash := tx.GetTip()
+	for len(hash) > 0 {
+		blockData := tx.GetBlock(hash)
+		// prune된 블록에 도달하면 더 이상 스캔할 수 없음
+		if blockData == nil {
 			break
 		}
+		block, err := DeserializeBlock(blockData)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range block.Transactions {
+			if bytes.Equal(txID, t.ID) {
+				return t, nil
+			}
+		}
+		hash = block.PrevBlockHash
 	}
-	return nil, fmt.Errorf("Transaction %s not found", hex.EncodeToString(txID))
+	return nil, fmt.Errorf("%w: %x", ErrTxNotFound, txID)
 }
 
 // 트랜잭션 검증
 // AddBlock 할 때 실행하여 블록의 트랜잭션을 검증
-func (bc *Blockchain) VerifyTransaction(tx *Transaction) bool {
+// 참조하는 트랜잭션을 모르면 ErrTxNotFound, 서명이 틀리면 ErrInvalidSignature
+func (bc *Blockchain) VerifyTransaction(tx *Transaction) error {
+	return bc.store.View(func(stx StorageTx) error {
+		return bc.verifyTransaction(stx, tx)
+	})
+}
+
+// 저장소 트랜잭션 안에서 트랜잭션 검증 (reorg는 블록을 끊고 연결하는 중간 상태에서 검증함)
+func (bc *Blockchain) verifyTransaction(stx StorageTx, tx *Transaction) error {
 	if tx.IsCoinbase() {
-		return true
+		return nil
+	}
+	prevTXs, err := bc.referencedTransactions(stx, tx)
+	if err != nil {
+		return err
 	}
-	prevTXs := bc.FindReferencedTransaction(tx)
 	return tx.Verify(prevTXs)
 }
 
 // 최고 블록 높이 반환
-func (bc *Blockchain) GetBestHeight() int64 {
-	var lastBlock *Block
+func (bc *Blockchain) GetBestHeight() (int64, error) {
+	_, height, err := bc.GetTipInfo()
+	return height, err
+}
 
-	err := bc.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		lastHash := b.Get([]byte("l"))
-		// 아직 tip이 설정되지 않은 경우
-		if lastHash == nil {
-			return fmt.Errorf("Tip hash not found")
-		}
-		lastBlockBytes := b.Get(lastHash)
-		lastBlock = DeserializeBlock(lastBlockBytes)
+// 블록 해시 목록 반환 (역순)
+// 블록 본문이 prune되어도 목록을 만들 수 있도록 헤더를 따라 순회
+func (bc *Blockchain) GetBlockHashes() ([][]byte, error) {
+	var blockHashes [][]byte
 
+	err := bc.store.View(func(tx StorageTx) error {
+		hash := bc.tip
+		for len(hash) > 0 {
+			headerData := tx.GetIndex(headersIndex, hash)
+			if headerData == nil {
+				return fmt.Errorf("Block header %x not found", hash)
+			}
+			header, err := DeserializeBlockHeader(headerData)
+			if err != nil {
+				return err
+			}
+			blockHashes = append(blockHashes, hash)
+			hash = header.PrevBlockHash
+		}
 		return nil
 	})
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	return lastBlock.Height
+	return blockHashes, nil
 }
 
-// 블록 해시 목록 반환 (역순)
-func (bc *Blockchain) GetBlockHashes() [][]byte {
-	var blockHashes [][]byte
+// 높이로 블록 해시 조회 (메인 체인 기준)
+func (bc *Blockchain) GetBlockHashByHeight(height int64) ([]byte, error) {
+	var hash []byte
 
-	bcIter := bc.Iterator()
+	err := bc.store.View(func(tx StorageTx) error {
+		hash = tx.GetIndex(heightsIndex, heightKey(height))
+		if hash == nil {
+			return fmt.Errorf("Block at height %d not found.", height)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	for {
-		block := bcIter.Next()
-		blockHashes = append(blockHashes, block.Hash)
-		if len(block.PrevBlockHash) == 0 {
-			break
+	return hash, nil
+}
+
+// 블록 헤더 조회 (블록 본문이 prune되어도 조회 가능)
+func (bc *Blockchain) GetHeader(hash []byte) (*BlockHeader, error) {
+	var header *BlockHeader
+
+	err := bc.store.View(func(tx StorageTx) error {
+		headerData := tx.GetIndex(headersIndex, hash)
+		if headerData == nil {
+			return fmt.Errorf("Block header %x not found.", hash)
 		}
+		var err error
+		header, err = DeserializeBlockHeader(headerData)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return blockHashes
+	return header, nil
 }
 
-func (bc *Blockchain) GetTipInfo() ([]byte, int64) {
+// 메인 체인의 tip 해시와 높이 반환
+// tip 블록의 본문은 prune되지 않으므로 헤더 대신 블록을 읽음
+func (bc *Blockchain) GetTipInfo() ([]byte, int64, error) {
 	var lastBlock *Block
 
-	err := bc.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		lastHash := b.Get([]byte("l"))
-		blockData := b.Get(lastHash)
-		lastBlock = DeserializeBlock(blockData)
-		return nil
+	err := bc.store.View(func(tx StorageTx) error {
+		lastHash := tx.GetTip()
+		// 아직 tip이 설정되지 않은 경우
+		if lastHash == nil {
+			return fmt.Errorf("Tip hash not found")
+		}
+		blockData := tx.GetBlock(lastHash)
+		if blockData == nil {
+			return fmt.Errorf("Tip block %x not found", lastHash)
+		}
+		var err error
+		lastBlock, err = DeserializeBlock(blockData)
+		return err
 	})
 	if err != nil {
-		log.Panic(err)
+		return nil, 0, err
 	}
 
-	return lastBlock.Hash, lastBlock.Height
+	return lastBlock.Hash, lastBlock.Height, nil
 }
 
 func (bc *Blockchain) GetBlock(ID []byte) (*Block, error) {
 	var blockBytes []byte
 
-	err := bc.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		blockBytes = b.Get(ID)
+	err := bc.store.View(func(tx StorageTx) error {
+		blockBytes = tx.GetBlock(ID)
 
 		if blockBytes == nil {
-			return fmt.Errorf("Block %s not found.", ID)
+			// 헤더는 있지만 본문이 없으면 prune된 블록
+			if tx.GetIndex(headersIndex, ID) != nil {
+				return ErrBlockPruned
+			}
+			return fmt.Errorf("Block %x not found.", ID)
 		}
 
 		return nil
@@ -375,10 +583,12 @@ func (bc *Blockchain) GetBlock(ID []byte) (*Block, error) {
 		return nil, err
 	}
 
-	return DeserializeBlock(blockBytes), nil
+	return DeserializeBlock(blockBytes)
 }
 
-// DB 연결 종료
-func (bc *Blockchain) Close() {
-	bc.db.Close()
+// DB 연결 종료 (진행 중인 블록 추가가 끝난 뒤 닫음)
+func (bc *Blockchain) Close() error {
+	bc.addLock.Lock()
+	defer bc.addLock.Unlock()
+	return bc.store.Close()
 }
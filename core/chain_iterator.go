@@ -1,39 +1,37 @@
 package core
 
-import (
-	"log"
-
-	"go.etcd.io/bbolt"
-)
-
 // 블록체인을 순회하기 위한 구조체
 type BlockchainIterator struct {
-	currentHash []byte    // 현재 블록 해시(순회 기준점)
-	db          *bbolt.DB // DB 커넥션
+	currentHash []byte  // 현재 블록 해시(순회 기준점)
+	store       Storage // 블록 저장소
 }
 
 // Blockchain 구조체를 통해 Blockchain에 대한 Iterator를 생성
 func (bc *Blockchain) Iterator() *BlockchainIterator {
-	return &BlockchainIterator{bc.tip, bc.db}
+	return &BlockchainIterator{bc.tip, bc.store}
 }
 
-func (i *BlockchainIterator) Next() *Block {
+// 다음(이전 높이의) 블록 반환. 더 순회할 블록이 없으면 nil
+func (i *BlockchainIterator) Next() (*Block, error) {
 	var block *Block
 
-	err := i.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
+	err := i.store.View(func(tx StorageTx) error {
 		if i.currentHash == nil {
 			return nil
 		}
 		// 현재 해시로 블록체인을 가져옴
-		encodedBlock := b.Get(i.currentHash)
+		encodedBlock := tx.GetBlock(i.currentHash)
+		// prune된 블록이면 더 이상 순회할 수 없음
+		if encodedBlock == nil {
+			return nil
+		}
 		// 블록 바이트스트림 역직렬화
-		block = DeserializeBlock(encodedBlock)
-
-		return nil
+		var err error
+		block, err = DeserializeBlock(encodedBlock)
+		return err
 	})
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
 	// 다음 Next() 호출을 위해 currentHash를 이전 블록 해시로 업데이트
@@ -43,5 +41,5 @@ func (i *BlockchainIterator) Next() *Block {
 		i.currentHash = block.PrevBlockHash
 	}
 
-	return block
+	return block, nil
 }
@@ -0,0 +1,462 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	SetLogLevels("warn")
+	os.Exit(m.Run())
+}
+
+// 메모리 저장소로 제네시스 블록만 있는 체인 생성
+func newTestBlockchain(t *testing.T) *Blockchain {
+	t.Helper()
+	bc, err := NewBlockchainWithStorage(NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.Close() })
+	return bc
+}
+
+// prev 위에 txs와 to에게 보상을 주는 코인베이스를 담은 블록을 채굴 (체인에 추가하지는 않음)
+func mineTestBlock(t *testing.T, prev []byte, height int64, to string, txs ...*Transaction) *Block {
+	t.Helper()
+	cbtx, err := NewCoinbaseTX(to, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := NewBlock(append([]*Transaction{cbtx}, txs...), prev, height)
+	block.Nonce, block.Hash = NewProofOfWork(block).Run()
+	return block
+}
+
+// 메인 체인의 tip 해시와 높이
+func testTip(t *testing.T, bc *Blockchain) ([]byte, int64) {
+	t.Helper()
+	hash, height, err := bc.GetTipInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash, height
+}
+
+// 헤더 체인이 메인 체인과 갈라지는 높이
+func testForkHeight(t *testing.T, bc *Blockchain) int64 {
+	t.Helper()
+	height, err := bc.ForkHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return height
+}
+
+// 헤더 체인에서 본문을 기다리는 블록 해시와 첫 블록의 높이
+func testMissingBlocks(t *testing.T, bc *Blockchain) (int64, [][]byte) {
+	t.Helper()
+	start, hashes, err := bc.MissingBlockHashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return start, hashes
+}
+
+// tip 위에 블록을 채굴해서 추가
+func addTestBlock(t *testing.T, bc *Blockchain, to string, txs ...*Transaction) *Block {
+	t.Helper()
+	tip, height := testTip(t, bc)
+	block := mineTestBlock(t, tip, height+1, to, txs...)
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatalf("AddBlock at height %d: %v", block.Height, err)
+	}
+	return block
+}
+
+func testBalance(t *testing.T, bc *Blockchain, w *Wallet) int {
+	t.Helper()
+	balance, err := UTXOSet{bc}.GetBalance(HashPubKey(w.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
+
+// Reindex로 다시 만든 UTXO Set과 블록마다 갱신한 UTXO Set이 같은지 확인
+func checkUTXODigest(t *testing.T, bc *Blockchain) {
+	t.Helper()
+	utxoSet := UTXOSet{bc}
+	before, err := utxoSet.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utxoSet.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := utxoSet.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != after {
+		t.Fatalf("UTXO set digest %s differs from reindexed digest %s", before, after)
+	}
+}
+
+func TestAddBlockUpdatesUTXOSet(t *testing.T) {
+	bc := newTestBlockchain(t)
+	alice, bob := NewWallet(), NewWallet()
+
+	addTestBlock(t, bc, string(alice.GetAddress()))
+	if got := testBalance(t, bc, alice); got != subsidy {
+		t.Fatalf("alice balance = %d, want %d", got, subsidy)
+	}
+
+	tx, err := bc.NewTransaction(alice, string(bob.GetAddress()), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := addTestBlock(t, bc, string(bob.GetAddress()), tx)
+
+	if _, height := testTip(t, bc); height != 3 {
+		t.Fatalf("tip height = %d, want 3", height)
+	}
+	if got := testBalance(t, bc, alice); got != subsidy-3 {
+		t.Fatalf("alice balance = %d, want %d", got, subsidy-3)
+	}
+	if got := testBalance(t, bc, bob); got != subsidy+3 {
+		t.Fatalf("bob balance = %d, want %d", got, subsidy+3)
+	}
+	checkUTXODigest(t, bc)
+
+	// 같은 출력을 다시 사용하는 블록은 거부
+	double := mineTestBlock(t, block.Hash, 4, string(bob.GetAddress()), tx)
+	if err := bc.AddBlock(double); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("AddBlock with double spend: err = %v, want ErrInvalidBlock", err)
+	}
+	if _, height := testTip(t, bc); height != 3 {
+		t.Fatalf("tip height after rejected block = %d, want 3", height)
+	}
+}
+
+func TestAddBlockRejectsBlockNotOnTip(t *testing.T) {
+	bc := newTestBlockchain(t)
+	w := NewWallet()
+
+	genesis, _ := testTip(t, bc)
+	addTestBlock(t, bc, string(w.GetAddress()))
+
+	stale := mineTestBlock(t, genesis, 2, string(w.GetAddress()))
+	if err := bc.AddBlock(stale); err == nil {
+		t.Fatal("AddBlock accepted a block that does not extend the tip")
+	}
+
+	invalid := mineTestBlock(t, bc.tip, 3, string(w.GetAddress()))
+	invalid.Nonce++
+	if err := bc.AddBlock(invalid); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("AddBlock with bad PoW: err = %v, want ErrInvalidBlock", err)
+	}
+}
+
+func TestReorganizeRestoresSpentOutputs(t *testing.T) {
+	t.Run("undo data", func(t *testing.T) { testReorganizeRestoresSpentOutputs(t, false) })
+	// undo 데이터를 기록하기 전에 저장된 블록은 참조하는 트랜잭션에서 사용한 출력을 찾음
+	t.Run("no undo data", func(t *testing.T) { testReorganizeRestoresSpentOutputs(t, true) })
+}
+
+func testReorganizeRestoresSpentOutputs(t *testing.T, dropUndo bool) {
+	bc := newTestBlockchain(t)
+	alice, bob, carol := NewWallet(), NewWallet(), NewWallet()
+
+	fork := addTestBlock(t, bc, string(alice.GetAddress()))
+	tx, err := bc.NewTransaction(alice, string(bob.GetAddress()), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disconnected := addTestBlock(t, bc, string(bob.GetAddress()), tx)
+	if dropUndo {
+		err := bc.store.Update(func(stx StorageTx) error {
+			return stx.DeleteIndex(undoIndex, disconnected.Hash)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// fork 위의 더 긴 갈래 (alice의 트랜잭션은 담지 않음)
+	a := mineTestBlock(t, fork.Hash, 3, string(carol.GetAddress()))
+	b := mineTestBlock(t, a.Hash, 4, string(carol.GetAddress()))
+
+	// 작업량이 같은 갈래로는 바꾸지 않음
+	if _, err := bc.Reorganize([]*Block{a}); err == nil {
+		t.Fatal("Reorganize switched to a branch with equal work")
+	}
+
+	got, err := bc.Reorganize([]*Block{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || string(got[0].Hash) != string(disconnected.Hash) {
+		t.Fatalf("disconnected blocks = %d, want block %x", len(got), disconnected.Hash)
+	}
+
+	if tip, height := testTip(t, bc); height != 4 || string(tip) != string(b.Hash) {
+		t.Fatalf("tip = %x at height %d, want %x at height 4", tip, height, b.Hash)
+	}
+	if bc.InMainChain(disconnected.Hash) {
+		t.Fatal("disconnected block is still in the main chain")
+	}
+	if got := testBalance(t, bc, alice); got != subsidy {
+		t.Fatalf("alice balance = %d, want %d", got, subsidy)
+	}
+	if got := testBalance(t, bc, bob); got != 0 {
+		t.Fatalf("bob balance = %d, want 0", got)
+	}
+	if got := testBalance(t, bc, carol); got != 2*subsidy {
+		t.Fatalf("carol balance = %d, want %d", got, 2*subsidy)
+	}
+	checkUTXODigest(t, bc)
+
+	// 끊긴 블록의 트랜잭션은 새 체인에서도 유효함
+	if err := bc.VerifyTransaction(tx); err != nil {
+		t.Fatalf("transaction from disconnected block: %v", err)
+	}
+	addTestBlock(t, bc, string(carol.GetAddress()), tx)
+	if got := testBalance(t, bc, bob); got != 4 {
+		t.Fatalf("bob balance = %d, want 4", got)
+	}
+	checkUTXODigest(t, bc)
+}
+
+func TestReorganizeRejectsInvalidBranch(t *testing.T) {
+	bc := newTestBlockchain(t)
+	alice, bob := NewWallet(), NewWallet()
+
+	fork := addTestBlock(t, bc, string(alice.GetAddress()))
+	tx, err := bc.NewTransaction(alice, string(bob.GetAddress()), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip := addTestBlock(t, bc, string(bob.GetAddress()), tx)
+	digest, err := UTXOSet{bc}.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 같은 출력을 두 번 사용하는 갈래
+	a := mineTestBlock(t, fork.Hash, 3, string(alice.GetAddress()), tx)
+	b := mineTestBlock(t, a.Hash, 4, string(alice.GetAddress()), tx)
+
+	_, err = bc.Reorganize([]*Block{a, b})
+	var reorgErr *ReorgError
+	if !errors.As(err, &reorgErr) || !errors.Is(err, ErrInvalidBlock) || reorgErr.Block != b {
+		t.Fatalf("Reorganize with double spend: err = %v, want *ReorgError for block %x", err, b.Hash)
+	}
+
+	// 아무것도 바뀌지 않음
+	if hash, height := testTip(t, bc); height != 3 || string(hash) != string(tip.Hash) {
+		t.Fatalf("tip = %x at height %d, want %x at height 3", hash, height, tip.Hash)
+	}
+	if got, err := (UTXOSet{bc}).Digest(); err != nil || got != digest {
+		t.Fatalf("UTXO set digest changed after failed reorganize: %s (err %v), want %s", got, err, digest)
+	}
+}
+
+// 검증에 실패한 갈래는 헤더 체인에서 빠지고, 남은 갈래 중 가장 무거운 것으로 돌아감
+func TestInvalidBranchIsDroppedFromHeaderChain(t *testing.T) {
+	bc := newTestBlockchain(t)
+	alice, bob := NewWallet(), NewWallet()
+
+	fork := addTestBlock(t, bc, string(alice.GetAddress()))
+	tx, err := bc.NewTransaction(alice, string(bob.GetAddress()), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip := addTestBlock(t, bc, string(bob.GetAddress()), tx)
+
+	// 같은 출력을 두 번 사용하는 갈래를 먼저 받고, 작업량이 같은 올바른 갈래를 나중에 받음
+	a := mineTestBlock(t, fork.Hash, 3, string(alice.GetAddress()), tx)
+	b := mineTestBlock(t, a.Hash, 4, string(alice.GetAddress()), tx)
+	c := mineTestBlock(t, b.Hash, 5, string(alice.GetAddress()))
+	v3 := mineTestBlock(t, fork.Hash, 3, string(bob.GetAddress()))
+	v4 := mineTestBlock(t, v3.Hash, 4, string(bob.GetAddress()))
+	if _, err := bc.AddHeaders([]*BlockHeader{a.Header(), b.Header(), c.Header()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.AddHeaders([]*BlockHeader{v3.Header(), v4.Header()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bc.Reorganize([]*Block{a, b}); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("Reorganize with double spend: err = %v, want ErrInvalidBlock", err)
+	}
+
+	// 헤더 체인은 올바른 갈래로 바뀜 (무효한 블록의 자손 c도 함께 빠짐)
+	if best, err := bc.BestHeader(); err != nil || string(best.Hash) != string(v4.Hash) {
+		t.Fatalf("best header = %v (err %v), want %x", best, err, v4.Hash)
+	}
+	start, missing := testMissingBlocks(t, bc)
+	if start != 3 || len(missing) != 2 || string(missing[0]) != string(v3.Hash) || string(missing[1]) != string(v4.Hash) {
+		t.Fatalf("missing blocks = %d from height %d, want 2 from height 3", len(missing), start)
+	}
+	if bc.HasHeader(b.Hash) || bc.HasHeader(c.Hash) {
+		t.Fatal("headers of the invalid branch are still kept")
+	}
+
+	// 무효한 블록과 그 자손의 헤더는 다시 받지 않음
+	if _, err := bc.AddHeaders([]*BlockHeader{b.Header()}); !errors.Is(err, ErrInvalidHeaderChain) {
+		t.Fatalf("AddHeaders with invalid header: err = %v, want ErrInvalidHeaderChain", err)
+	}
+	d := mineTestBlock(t, c.Hash, 6, string(alice.GetAddress()))
+	if _, err := bc.AddHeaders([]*BlockHeader{d.Header()}); !errors.Is(err, ErrInvalidHeaderChain) {
+		t.Fatalf("AddHeaders extending invalid branch: err = %v, want ErrInvalidHeaderChain", err)
+	}
+
+	// 올바른 갈래로는 reorg 할 수 있음
+	if _, err := bc.Reorganize([]*Block{v3, v4}); err != nil {
+		t.Fatal(err)
+	}
+	if _, missing := testMissingBlocks(t, bc); len(missing) != 0 {
+		t.Fatalf("missing blocks after reorganize: %d, want none", len(missing))
+	}
+	if hash, height := testTip(t, bc); height != 4 || string(hash) != string(v4.Hash) {
+		t.Fatalf("tip = %x at height %d, want %x at height 4", hash, height, v4.Hash)
+	}
+	if bc.InMainChain(tip.Hash) {
+		t.Fatal("old tip is still in the main chain")
+	}
+}
+
+func TestAddHeadersSwitchesToHeavierBranch(t *testing.T) {
+	bc := newTestBlockchain(t)
+	w := NewWallet()
+
+	fork := addTestBlock(t, bc, string(w.GetAddress()))
+	addTestBlock(t, bc, string(w.GetAddress()))
+
+	a := mineTestBlock(t, fork.Hash, 3, string(w.GetAddress()))
+	if _, err := bc.AddHeaders([]*BlockHeader{a.Header()}); err != nil {
+		t.Fatal(err)
+	}
+	if start, missing := testMissingBlocks(t, bc); len(missing) != 0 {
+		t.Fatalf("missing blocks from height %d: %d, want none for a branch with equal work", start, len(missing))
+	}
+
+	b := mineTestBlock(t, a.Hash, 4, string(w.GetAddress()))
+	if _, err := bc.AddHeaders([]*BlockHeader{b.Header()}); err != nil {
+		t.Fatal(err)
+	}
+	if got := testForkHeight(t, bc); got != 2 {
+		t.Fatalf("fork height = %d, want 2", got)
+	}
+	start, missing := testMissingBlocks(t, bc)
+	if start != 3 || len(missing) != 2 || string(missing[0]) != string(a.Hash) || string(missing[1]) != string(b.Hash) {
+		t.Fatalf("missing blocks = %d from height %d, want 2 from height 3", len(missing), start)
+	}
+	if !bc.IsPendingBlock(a.Hash, 3) || !bc.IsPendingBlock(b.Hash, 4) {
+		t.Fatal("branch blocks are not pending")
+	}
+
+	if _, err := bc.Reorganize([]*Block{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	if got := testForkHeight(t, bc); got != 4 {
+		t.Fatalf("fork height after reorganize = %d, want 4", got)
+	}
+	if _, missing := testMissingBlocks(t, bc); len(missing) != 0 {
+		t.Fatalf("missing blocks after reorganize: %d, want none", len(missing))
+	}
+	if best, err := bc.BestHeader(); err != nil || string(best.Hash) != string(b.Hash) {
+		t.Fatalf("best header = %v (err %v), want %x", best, err, b.Hash)
+	}
+}
+
+// bbolt 저장소도 메모리 저장소와 같이 동작하고, 다시 열어도 체인과 UTXO Set이 유지되는지 확인
+func TestBoltStorageBlockchainReopen(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blockchain.db")
+	bc, err := NewBlockchain(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWallet()
+	block := addTestBlock(t, bc, string(w.GetAddress()))
+	digest, err := UTXOSet{bc}.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err = NewBlockchain(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	if tip, height := testTip(t, bc); height != 2 || string(tip) != string(block.Hash) {
+		t.Fatalf("tip after reopen = %x at height %d, want %x at height 2", tip, height, block.Hash)
+	}
+	if got, err := (UTXOSet{bc}).Digest(); err != nil || got != digest {
+		t.Fatalf("UTXO set digest after reopen = %s (err %v), want %s", got, err, digest)
+	}
+	if got := testBalance(t, bc, w); got != subsidy {
+		t.Fatalf("balance after reopen = %d, want %d", got, subsidy)
+	}
+}
+
+// 기록된 블록 본문 전체 크기가 실제로 저장된 본문 크기의 합과 같은지 확인
+func checkBlockDataSize(t *testing.T, bc *Blockchain) {
+	t.Helper()
+	var recorded, stored int64
+	err := bc.store.View(func(tx StorageTx) error {
+		recorded = readBlockDataSize(tx)
+		tip, err := tipHeight(tx)
+		if err != nil {
+			return err
+		}
+		for height := readPrunedHeight(tx) + 1; height <= tip; height++ {
+			stored += int64(len(tx.GetBlock(tx.GetIndex(heightsIndex, heightKey(height)))))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded != stored {
+		t.Fatalf("recorded block data size = %d, stored block bodies = %d bytes", recorded, stored)
+	}
+}
+
+// 블록 본문 전체 크기는 블록 연결, reorg, prune에 맞춰 갱신되고, prune은 보관 깊이 안의 블록을 남김
+func TestBlockDataSizeTracksConnectDisconnectAndPrune(t *testing.T) {
+	bc := newTestBlockchain(t)
+	w := NewWallet()
+
+	fork := addTestBlock(t, bc, string(w.GetAddress()))
+	addTestBlock(t, bc, string(w.GetAddress()))
+	checkBlockDataSize(t, bc)
+
+	a := mineTestBlock(t, fork.Hash, 3, string(w.GetAddress()))
+	b := mineTestBlock(t, a.Hash, 4, string(w.GetAddress()))
+	if _, err := bc.Reorganize([]*Block{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	checkBlockDataSize(t, bc)
+
+	bc.pruneTarget = 1
+	for range pruneRetentionDepth + 1 {
+		addTestBlock(t, bc, string(w.GetAddress()))
+	}
+	_, tip := testTip(t, bc)
+	prunedHeight, err := bc.PrunedHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prunedHeight != tip-pruneRetentionDepth {
+		t.Fatalf("pruned height = %d, want %d (tip %d)", prunedHeight, tip-pruneRetentionDepth, tip)
+	}
+	checkBlockDataSize(t, bc)
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"flag"
 	"fmt"
@@ -9,8 +10,11 @@ import (
 	"log"
 	"net"
 	"os"
-
-	"github.com/mr-tron/base58"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 const defaultPort = "3000"
@@ -19,11 +23,33 @@ type CLI struct{}
 
 func (cli *CLI) printUsage() {
 	fmt.Println("Usage:")
-	fmt.Println("  startnode -port PORT - Start a node")
-	fmt.Println("  createwallet - Gerenates a new key-pair and saves it into the wallet file")
+	fmt.Println("  startnode -port PORT [-datadir DIR] [-network NET] [-dbbackup] [-migrate-dryrun] [NODE OPTIONS] - Start a node")
+	fmt.Println("  dumpconfig [-port PORT] [-datadir DIR] [NODE OPTIONS] - Print the configuration startnode would use")
+	fmt.Println("  createwallet [-datadir DIR] [-network NET] - Gerenates a new key-pair and saves it into the wallet file")
 	fmt.Println("  getbalance -address ADDRESS - Get balance of ADDRESS")
-	fmt.Println("  reindexutxo - Rebuilds the UTXO set")
+	fmt.Println("  reindexutxo [-datadir DIR] [-network NET] - Rebuilds the UTXO set")
 	fmt.Println("  send -from FROM -to TO -amount AMOUNT - Send AMOUNT of coins")
+	fmt.Println("  exportchain -file FILE [-datadir DIR] [-network NET] - Write all blocks to a bootstrap file")
+	fmt.Println("  importchain -file FILE [-datadir DIR] [-network NET] - Validate and add blocks from a bootstrap file")
+	fmt.Println("  addnode -node ADDR [-command add|remove|onetry] - Add, remove, or try once a peer of a running node")
+	fmt.Println("  disconnectnode -node ADDR - Disconnect a peer of a running node")
+	fmt.Println("  listbanned - List banned addresses of a running node")
+	fmt.Println("  setban -node ADDR [-command add|remove] [-duration SECONDS] - Ban (host:port or host) or unban an address")
+	fmt.Println("  getpeerinfo - List connected peers of a running node with ping times and traffic")
+	fmt.Println("  getnettotals - Show connection, traffic and rate limit counters of a running node")
+	fmt.Println("  setloglevel [-level SPEC] - Change (or show) log levels of a running node")
+	fmt.Println("  stop - Shut down a running node gracefully")
+	fmt.Println("  nodeid [-datadir DIR] [-network NET] - Print the node ID used for encrypted peer connections")
+	fmt.Println("  runscenario -file FILE [-dir DIR] [-loglevel SPEC] - Run a JSON network scenario with in-process nodes")
+	fmt.Println()
+	fmt.Println("  -datadir defaults to $HOME/.gochain/<port>, -network to mainnet")
+	fmt.Println("  NODE OPTIONS (override <datadir>/gochain.json): [-prune MB] [-rpcbind ADDR] [-rpcport PORT] [-rpcuser USER -rpcpassword PASS]")
+	fmt.Println("    [-seeds ADDRS] [-connect ADDRS] [-maxoutbound N] [-maxinbound N] [-encrypt] [-allowpeers IDS] [-miner ADDRESS] [-minerthreads N]")
+	fmt.Println("    [-mempoolmaxtxs N] [-mempoolmaxbytes N] [-nomempool] [-txindex] [-loglevel SPEC] [-logjson]")
+	fmt.Println("  RPC commands take -port PORT [-datadir DIR] [-rpcuser USER -rpcpassword PASS]; address and credentials come from the node's gochain.json")
+	fmt.Println("  -seeds and -connect take comma-separated host:port lists, -allowpeers comma-separated node IDs")
+	fmt.Println("  log level SPEC: \"level\" or \"subsys=level\" items, comma-separated (e.g. info,p2p=debug)")
+	fmt.Println("    subsystems: p2p, rpc, chain, mempool, miner, wallet, scenario; levels: debug, info, warn, error")
 }
 
 func (cli *CLI) validateArgs() {
@@ -39,23 +65,89 @@ func (cli *CLI) Run() {
 	// 명령어 플래그
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
-	getBalancePort := getBalanceCmd.String("port", defaultPort, "Node port")
+	getBalanceRPC := addRPCClientFlags(getBalanceCmd)
 
 	reindexCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
 	reindexPort := reindexCmd.String("port", defaultPort, "Node port")
+	reindexDataDir := reindexCmd.String("datadir", "", "Data directory (default $HOME/.gochain/<port>)")
+	reindexNetwork := reindexCmd.String("network", defaultNetwork, "Network name")
 
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
 	createWalletPort := createWalletCmd.String("port", defaultPort, "Node port")
+	createWalletDataDir := createWalletCmd.String("datadir", "", "Data directory (default $HOME/.gochain/<port>)")
+	createWalletNetwork := createWalletCmd.String("network", defaultNetwork, "Network name")
 
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
-	sendPort := sendCmd.String("port", defaultPort, "Node port")
+	sendRPC := addRPCClientFlags(sendCmd)
+
+	exportCmd := flag.NewFlagSet("exportchain", flag.ExitOnError)
+	exportFile := exportCmd.String("file", "", "Bootstrap file to write")
+	exportPort := exportCmd.String("port", defaultPort, "Node port")
+	exportDataDir := exportCmd.String("datadir", "", "Data directory (default $HOME/.gochain/<port>)")
+	exportNetwork := exportCmd.String("network", defaultNetwork, "Network name")
 
+	importCmd := flag.NewFlagSet("importchain", flag.ExitOnError)
+	importFile := importCmd.String("file", "", "Bootstrap file to read")
+	importPort := importCmd.String("port", defaultPort, "Node port")
+	importDataDir := importCmd.String("datadir", "", "Data directory (default $HOME/.gochain/<port>)")
+	importNetwork := importCmd.String("network", defaultNetwork, "Network name")
+
+	// startnode와 dumpconfig는 설정 파일의 항목과 같은 플래그를 받음 (지정한 플래그가 파일의 값보다 우선)
 	startnodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
-	startnodePort := startnodeCmd.String("port", defaultPort, "Node port to listen on")
-	startnodeMiner := startnodeCmd.String("miner", "", "Minig reward address (optional)")
+	startnodeConfig := DefaultNodeConfig()
+	bindNodeConfigFlags(startnodeCmd, &startnodeConfig)
+	startnodeDataDir := startnodeCmd.String("datadir", "", "Data directory (default $HOME/.gochain/<port>)")
+	startnodeDBBackup := startnodeCmd.Bool("dbbackup", false, "Back up the database before migrating its schema")
+	startnodeMigrateDryRun := startnodeCmd.Bool("migrate-dryrun", false, "Show pending database migrations and exit")
+
+	dumpConfigCmd := flag.NewFlagSet("dumpconfig", flag.ExitOnError)
+	dumpConfigConfig := DefaultNodeConfig()
+	bindNodeConfigFlags(dumpConfigCmd, &dumpConfigConfig)
+	dumpConfigDataDir := dumpConfigCmd.String("datadir", "", "Data directory (default $HOME/.gochain/<port>)")
+
+	nodeIDCmd := flag.NewFlagSet("nodeid", flag.ExitOnError)
+	nodeIDPort := nodeIDCmd.String("port", defaultPort, "Node port")
+	nodeIDDataDir := nodeIDCmd.String("datadir", "", "Data directory (default $HOME/.gochain/<port>)")
+	nodeIDNetwork := nodeIDCmd.String("network", defaultNetwork, "Network name")
+
+	runScenarioCmd := flag.NewFlagSet("runscenario", flag.ExitOnError)
+	runScenarioFile := runScenarioCmd.String("file", "", "Scenario file (JSON)")
+	runScenarioDir := runScenarioCmd.String("dir", "", "Directory for node data (default: temporary directory, removed afterwards)")
+	runScenarioLogLevel := runScenarioCmd.String("loglevel", "", "Log levels, e.g. warn,scenario=info to show only scenario steps")
+
+	addNodeCmd := flag.NewFlagSet("addnode", flag.ExitOnError)
+	addNodeAddr := addNodeCmd.String("node", "", "Peer address (host:port)")
+	addNodeCommand := addNodeCmd.String("command", addNodeAdd, "add, remove, or onetry")
+	addNodeRPC := addRPCClientFlags(addNodeCmd)
+
+	disconnectCmd := flag.NewFlagSet("disconnectnode", flag.ExitOnError)
+	disconnectAddr := disconnectCmd.String("node", "", "Peer address (host:port)")
+	disconnectRPC := addRPCClientFlags(disconnectCmd)
+
+	listBannedCmd := flag.NewFlagSet("listbanned", flag.ExitOnError)
+	listBannedRPC := addRPCClientFlags(listBannedCmd)
+
+	setBanCmd := flag.NewFlagSet("setban", flag.ExitOnError)
+	setBanAddr := setBanCmd.String("node", "", "Address to ban (host:port or host)")
+	setBanCommand := setBanCmd.String("command", "add", "add or remove")
+	setBanDuration := setBanCmd.Int64("duration", 0, "Ban duration in seconds (0 = 24 hours)")
+	setBanRPC := addRPCClientFlags(setBanCmd)
+
+	getPeerInfoCmd := flag.NewFlagSet("getpeerinfo", flag.ExitOnError)
+	getPeerInfoRPC := addRPCClientFlags(getPeerInfoCmd)
+
+	getNetTotalsCmd := flag.NewFlagSet("getnettotals", flag.ExitOnError)
+	getNetTotalsRPC := addRPCClientFlags(getNetTotalsCmd)
+
+	setLogLevelCmd := flag.NewFlagSet("setloglevel", flag.ExitOnError)
+	setLogLevelSpec := setLogLevelCmd.String("level", "", "Log levels, e.g. debug or info,p2p=debug (empty = show current levels)")
+	setLogLevelRPC := addRPCClientFlags(setLogLevelCmd)
+
+	stopCmd := flag.NewFlagSet("stop", flag.ExitOnError)
+	stopRPC := addRPCClientFlags(stopCmd)
 
 	// 명령어 파싱
 	// os.Args[1]	: 명령어
@@ -87,6 +179,71 @@ func (cli *CLI) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "exportchain":
+		err := exportCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importchain":
+		err := importCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "addnode":
+		err := addNodeCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "disconnectnode":
+		err := disconnectCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "listbanned":
+		err := listBannedCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "setban":
+		err := setBanCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getpeerinfo":
+		err := getPeerInfoCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getnettotals":
+		err := getNetTotalsCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "setloglevel":
+		err := setLogLevelCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "stop":
+		err := stopCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "dumpconfig":
+		err := dumpConfigCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "nodeid":
+		err := nodeIDCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "runscenario":
+		err := runScenarioCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	default:
 		cli.printUsage()
 		os.Exit(1)
@@ -94,40 +251,137 @@ func (cli *CLI) Run() {
 
 	// startnode 명령어 실행 로직
 	if startnodeCmd.Parsed() {
-		if *startnodePort == "" {
-			startnodeCmd.Usage()
+		// 기본값 → 설정 파일 → 플래그 순서로 설정을 정함
+		cfg, root, err := resolveNodeConfig(startnodeCmd, *startnodeDataDir)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		dataDir := openDataDir(root, cfg.Network, strconv.Itoa(cfg.Port), true)
+
+		// 로그는 표준 출력과 데이터 디렉토리의 logs/node.log에 기록
+		logCloser, err := ConfigureLogging(cfg.LogConfig(dataDir))
+		if err != nil {
+			log.Panic(err)
+		}
+		defer logCloser.Close()
+		logP2P.Info("Starting node", "port", cfg.Port, "miner", cfg.Mining.Address, "datadir", dataDir.NetworkDir())
+
+		// 블록체인을 열기 전에 DB 스키마를 현재 버전으로 업그레이드
+		migrateOpts := MigrateOptions{DryRun: *startnodeMigrateDryRun}
+		if *startnodeDBBackup {
+			migrateOpts.BackupPath = fmt.Sprintf("%s.%s.bak", dataDir.ChainFile(), time.Now().Format("20060102-150405"))
+		}
+		applied, err := MigrateDatabase(dataDir.ChainFile(), migrateOpts)
+		if err != nil {
+			log.Panic(err)
+		}
+		if *startnodeMigrateDryRun {
+			fmt.Printf("%d pending migration(s)\n", len(applied))
+			for _, desc := range applied {
+				fmt.Printf("  - %s\n", desc)
+			}
+			return
+		}
+
+		server, err := NewServer(cfg.ServerConfig(dataDir))
+		if err != nil {
+			log.Panic(err)
+		}
+
+		// Ctrl-C 또는 SIGTERM을 받으면 순서대로 종료 (종료 중 한 번 더 받으면 바로 종료)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		if err := server.Start(ctx); err != nil {
+			log.Panic(err)
+		}
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+
+		err = server.Wait()
+		dataDir.Unlock()
+		if err != nil {
 			os.Exit(1)
 		}
+	}
 
-		log.Println("[startnode] port: ", *startnodePort)
-		log.Println("[startnode] miner: ", *startnodeMiner)
+	// (dumpconfig - 로컬 실행, startnode가 사용할 설정을 JSON으로 출력)
+	if dumpConfigCmd.Parsed() {
+		cfg, root, err := resolveNodeConfig(dumpConfigCmd, *dumpConfigDataDir)
+		if err != nil {
+			log.Panic(err)
+		}
+		data, err := cfg.Dump()
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Fprintf(os.Stderr, "# config file: %s\n", ConfigFile(root))
+		fmt.Println(string(data))
+	}
 
-		server := NewServer(*startnodePort, *startnodeMiner)
-		server.Start()
+	// (nodeid - 로컬 실행, 노드 키가 없으면 새로 만듦)
+	if nodeIDCmd.Parsed() {
+		dataDir := openDataDir(*nodeIDDataDir, *nodeIDNetwork, *nodeIDPort, false)
+		nodeKey, err := LoadOrCreateNodeKey(dataDir.NodeKey())
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Println(nodeKey.ID())
 	}
 
-	// (getbalance - RPC 클라이언트)
-	if getBalanceCmd.Parsed() {
-		if *getBalanceAddress == "" || *getBalancePort == "" {
-			getBalanceCmd.Usage()
+	// (runscenario - 로컬 실행, 노드들을 이 프로세스 안에서 가상 네트워크로 연결)
+	if runScenarioCmd.Parsed() {
+		if *runScenarioFile == "" {
+			runScenarioCmd.Usage()
 			os.Exit(1)
 		}
 
-		req := GetBalanceRequest{Address: *getBalanceAddress}
-		resp, err := sendRPCRequest(*getBalancePort, rpcCmdGetBalance, req)
+		if err := SetLogLevels(*runScenarioLogLevel); err != nil {
+			log.Panic(err)
+		}
+
+		sc, err := LoadScenario(*runScenarioFile)
 		if err != nil {
 			log.Panic(err)
 		}
-		if !resp.Success {
-			log.Panic(fmt.Errorf("GetBalance failed: %s", resp.Message))
+
+		// -dir을 지정하지 않으면 임시 디렉토리를 사용하고 끝나면 지움
+		dir, tempDir := *runScenarioDir, false
+		if dir == "" {
+			if dir, err = os.MkdirTemp("", "gochain-scenario-"); err != nil {
+				log.Panic(err)
+			}
+			tempDir = true
+		}
+
+		err = RunScenario(sc, dir)
+		if tempDir {
+			os.RemoveAll(dir)
+		}
+		if err != nil {
+			fmt.Printf("FAILED: %v\n", err)
+			os.Exit(1)
 		}
+	}
+
+	// (getbalance - RPC 클라이언트)
+	if getBalanceCmd.Parsed() {
+		if *getBalanceAddress == "" {
+			getBalanceCmd.Usage()
+			os.Exit(1)
+		}
+
+		req := GetBalanceRequest{Address: *getBalanceAddress}
+		resp, err := getBalanceRPC.send(rpcCmdGetBalance, req)
+		checkRPCResponse(resp, err)
 
 		// 응답 페이로드 디코딩
 		var balanceResp GetBalanceResponse
 		if err := gob.NewDecoder(bytes.NewBuffer(resp.Data)).Decode(&balanceResp); err != nil {
-			log.Panic(err)
+			exitWithRPCError(rpcErrInternal, fmt.Sprintf("decoding response: %v", err))
 		}
-		fmt.Printf("Balance for '%s' (via node %s): %d\n", *getBalanceAddress, *getBalancePort, balanceResp.Balance)
+		fmt.Printf("Balance for '%s': %d\n", *getBalanceAddress, balanceResp.Balance)
 	}
 
 	// (createwallet - 로컬 실행, RPC 불필요)
@@ -136,76 +390,413 @@ func (cli *CLI) Run() {
 			createWalletCmd.Usage()
 			os.Exit(1)
 		}
-		wallets, _ := NewWallets(*createWalletPort)
+		dataDir := openDataDir(*createWalletDataDir, *createWalletNetwork, *createWalletPort, false)
+		wallets, err := NewWallets(dataDir.WalletFile())
+		if err != nil {
+			log.Panic(err)
+		}
 		address := wallets.CreateWallet()
-		wallets.SaveToFile(*createWalletPort)
+		if err := wallets.SaveToFile(dataDir.WalletFile()); err != nil {
+			log.Panic(err)
+		}
 		fmt.Printf("Wallet for node %s created. Address: %s\n", *createWalletPort, address)
 	}
 
 	// (send - RPC 클라이언트)
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 || *sendPort == "" {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
 			sendCmd.Usage()
 			os.Exit(1)
 		}
 
 		// (주소 유효성 검사는 서버가 하지만, 클라도 미리 하는 것이 좋음)
 		if !ValidateAddress(*sendFrom) || !ValidateAddress(*sendTo) {
-			log.Panic("ERROR: Addresses are not valid")
+			exitWithRPCError(rpcErrInvalidAddress, "addresses are not valid")
 		}
 
 		req := SendRequest{From: *sendFrom, To: *sendTo, Amount: *sendAmount}
-		resp, err := sendRPCRequest(*sendPort, rpcCmdSend, req)
-		if err != nil {
-			log.Panic(err)
+		resp, err := sendRPC.send(rpcCmdSend, req)
+		checkRPCResponse(resp, err)
+		fmt.Println("Send successful:", resp.Message)
+	}
+
+	// (addnode - RPC 클라이언트)
+	if addNodeCmd.Parsed() {
+		if *addNodeAddr == "" {
+			addNodeCmd.Usage()
+			os.Exit(1)
 		}
-		if !resp.Success {
-			log.Panic(fmt.Errorf("Send failed: %s", resp.Message))
+
+		req := AddNodeRequest{Addr: *addNodeAddr, Command: *addNodeCommand}
+		resp, err := addNodeRPC.send(rpcCmdAddNode, req)
+		checkRPCResponse(resp, err)
+		fmt.Println(resp.Message)
+	}
+
+	// (disconnectnode - RPC 클라이언트)
+	if disconnectCmd.Parsed() {
+		if *disconnectAddr == "" {
+			disconnectCmd.Usage()
+			os.Exit(1)
 		}
-		fmt.Println("Send successful:", resp.Message)
+
+		req := DisconnectNodeRequest{Addr: *disconnectAddr}
+		resp, err := disconnectRPC.send(rpcCmdDisconnect, req)
+		checkRPCResponse(resp, err)
+		fmt.Println(resp.Message)
+	}
+
+	// (listbanned - RPC 클라이언트)
+	if listBannedCmd.Parsed() {
+		resp, err := listBannedRPC.send(rpcCmdListBanned, struct{}{})
+		checkRPCResponse(resp, err)
+
+		var bannedResp ListBannedResponse
+		if err := gob.NewDecoder(bytes.NewBuffer(resp.Data)).Decode(&bannedResp); err != nil {
+			exitWithRPCError(rpcErrInternal, fmt.Sprintf("decoding response: %v", err))
+		}
+		if len(bannedResp.Bans) == 0 {
+			fmt.Println("No banned addresses")
+		}
+		for _, ban := range bannedResp.Bans {
+			fmt.Printf("%s\tuntil %s\t%s\n", ban.Addr, ban.Until.Format(time.RFC3339), ban.Reason)
+		}
+	}
+
+	// (setban - RPC 클라이언트)
+	if setBanCmd.Parsed() {
+		if *setBanAddr == "" {
+			setBanCmd.Usage()
+			os.Exit(1)
+		}
+
+		req := SetBanRequest{Addr: *setBanAddr, Command: *setBanCommand, Duration: *setBanDuration}
+		resp, err := setBanRPC.send(rpcCmdSetBan, req)
+		checkRPCResponse(resp, err)
+		fmt.Println(resp.Message)
+	}
+
+	// (getpeerinfo - RPC 클라이언트)
+	if getPeerInfoCmd.Parsed() {
+		resp, err := getPeerInfoRPC.send(rpcCmdGetPeerInfo, struct{}{})
+		checkRPCResponse(resp, err)
+
+		var peerInfoResp GetPeerInfoResponse
+		if err := gob.NewDecoder(bytes.NewBuffer(resp.Data)).Decode(&peerInfoResp); err != nil {
+			exitWithRPCError(rpcErrInternal, fmt.Sprintf("decoding response: %v", err))
+		}
+		if len(peerInfoResp.Peers) == 0 {
+			fmt.Println("No connected peers")
+		}
+		for _, peer := range peerInfoResp.Peers {
+			direction := "outbound"
+			if peer.Inbound {
+				direction = "inbound"
+			}
+			fmt.Printf("%s (%s, listen %s)\n", peer.Addr, direction, peer.ListenAddr)
+			if peer.NodeID != "" {
+				fmt.Printf("  node ID %s (encrypted)\n", peer.NodeID)
+			}
+			fmt.Printf("  version %d %s, services %b, height %d, ban score %d\n",
+				peer.Version, peer.UserAgent, peer.Services, peer.BestHeight, peer.BanScore)
+			fmt.Printf("  connected %s, ping %s (min %s", peer.ConnectedAt.Format(time.RFC3339), peer.PingRTT, peer.MinPingRTT)
+			if peer.PingWait > 0 {
+				fmt.Printf(", waiting %s", peer.PingWait.Round(time.Millisecond))
+			}
+			fmt.Println(")")
+			fmt.Printf("  recv %d msgs / %d bytes, sent %d msgs / %d bytes, throttled %d times\n",
+				peer.MsgsRecv, peer.BytesRecv, peer.MsgsSent, peer.BytesSent, peer.Throttled)
+		}
+	}
+
+	// (getnettotals - RPC 클라이언트)
+	if getNetTotalsCmd.Parsed() {
+		resp, err := getNetTotalsRPC.send(rpcCmdGetNetTotals, struct{}{})
+		checkRPCResponse(resp, err)
+
+		var totals NetTotals
+		if err := gob.NewDecoder(bytes.NewBuffer(resp.Data)).Decode(&totals); err != nil {
+			exitWithRPCError(rpcErrInternal, fmt.Sprintf("decoding response: %v", err))
+		}
+		fmt.Printf("Peers:            %d (inbound connections: %d)\n", totals.Peers, totals.InboundConns)
+		fmt.Printf("Inbound accepted: %d, rejected: %d\n", totals.InboundAccepted, totals.InboundRejected)
+		fmt.Printf("Received:         %d msgs / %d bytes\n", totals.MsgsRecv, totals.BytesRecv)
+		fmt.Printf("Sent:             %d msgs / %d bytes\n", totals.MsgsSent, totals.BytesSent)
+		fmt.Printf("Throttled:        %d times, %s total\n", totals.Throttled, totals.ThrottledTime)
+		fmt.Printf("Slow peers:       %d disconnected\n", totals.SlowPeers)
+	}
+
+	// (setloglevel - RPC 클라이언트)
+	if setLogLevelCmd.Parsed() {
+		resp, err := setLogLevelRPC.send(rpcCmdSetLogLevel, SetLogLevelRequest{Levels: *setLogLevelSpec})
+		checkRPCResponse(resp, err)
+		fmt.Printf("Log levels: %s\n", resp.Message)
+	}
+
+	// (stop - RPC 클라이언트)
+	if stopCmd.Parsed() {
+		resp, err := stopRPC.send(rpcCmdStop, struct{}{})
+		checkRPCResponse(resp, err)
+		fmt.Println(resp.Message)
 	}
 
 	// reindexutxo 명령어 실행 로직
 	if reindexCmd.Parsed() {
-		bc := NewBlockchain(*reindexPort)
+		dataDir := openDataDir(*reindexDataDir, *reindexNetwork, *reindexPort, true)
+		defer dataDir.Unlock()
+
+		if _, err := MigrateDatabase(dataDir.ChainFile(), MigrateOptions{}); err != nil {
+			log.Panic(err)
+		}
+
+		bc, err := NewBlockchain(dataDir.ChainFile())
+		if err != nil {
+			log.Panic(err)
+		}
 		defer bc.Close()
 
+		prunedHeight, err := bc.PrunedHeight()
+		if err != nil {
+			log.Panic(err)
+		}
+		if prunedHeight > 0 {
+			fmt.Println("ERROR: The blockchain has been pruned, UTXO set cannot be rebuilt")
+			os.Exit(1)
+		}
+
 		utxoSet := UTXOSet{bc}
-		utxoSet.Reindex()
+		if err := utxoSet.Reindex(); err != nil {
+			log.Panic(err)
+		}
 
 		fmt.Println("Done! UTXO Set has been reindexed")
 	}
 
+	// exportchain 명령어 실행 로직
+	if exportCmd.Parsed() {
+		if *exportFile == "" {
+			exportCmd.Usage()
+			os.Exit(1)
+		}
+
+		dataDir := openDataDir(*exportDataDir, *exportNetwork, *exportPort, true)
+		defer dataDir.Unlock()
+
+		if _, err := MigrateDatabase(dataDir.ChainFile(), MigrateOptions{}); err != nil {
+			log.Panic(err)
+		}
+		bc, err := NewBlockchain(dataDir.ChainFile())
+		if err != nil {
+			log.Panic(err)
+		}
+		defer bc.Close()
+
+		f, err := os.Create(*exportFile)
+		if err != nil {
+			log.Panic(err)
+		}
+		defer f.Close()
+
+		bestHeight, err := bc.GetBestHeight()
+		if err != nil {
+			log.Panic(err)
+		}
+		exported, err := bc.Export(f, dataDir.Magic(), func(exported int, height int64) {
+			fmt.Printf("\rExporting blocks... %d/%d", height, bestHeight)
+		})
+		fmt.Println()
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Printf("Exported %d blocks to %s\n", exported, *exportFile)
+	}
+
+	// importchain 명령어 실행 로직
+	if importCmd.Parsed() {
+		if *importFile == "" {
+			importCmd.Usage()
+			os.Exit(1)
+		}
+
+		dataDir := openDataDir(*importDataDir, *importNetwork, *importPort, true)
+		defer dataDir.Unlock()
+
+		if _, err := MigrateDatabase(dataDir.ChainFile(), MigrateOptions{}); err != nil {
+			log.Panic(err)
+		}
+		bc, err := NewBlockchain(dataDir.ChainFile())
+		if err != nil {
+			log.Panic(err)
+		}
+		defer bc.Close()
+
+		f, err := os.Open(*importFile)
+		if err != nil {
+			log.Panic(err)
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			log.Panic(err)
+		}
+
+		// 블록마다 남는 "Added block" 로그가 진행률 줄을 끊지 않도록 chain 로그는 경고만 출력
+		if err := SetLogLevels("chain=warn"); err != nil {
+			log.Panic(err)
+		}
+
+		// 읽은 바이트 수로 진행률 계산 (exportchain처럼 한 줄을 덮어씀)
+		reader := &countingReader{r: f}
+		imported, err := bc.Import(reader, dataDir.Magic(), func(imported int, height int64) {
+			percent := float64(reader.n) / float64(info.Size()) * 100
+			fmt.Printf("\rImporting blocks... %d imported (height %d, %.1f%%)", imported, height, percent)
+		})
+		fmt.Println()
+		if err != nil {
+			log.Panic(err)
+		}
+		bestHeight, err := bc.GetBestHeight()
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Printf("Imported %d blocks from %s. Best height: %d\n", imported, *importFile, bestHeight)
+	}
+
 	// createWallet 명령어 실행 로직
 	if createWalletCmd.Parsed() {
-		wallets, _ := NewWallets(*createWalletPort) // 파일에서 로드
-		address := wallets.CreateWallet()           // 새 지갑 추가
-		wallets.SaveToFile(*createWalletPort)       // 파일에 저장
+		dataDir := openDataDir(*createWalletDataDir, *createWalletNetwork, *createWalletPort, false)
+		wallets, err := NewWallets(dataDir.WalletFile()) // 파일에서 로드
+		if err != nil {
+			log.Panic(err)
+		}
+		address := wallets.CreateWallet() // 새 지갑 추가
+		if err := wallets.SaveToFile(dataDir.WalletFile()); err != nil { // 파일에 저장
+			log.Panic(err)
+		}
 		fmt.Printf("Your new address: %s\n", address)
 	}
 }
 
-func Base58Decode(input []byte) []byte {
-	decode, err := base58.Decode(string(input))
+// 데이터 디렉토리를 열고, lock이 true이면 다른 프로세스가 사용하지 못하도록 잠금
+// 지갑 생성처럼 실행 중인 노드와 함께 쓰는 명령어는 잠그지 않음
+func openDataDir(root, network, port string, lock bool) *DataDir {
+	if root == "" {
+		root = DefaultDataDir(port)
+	}
+
+	dataDir, err := NewDataDir(root, network)
 	if err != nil {
 		log.Panic(err)
 	}
-	return decode
+
+	if lock {
+		if err := dataDir.Lock(); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	return dataDir
+}
+
+// 쉼표로 구분된 주소 목록을 나눔 (빈 항목은 무시)
+func splitAddrList(list string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// 읽은 바이트 수를 세는 Reader (진행률 표시용)
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// RPC 명령어의 공통 플래그
+// 노드의 설정 파일(<datadir>/gochain.json)이 있으면 그 파일에서 RPC 주소와 인증 정보를 읽음
+type rpcClientFlags struct {
+	port     *string
+	dataDir  *string
+	user     *string
+	password *string
+}
+
+func addRPCClientFlags(fs *flag.FlagSet) *rpcClientFlags {
+	return &rpcClientFlags{
+		port:     fs.String("port", defaultPort, "Node port"),
+		dataDir:  fs.String("datadir", "", "Data directory of the node, for its config file (default $HOME/.gochain/<port>)"),
+		user:     fs.String("rpcuser", "", "RPC user name (default: from the node's config file)"),
+		password: fs.String("rpcpassword", "", "RPC password (default: from the node's config file)"),
+	}
 }
 
-func sendRPCRequest(port string, cmd string, payload interface{}) (RPCResponse, error) {
-	rpcPort := fmt.Sprintf("localhost:%d", safeStringToInt(port)+rpcPortOffset)
+// RPC 요청이 실패했으면 "코드: 메시지"를 표준 에러에 출력하고 종료
+// 노드에 연결하지 못해 응답이 없으면 rpcErrUnavailable
+func checkRPCResponse(resp RPCResponse, err error) {
+	if err != nil {
+		exitWithRPCError(rpcErrUnavailable, err.Error())
+	}
+	if !resp.Success {
+		code := resp.Code
+		if code == "" {
+			code = rpcErrInternal
+		}
+		exitWithRPCError(code, resp.Message)
+	}
+}
+
+func exitWithRPCError(code, message string) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", code, message)
+	os.Exit(1)
+}
+
+// 플래그와 노드의 설정 파일로 정한 주소에 RPC 요청 전송
+func (f *rpcClientFlags) send(cmd string, payload interface{}) (RPCResponse, error) {
+	cfg := DefaultNodeConfig()
+	port, err := strconv.Atoi(*f.port)
+	if err != nil {
+		return RPCResponse{Success: false}, fmt.Errorf("invalid port %q", *f.port)
+	}
+	cfg.Port = port
+
+	root := *f.dataDir
+	if root == "" {
+		root = DefaultDataDir(*f.port)
+	}
+	if _, err := LoadNodeConfig(ConfigFile(root), &cfg); err != nil {
+		return RPCResponse{Success: false}, err
+	}
+
+	user, password := cfg.RPC.User, cfg.RPC.Password
+	if *f.user != "" {
+		user, password = *f.user, *f.password
+	}
+	return sendRPCRequest(cfg.RPCDialAddress(), user, password, cmd, payload)
+}
 
-	conn, err := net.Dial(protocol, rpcPort)
+func sendRPCRequest(addr, user, password string, cmd string, payload interface{}) (RPCResponse, error) {
+	conn, err := net.Dial(protocol, addr)
 	if err != nil {
-		return RPCResponse{Success: false}, fmt.Errorf("Node at port %s is not running (RPC connection failed: %v)", port, err)
+		return RPCResponse{Success: false}, fmt.Errorf("Node RPC at %s is not running (RPC connection failed: %v)", addr, err)
 	}
 	defer conn.Close()
 
 	// 1. 요청 생성
 	req := RPCRequest{
-		Command: commandToBytes(cmd),
-		Payload: gobEncode(payload),
+		Command:  []byte(cmd),
+		Payload:  gobEncode(payload),
+		User:     user,
+		Password: password,
 	}
 
 	// 2. 요청 직렬화 및 전송
@@ -225,7 +816,7 @@ func sendRPCRequest(port string, cmd string, payload interface{}) (RPCResponse,
 	}
 
 	if len(respBytes) == 0 {
-		return RPCResponse{Success: false}, fmt.Errorf("Received empty RPC response from node %s", port)
+		return RPCResponse{Success: false}, fmt.Errorf("Received empty RPC response from node %s", addr)
 	}
 
 	// 4. 응답 역직렬화
@@ -0,0 +1,354 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	shortIDLen          = 6                // 짧은 트랜잭션 ID 길이 (바이트)
+	maxCompactBlockTxs  = 10000            // compact block 하나에 담을 수 있는 최대 트랜잭션 수
+	compactBlockTimeout = 10 * time.Second // 이 시간 안에 빠진 트랜잭션이 오지 않으면 블록 전체를 요청
+)
+
+// compact block에 그대로 담아 보내는 트랜잭션 (받는 쪽 멤풀에 있을 수 없는 코인베이스)
+type PrefilledTx struct {
+	Index int    // 블록 안에서의 위치
+	Tx    []byte // 직렬화된 트랜잭션
+}
+
+// 블록 헤더와 짧은 트랜잭션 ID만 담은 블록
+// 받는 쪽은 멤풀의 트랜잭션으로 블록을 재구성하고, 없는 트랜잭션만 'getblocktxn'으로 요청
+type CmpctBlock struct {
+	AddrFrom  string
+	Header    []byte        // 직렬화된 BlockHeader
+	Nonce     uint64        // 짧은 ID 계산에 쓰는 난수 (메시지마다 달라 충돌을 노린 트랜잭션을 만들기 어려움)
+	ShortIDs  [][]byte      // prefill되지 않은 트랜잭션의 짧은 ID (블록 안의 순서대로)
+	Prefilled []PrefilledTx // 그대로 담은 트랜잭션 (Index 오름차순)
+}
+
+type GetBlockTxn struct {
+	AddrFrom  string
+	BlockHash []byte
+	Indexes   []int // 요청할 트랜잭션의 블록 안 위치
+}
+
+type BlockTxn struct {
+	AddrFrom     string
+	BlockHash    []byte
+	Transactions [][]byte // 요청한 순서대로 직렬화된 트랜잭션
+}
+
+// 짧은 트랜잭션 ID
+func shortTxID(blockHash []byte, nonce uint64, txID []byte) []byte {
+	var nonceBytes [8]byte
+	binary.BigEndian.PutUint64(nonceBytes[:], nonce)
+	hash := sha256.Sum256(bytes.Join([][]byte{blockHash, nonceBytes[:], txID}, []byte{}))
+	return hash[:shortIDLen]
+}
+
+// 블록을 compact block으로 만듦. 코인베이스 트랜잭션은 그대로 담음
+func newCmpctBlock(addrFrom string, block *Block) CmpctBlock {
+	msg := CmpctBlock{
+		AddrFrom: addrFrom,
+		Header:   block.Header().Serialize(),
+		Nonce:    rand.Uint64(),
+	}
+	for i, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			msg.Prefilled = append(msg.Prefilled, PrefilledTx{Index: i, Tx: gobEncode(tx)})
+			continue
+		}
+		msg.ShortIDs = append(msg.ShortIDs, shortTxID(block.Hash, msg.Nonce, tx.ID))
+	}
+	return msg
+}
+
+// 재구성 중인 블록
+type partialBlock struct {
+	header    *BlockHeader
+	txs       []*Transaction // 블록 안의 위치별 트랜잭션 (아직 없으면 nil)
+	missing   []int          // 피어에게 요청한 트랜잭션 위치
+	from      *Peer
+	requested time.Time
+}
+
+// 모든 트랜잭션이 채워진 블록
+func (pb *partialBlock) block() *Block {
+	return &Block{
+		Height:        pb.header.Height,
+		Timestamp:     pb.header.Timestamp,
+		Transactions:  pb.txs,
+		PrevBlockHash: pb.header.PrevBlockHash,
+		Hash:          pb.header.Hash,
+		Nonce:         pb.header.Nonce,
+	}
+}
+
+// 빠진 트랜잭션을 기다리는 블록들
+type compactBlockPool struct {
+	pending map[string]*partialBlock // key: 블록 해시(hex)
+	lock    sync.Mutex
+}
+
+func newCompactBlockPool() *compactBlockPool {
+	return &compactBlockPool{pending: make(map[string]*partialBlock)}
+}
+
+func (cp *compactBlockPool) add(pb *partialBlock) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	cp.pending[hex.EncodeToString(pb.header.Hash)] = pb
+}
+
+func (cp *compactBlockPool) has(hash []byte) bool {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	_, ok := cp.pending[hex.EncodeToString(hash)]
+	return ok
+}
+
+// 재구성 중인 블록을 꺼냄. from이 nil이 아니면 그 피어에게 요청한 블록만 꺼냄
+func (cp *compactBlockPool) take(hash []byte, from *Peer) *partialBlock {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	key := hex.EncodeToString(hash)
+	pb, ok := cp.pending[key]
+	if !ok || (from != nil && pb.from != from) {
+		return nil
+	}
+	delete(cp.pending, key)
+	return pb
+}
+
+// 오래 응답이 없는 블록을 꺼냄
+func (cp *compactBlockPool) expire(now time.Time) []*partialBlock {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	var expired []*partialBlock
+	for key, pb := range cp.pending {
+		if now.Sub(pb.requested) > compactBlockTimeout {
+			delete(cp.pending, key)
+			expired = append(expired, pb)
+		}
+	}
+	return expired
+}
+
+// 연결이 끊긴 피어에게 요청한 블록을 버림
+func (cp *compactBlockPool) releasePeer(p *Peer) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	for key, pb := range cp.pending {
+		if pb.from == p {
+			delete(cp.pending, key)
+		}
+	}
+}
+
+// 새로 만든 블록을 피어들에게 알림
+// compact block을 지원하는 피어에게는 'cmpctblock'을 바로 보내고, 나머지 피어에게는 'inv'로 알림
+func (s *Server) announceBlock(block *Block) {
+	var msg *CmpctBlock
+	for _, peer := range s.connectedPeers() {
+		if peer.knowsInventory(block.Hash) {
+			continue
+		}
+		if peer.Version().Version < compactBlocksVersion {
+			s.sendInv(peer, "block", [][]byte{block.Hash})
+			continue
+		}
+		if msg == nil {
+			cmpct := newCmpctBlock(s.nodeAddress, block)
+			msg = &cmpct
+		}
+		peer.addKnownInventory(block.Hash)
+		s.sendMessage(peer, "cmpctblock", msg)
+	}
+}
+
+// 'cmpctblock' 메시지 처리
+// tip에 이어지는 블록이면 멤풀의 트랜잭션으로 재구성하고, 없는 트랜잭션만 요청
+// tip에 이어지지 않으면 헤더부터 받는 일반 동기화로 처리
+func (s *Server) handleCmpctBlock(p *Peer, payload []byte) {
+	var msg CmpctBlock
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&msg); err != nil {
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed cmpctblock: %v", err))
+		return
+	}
+	header, err := DeserializeBlockHeader(msg.Header)
+	if err != nil {
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed cmpctblock header: %v", err))
+		return
+	}
+	txCount := len(msg.ShortIDs) + len(msg.Prefilled)
+	if txCount > maxCompactBlockTxs {
+		s.misbehaving(p, scoreOversized, fmt.Sprintf("cmpctblock with %d transactions (maximum %d)", txCount, maxCompactBlockTxs))
+		return
+	}
+	if !header.ValidatePoW() {
+		s.misbehaving(p, scoreInvalid, fmt.Sprintf("cmpctblock %x with invalid PoW", header.Hash))
+		return
+	}
+
+	p.addKnownInventory(header.Hash)
+	p.updateBestHeight(header.Height)
+
+	if s.bc.InMainChain(header.Hash) || s.compactBlocks.has(header.Hash) {
+		return
+	}
+
+	tipHash, _, err := s.bc.GetTipInfo()
+	if err != nil {
+		logChain.Error("Failed to read chain tip", "err", err)
+		return
+	}
+	if !bytes.Equal(header.PrevBlockHash, tipHash) {
+		logP2P.Debug("Compact block does not extend our tip, syncing headers", hexAttr("hash", header.Hash), "peer", p.String())
+		s.sendGetHeaders(p)
+		return
+	}
+
+	pb := &partialBlock{header: header, txs: make([]*Transaction, txCount), from: p}
+
+	// prefill된 트랜잭션을 제자리에 넣음
+	last := -1
+	for _, prefilled := range msg.Prefilled {
+		if prefilled.Index <= last || prefilled.Index >= txCount {
+			s.misbehaving(p, scoreMalformed, fmt.Sprintf("cmpctblock %x with invalid prefilled index %d", header.Hash, prefilled.Index))
+			return
+		}
+		last = prefilled.Index
+
+		var tx Transaction
+		if err := gob.NewDecoder(bytes.NewReader(prefilled.Tx)).Decode(&tx); err != nil {
+			s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed prefilled transaction: %v", err))
+			return
+		}
+		pb.txs[prefilled.Index] = &tx
+	}
+
+	// 멤풀의 트랜잭션을 짧은 ID로 찾음 (같은 짧은 ID가 여럿이면 어느 것인지 모르므로 요청)
+	mempoolTxs := make(map[string]*Transaction)
+	for _, tx := range s.mempool.GetTxs() {
+		key := hex.EncodeToString(shortTxID(header.Hash, msg.Nonce, tx.ID))
+		if _, ok := mempoolTxs[key]; ok {
+			mempoolTxs[key] = nil
+			continue
+		}
+		mempoolTxs[key] = tx
+	}
+
+	next := 0
+	for i := range pb.txs {
+		if pb.txs[i] != nil {
+			continue
+		}
+		if tx := mempoolTxs[hex.EncodeToString(msg.ShortIDs[next])]; tx != nil {
+			pb.txs[i] = tx
+		} else {
+			pb.missing = append(pb.missing, i)
+		}
+		next++
+	}
+
+	logP2P.Debug("Received compact block", hexAttr("hash", header.Hash), "height", header.Height, "peer", p.String(),
+		"txs", txCount, "from_mempool", len(msg.ShortIDs)-len(pb.missing), "missing", len(pb.missing))
+
+	if len(pb.missing) == 0 {
+		s.completeCompactBlock(pb)
+		return
+	}
+
+	pb.requested = time.Now()
+	s.compactBlocks.add(pb)
+	s.sendMessage(p, "getblocktxn", GetBlockTxn{AddrFrom: s.nodeAddress, BlockHash: header.Hash, Indexes: pb.missing})
+}
+
+// 재구성한 블록을 체인에 추가
+// 트랜잭션 해시가 헤더와 다르면 (짧은 ID 충돌 등) 블록 전체를 요청
+func (s *Server) completeCompactBlock(pb *partialBlock) {
+	block := pb.block()
+	if !bytes.Equal(block.HashTransactions(), pb.header.TxHash) {
+		logP2P.Info("Failed to reconstruct compact block, requesting full block", hexAttr("hash", block.Hash))
+		s.sendGetData(pb.from, "block", block.Hash)
+		return
+	}
+
+	logP2P.Debug("Reconstructed compact block", hexAttr("hash", block.Hash), "height", block.Height)
+	s.receiveBlock(pb.from, block)
+}
+
+// 빠진 트랜잭션을 받지 못한 블록은 블록 전체를 요청
+func (s *Server) fallbackToFullBlock(pb *partialBlock) {
+	logP2P.Info("Compact block not completed, requesting full block", hexAttr("hash", pb.header.Hash), "peer", pb.from.String())
+	s.sendGetData(pb.from, "block", pb.header.Hash)
+}
+
+// 'getblocktxn' 메시지 처리
+// 요청한 위치의 트랜잭션을 'blocktxn'으로 보냄
+func (s *Server) handleGetBlockTxn(p *Peer, payload []byte) {
+	var req GetBlockTxn
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&req); err != nil {
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed getblocktxn: %v", err))
+		return
+	}
+
+	block, err := s.bc.GetBlock(req.BlockHash)
+	if err != nil {
+		logP2P.Debug("Block for getblocktxn not available", hexAttr("hash", req.BlockHash), "err", err)
+		s.sendNotFound(p, "block", [][]byte{req.BlockHash})
+		return
+	}
+
+	resp := BlockTxn{AddrFrom: s.nodeAddress, BlockHash: block.Hash}
+	for _, index := range req.Indexes {
+		if index < 0 || index >= len(block.Transactions) {
+			s.misbehaving(p, scoreMalformed, fmt.Sprintf("getblocktxn index %d out of range for block %x", index, block.Hash))
+			return
+		}
+		resp.Transactions = append(resp.Transactions, gobEncode(block.Transactions[index]))
+	}
+	s.sendMessage(p, "blocktxn", resp)
+}
+
+// 'blocktxn' 메시지 처리
+// 받은 트랜잭션으로 블록을 마저 채워 체인에 추가
+func (s *Server) handleBlockTxn(p *Peer, payload []byte) {
+	var msg BlockTxn
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&msg); err != nil {
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed blocktxn: %v", err))
+		return
+	}
+
+	pb := s.compactBlocks.take(msg.BlockHash, p)
+	if pb == nil {
+		logP2P.Debug("Unexpected blocktxn, ignoring", hexAttr("hash", msg.BlockHash), "peer", p.String())
+		return
+	}
+
+	if len(msg.Transactions) != len(pb.missing) {
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("blocktxn with %d transactions (requested %d)", len(msg.Transactions), len(pb.missing)))
+		return
+	}
+	for i, data := range msg.Transactions {
+		var tx Transaction
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&tx); err != nil {
+			s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed transaction in blocktxn: %v", err))
+			return
+		}
+		pb.txs[pb.missing[i]] = &tx
+	}
+
+	s.completeCompactBlock(pb)
+}
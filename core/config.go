@@ -0,0 +1,321 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 멤풀 크기 제한 기본값
+const (
+	defaultMempoolMaxTxs   = 5000
+	defaultMempoolMaxBytes = 16 * 1024 * 1024
+)
+
+// 노드 설정 (설정 파일 <datadir>/gochain.json의 형식)
+// 기본값 위에 설정 파일의 값을, 그 위에 startnode 플래그의 값을 덮어써서 정함
+type NodeConfig struct {
+	Network string        `json:"network"`
+	Port    int           `json:"port"`     // P2P 포트
+	PruneMB int64         `json:"prune_mb"` // 블록 본문 보관 용량(MB). 0이면 prune 하지 않음
+	RPC     RPCConfig     `json:"rpc"`
+	Peers   PeersConfig   `json:"peers"`
+	Mining  MiningConfig  `json:"mining"`
+	Mempool MempoolConfig `json:"mempool"`
+	Indexes IndexesConfig `json:"indexes"`
+	Logging LoggingConfig `json:"logging"`
+}
+
+type RPCConfig struct {
+	Bind     string `json:"bind"`               // listen 주소 (0.0.0.0이면 모든 인터페이스)
+	Port     int    `json:"port,omitempty"`     // 0이면 P2P 포트 + 1000
+	User     string `json:"user,omitempty"`     // 설정하면 RPC 요청에 사용자 이름과 비밀번호가 필요
+	Password string `json:"password,omitempty"` // user와 함께 설정
+}
+
+type PeersConfig struct {
+	Seeds       []string `json:"seeds"`                 // 시작할 때마다 피어 목록에 추가하는 주소
+	Connect     []string `json:"connect,omitempty"`     // 지정하면 이 주소들에만 outbound 연결
+	MaxOutbound int      `json:"max_outbound"`          // 유지하려는 outbound 연결 수
+	MaxInbound  int      `json:"max_inbound"`           // 최대 inbound 연결 수
+	Encrypt     bool     `json:"encrypt"`               // TLS로 P2P 연결 암호화
+	AllowPeers  []string `json:"allow_peers,omitempty"` // 연결을 허용할 노드 ID (지정하면 암호화도 사용)
+}
+
+type MiningConfig struct {
+	Address string `json:"address,omitempty"` // 채굴 보상 주소 (비어있으면 채굴하지 않음)
+	Threads int    `json:"threads"`           // 채굴에 사용하는 고루틴 수
+}
+
+type MempoolConfig struct {
+	MaxTxs     int  `json:"max_txs"`     // 최대 트랜잭션 수 (0이면 제한 없음)
+	MaxBytes   int  `json:"max_bytes"`   // 최대 크기 합 (0이면 제한 없음)
+	ServePeers bool `json:"serve_peers"` // 피어의 'mempool' 요청에 응답
+}
+
+type IndexesConfig struct {
+	TxIndex bool `json:"txindex"` // 트랜잭션 ID → 블록 인덱스
+}
+
+type LoggingConfig struct {
+	Level string `json:"level"` // SetLogLevels 형식 (예: "info,p2p=debug")
+	JSON  bool   `json:"json"`  // JSON 형식으로 출력
+}
+
+// 기본 설정 (설정 파일과 플래그가 없을 때의 값)
+func DefaultNodeConfig() NodeConfig {
+	port, _ := strconv.Atoi(defaultPort)
+	return NodeConfig{
+		Network: defaultNetwork,
+		Port:    port,
+		RPC:     RPCConfig{Bind: "localhost"},
+		Peers: PeersConfig{
+			Seeds:       splitAddrList(defaultSeed),
+			MaxOutbound: targetOutboundPeers,
+			MaxInbound:  maxInboundPeers,
+		},
+		Mining: MiningConfig{Threads: 1},
+		Mempool: MempoolConfig{
+			MaxTxs:     defaultMempoolMaxTxs,
+			MaxBytes:   defaultMempoolMaxBytes,
+			ServePeers: true,
+		},
+		Logging: LoggingConfig{Level: "info"},
+	}
+}
+
+// 데이터 디렉토리(root)의 설정 파일 경로
+// 네트워크도 설정 파일에서 정하므로 네트워크 디렉토리가 아닌 root에 둠
+func ConfigFile(root string) string {
+	return filepath.Join(root, configFileName)
+}
+
+// 설정 파일의 값을 cfg 위에 덮어씀 (파일에 없는 항목은 cfg의 값을 유지)
+// 파일이 없으면 cfg를 그대로 두고 false, 알 수 없는 항목이 있으면 에러
+func LoadNodeConfig(file string, cfg *NodeConfig) (bool, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return false, fmt.Errorf("config file %s: %w", file, err)
+	}
+	return true, nil
+}
+
+// 설정 값 확인
+func (c *NodeConfig) Validate() error {
+	var errs []error
+	if !slices.Contains(knownNetworks, c.Network) {
+		errs = append(errs, fmt.Errorf("unknown network %q (known: %v)", c.Network, knownNetworks))
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid port %d", c.Port))
+	}
+	if c.RPC.Port < 0 || c.RPC.Port > 65535 || c.RPCPort() == c.Port {
+		errs = append(errs, fmt.Errorf("invalid RPC port %d", c.RPCPort()))
+	}
+	if (c.RPC.User == "") != (c.RPC.Password == "") {
+		errs = append(errs, errors.New("RPC user and password must be set together"))
+	}
+	if c.PruneMB < 0 {
+		errs = append(errs, fmt.Errorf("invalid prune size %d MB", c.PruneMB))
+	}
+	if c.Peers.MaxOutbound < 1 || c.Peers.MaxInbound < 1 {
+		errs = append(errs, fmt.Errorf("invalid peer limits (outbound %d, inbound %d)", c.Peers.MaxOutbound, c.Peers.MaxInbound))
+	}
+	if c.Mining.Address != "" && !ValidateAddress(c.Mining.Address) {
+		errs = append(errs, fmt.Errorf("%w: mining address %q", ErrInvalidAddress, c.Mining.Address))
+	}
+	if c.Mining.Threads < 1 {
+		errs = append(errs, fmt.Errorf("invalid mining threads %d", c.Mining.Threads))
+	}
+	if c.Mempool.MaxTxs < 0 || c.Mempool.MaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("invalid mempool limits (%d txs, %d bytes)", c.Mempool.MaxTxs, c.Mempool.MaxBytes))
+	}
+	if _, err := parseLogLevels(c.Logging.Level); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// 실제로 사용하는 RPC 포트
+func (c *NodeConfig) RPCPort() int {
+	if c.RPC.Port == 0 {
+		return c.Port + rpcPortOffset
+	}
+	return c.RPC.Port
+}
+
+// RPC 클라이언트가 연결할 주소
+// 모든 인터페이스에서 listen 하는 경우(0.0.0.0, ::)에는 localhost로 연결
+func (c *NodeConfig) RPCDialAddress() string {
+	host := c.RPC.Bind
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(c.RPCPort()))
+}
+
+// 설정으로 서버 설정을 만듦
+func (c *NodeConfig) ServerConfig(dataDir *DataDir) ServerConfig {
+	return ServerConfig{
+		Port:            strconv.Itoa(c.Port),
+		MinerAddress:    c.Mining.Address,
+		MiningThreads:   c.Mining.Threads,
+		DataDir:         dataDir,
+		PruneMB:         c.PruneMB,
+		TxIndex:         c.Indexes.TxIndex,
+		Seeds:           c.Peers.Seeds,
+		Connect:         c.Peers.Connect,
+		MaxOutbound:     c.Peers.MaxOutbound,
+		MaxInbound:      c.Peers.MaxInbound,
+		Encrypt:         c.Peers.Encrypt,
+		AllowPeers:      c.Peers.AllowPeers,
+		NoMempool:       !c.Mempool.ServePeers,
+		MempoolMaxTxs:   c.Mempool.MaxTxs,
+		MempoolMaxBytes: c.Mempool.MaxBytes,
+		RPCBind:         c.RPC.Bind,
+		RPCPort:         c.RPCPort(),
+		RPCUser:         c.RPC.User,
+		RPCPassword:     c.RPC.Password,
+	}
+}
+
+// 설정으로 로그 설정을 만듦 (로그 파일은 데이터 디렉토리의 logs/)
+func (c *NodeConfig) LogConfig(dataDir *DataDir) LogConfig {
+	return LogConfig{Levels: c.Logging.Level, JSON: c.Logging.JSON, Dir: dataDir.LogDir()}
+}
+
+// dumpconfig 출력용 JSON. 파생되는 값(RPC 포트)을 채우고 비밀번호는 가림
+func (c NodeConfig) Dump() ([]byte, error) {
+	c.RPC.Port = c.RPCPort()
+	if c.RPC.Password != "" {
+		c.RPC.Password = "********"
+	}
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// 설정 항목에 대응하는 플래그를 등록 (startnode, dumpconfig)
+// 플래그의 기본값은 cfg의 현재 값이고, 파싱하면 cfg에 바로 기록됨
+func bindNodeConfigFlags(fs *flag.FlagSet, cfg *NodeConfig) {
+	fs.StringVar(&cfg.Network, "network", cfg.Network, "Network name")
+	fs.IntVar(&cfg.Port, "port", cfg.Port, "Node port to listen on")
+	fs.Int64Var(&cfg.PruneMB, "prune", cfg.PruneMB, "Keep only about this many MB of old block data (0 = keep all blocks)")
+
+	fs.StringVar(&cfg.RPC.Bind, "rpcbind", cfg.RPC.Bind, "Address the RPC server listens on")
+	fs.IntVar(&cfg.RPC.Port, "rpcport", cfg.RPC.Port, "RPC port (0 = port + 1000)")
+	fs.StringVar(&cfg.RPC.User, "rpcuser", cfg.RPC.User, "User name required for RPC requests")
+	fs.StringVar(&cfg.RPC.Password, "rpcpassword", cfg.RPC.Password, "Password required for RPC requests")
+
+	fs.Var(listFlag{&cfg.Peers.Seeds}, "seeds", "Comma-separated seed node addresses (empty = no seeds)")
+	fs.Var(listFlag{&cfg.Peers.Connect}, "connect", "Comma-separated addresses; if set, only connect to these peers")
+	fs.IntVar(&cfg.Peers.MaxOutbound, "maxoutbound", cfg.Peers.MaxOutbound, "Number of outbound connections to keep")
+	fs.IntVar(&cfg.Peers.MaxInbound, "maxinbound", cfg.Peers.MaxInbound, "Maximum number of inbound connections")
+	fs.BoolVar(&cfg.Peers.Encrypt, "encrypt", cfg.Peers.Encrypt, "Encrypt peer connections with TLS using the node key")
+	fs.Var(listFlag{&cfg.Peers.AllowPeers}, "allowpeers", "Comma-separated node IDs; if set, only these nodes may connect (implies -encrypt)")
+
+	fs.StringVar(&cfg.Mining.Address, "miner", cfg.Mining.Address, "Mining reward address (optional)")
+	fs.IntVar(&cfg.Mining.Threads, "minerthreads", cfg.Mining.Threads, "Number of goroutines used for mining")
+
+	fs.IntVar(&cfg.Mempool.MaxTxs, "mempoolmaxtxs", cfg.Mempool.MaxTxs, "Maximum number of mempool transactions (0 = no limit)")
+	fs.IntVar(&cfg.Mempool.MaxBytes, "mempoolmaxbytes", cfg.Mempool.MaxBytes, "Maximum total size of mempool transactions in bytes (0 = no limit)")
+	fs.Var(notFlag{&cfg.Mempool.ServePeers}, "nomempool", "Do not answer mempool requests from peers")
+
+	fs.BoolVar(&cfg.Indexes.TxIndex, "txindex", cfg.Indexes.TxIndex, "Maintain a transaction index")
+
+	fs.StringVar(&cfg.Logging.Level, "loglevel", cfg.Logging.Level, "Log levels, e.g. info or info,p2p=debug")
+	fs.BoolVar(&cfg.Logging.JSON, "logjson", cfg.Logging.JSON, "Write logs as JSON lines")
+}
+
+// 노드 설정을 정함: 기본값 → <root>/gochain.json → fs에서 지정한 플래그 순서로 덮어씀
+// fs는 bindNodeConfigFlags로 플래그를 등록하고 파싱을 마친 FlagSet
+// root가 비어있으면 플래그의 포트로 기본 데이터 디렉토리를 정함
+func resolveNodeConfig(fs *flag.FlagSet, root string) (NodeConfig, string, error) {
+	if root == "" {
+		root = DefaultDataDir(fs.Lookup("port").Value.String())
+	}
+
+	cfg := DefaultNodeConfig()
+	if _, err := LoadNodeConfig(ConfigFile(root), &cfg); err != nil {
+		return cfg, root, err
+	}
+
+	// 명령줄에서 지정한 플래그만 파일의 값을 덮어씀
+	overrides := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	bindNodeConfigFlags(overrides, &cfg)
+	var errs []error
+	fs.Visit(func(f *flag.Flag) {
+		if overrides.Lookup(f.Name) != nil {
+			errs = append(errs, overrides.Set(f.Name, f.Value.String()))
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return cfg, root, err
+	}
+
+	return cfg, root, cfg.Validate()
+}
+
+// 쉼표로 구분된 목록 플래그 (지정하면 목록 전체를 바꿈. 빈 문자열이면 빈 목록)
+type listFlag struct {
+	list *[]string
+}
+
+func (f listFlag) String() string {
+	if f.list == nil {
+		return ""
+	}
+	return strings.Join(*f.list, ",")
+}
+
+func (f listFlag) Set(s string) error {
+	*f.list = append([]string{}, splitAddrList(s)...)
+	return nil
+}
+
+// 지정하면 설정 값을 false로 만드는 플래그 (-nomempool → serve_peers: false)
+type notFlag struct {
+	value *bool
+}
+
+func (f notFlag) String() string {
+	if f.value == nil {
+		return "false"
+	}
+	return strconv.FormatBool(!*f.value)
+}
+
+func (f notFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*f.value = !v
+	return nil
+}
+
+func (f notFlag) IsBoolFlag() bool { return true }
+
+// 루프백 주소인지 (localhost 포함)
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const defaultNetwork = "mainnet"
+const defaultDataDirName = ".gochain"
+
+const (
+	chainFileName  = "blockchain.db"
+	walletFileName = "wallet.dat"
+	peersFileName  = "peers.json"
+	banListName    = "banlist.json"
+	nodeKeyName    = "nodekey.pem"
+	mempoolName    = "mempool.dat"
+	logDirName     = "logs"
+	lockFileName   = ".lock"
+	configFileName = "gochain.json" // 네트워크 디렉토리가 아닌 root에 있음 (config.go)
+)
+
+// 지원하는 네트워크 목록. 네트워크마다 데이터 디렉토리가 분리됨
+var knownNetworks = []string{"mainnet", "testnet", "regtest"}
+
+// 네트워크별 매직 값
+// 부트스트랩 파일 등 네트워크 데이터의 시작에 기록하여 다른 네트워크의 데이터를 구분
+var networkMagics = map[string]uint32{
+	"mainnet": 0xf9beb4d9,
+	"testnet": 0x0b110907,
+	"regtest": 0xfabfb5da,
+}
+
+// 노드 데이터 디렉토리
+// <root>/<network>/ 아래에 체인 DB, 지갑, 피어 목록, 로그를 보관
+type DataDir struct {
+	root     string
+	network  string
+	lockFile *os.File
+}
+
+// 기본 데이터 디렉토리: $HOME/.gochain/<port>
+// 한 머신에서 여러 노드를 띄울 수 있도록 포트별로 분리
+func DefaultDataDir(port string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, defaultDataDirName, port)
+}
+
+// 데이터 디렉토리를 준비 (네트워크 디렉토리가 없으면 생성)
+func NewDataDir(root, network string) (*DataDir, error) {
+	if network == "" {
+		network = defaultNetwork
+	}
+	if !slices.Contains(knownNetworks, network) {
+		return nil, fmt.Errorf("Unknown network %q (known: %v)", network, knownNetworks)
+	}
+
+	d := &DataDir{root: root, network: network}
+	if err := os.MkdirAll(d.NetworkDir(), 0700); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DataDir) Root() string    { return d.root }
+func (d *DataDir) Network() string { return d.network }
+func (d *DataDir) Magic() uint32   { return networkMagics[d.network] }
+
+func (d *DataDir) NetworkDir() string  { return filepath.Join(d.root, d.network) }
+func (d *DataDir) ChainFile() string   { return filepath.Join(d.NetworkDir(), chainFileName) }
+func (d *DataDir) WalletFile() string  { return filepath.Join(d.NetworkDir(), walletFileName) }
+func (d *DataDir) PeersFile() string   { return filepath.Join(d.NetworkDir(), peersFileName) }
+func (d *DataDir) BanList() string     { return filepath.Join(d.NetworkDir(), banListName) }
+func (d *DataDir) LogDir() string      { return filepath.Join(d.NetworkDir(), logDirName) }
+func (d *DataDir) NodeKey() string     { return filepath.Join(d.NetworkDir(), nodeKeyName) }
+func (d *DataDir) MempoolFile() string { return filepath.Join(d.NetworkDir(), mempoolName) }
+
+// 다른 프로세스가 같은 디렉토리를 사용하지 못하도록 잠금
+// 잠금은 Unlock을 호출하거나 프로세스가 종료되면 해제됨
+func (d *DataDir) Lock() error {
+	if d.lockFile != nil {
+		return nil
+	}
+
+	path := filepath.Join(d.NetworkDir(), lockFileName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("Data directory %s is already in use by another process", d.NetworkDir())
+	}
+
+	// 잠금을 가진 프로세스를 알 수 있도록 PID 기록
+	f.Truncate(0)
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+
+	d.lockFile = f
+	return nil
+}
+
+func (d *DataDir) Unlock() {
+	if d.lockFile == nil {
+		return
+	}
+	unlockFile(d.lockFile)
+	d.lockFile.Close()
+	d.lockFile = nil
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package core
+
+import (
+	"os"
+)
+
+// flock을 지원하지 않는 플랫폼에서는 별도의 잠금 파일을 배타적으로 생성
+// 비정상 종료 시에는 잠금 파일(.lock.pid)을 직접 지워야 함
+func lockFile(f *os.File) error {
+	lock, err := os.OpenFile(f.Name()+".pid", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	return lock.Close()
+}
+
+func unlockFile(f *os.File) error {
+	return os.Remove(f.Name() + ".pid")
+}
@@ -0,0 +1,412 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	downloadWindow           = 128              // 갈림 지점 위로 이 높이까지만 본문을 요청 (버퍼 메모리 제한)
+	maxBlocksInFlightPerPeer = 16               // 피어 하나에 동시에 요청하는 최대 블록 수
+	blockRequestTimeout      = 20 * time.Second // 이 시간 안에 오지 않은 요청은 다른 피어에게 다시 요청
+	downloadTickInterval     = 2 * time.Second  // 타임아웃 확인 및 요청 채우기 주기
+)
+
+// 요청한 블록 하나
+type blockRequest struct {
+	hash      []byte
+	height    int64
+	peer      *Peer
+	requested time.Time
+}
+
+// 순서 없이 도착해 부모가 연결되기를 기다리는 블록
+type bufferedBlock struct {
+	block *Block
+	from  *Peer
+}
+
+// 여러 피어에게서 블록 본문을 동시에 받아오는 다운로드 스케줄러
+// 헤더 체인에서 본문이 없는 블록을 downloadWindow 범위 안에서 피어들에게 나눠 요청하고,
+// 먼저 도착한 블록은 부모 블록이 연결될 때까지 (다른 갈래면 tip보다 무거워질 때까지) 버퍼에 보관
+type blockDownloader struct {
+	inFlight map[string]*blockRequest // key: 블록 해시(hex)
+	perPeer  map[*Peer]int            // 피어별 요청 중인 블록 수
+	stalled  map[string]*Peer         // 타임아웃된 요청의 피어 (다시 요청할 때 가능하면 피하기 위해)
+	buffered map[int64]*bufferedBlock // key: 블록 높이
+	syncing  bool                     // 다운로드 중인지 (완료 시점 감지용)
+	lock     sync.Mutex
+}
+
+func newBlockDownloader() *blockDownloader {
+	return &blockDownloader{
+		inFlight: make(map[string]*blockRequest),
+		perPeer:  make(map[*Peer]int),
+		stalled:  make(map[string]*Peer),
+		buffered: make(map[int64]*bufferedBlock),
+	}
+}
+
+// 요청 완료 처리. 요청한 블록이었으면 true
+func (d *blockDownloader) received(hash []byte) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	key := hex.EncodeToString(hash)
+	req, ok := d.inFlight[key]
+	if !ok {
+		return false
+	}
+	d.release(key, req)
+	delete(d.stalled, key)
+	return true
+}
+
+func (d *blockDownloader) release(key string, req *blockRequest) {
+	delete(d.inFlight, key)
+	d.perPeer[req.peer]--
+	if d.perPeer[req.peer] <= 0 {
+		delete(d.perPeer, req.peer)
+	}
+}
+
+// 피어의 연결이 끊기면 그 피어에 대한 요청을 모두 취소 (다음 스케줄링에서 다른 피어에게 요청)
+func (d *blockDownloader) releasePeer(p *Peer) int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	released := 0
+	for key, req := range d.inFlight {
+		if req.peer == p {
+			d.release(key, req)
+			released++
+		}
+	}
+	for key, peer := range d.stalled {
+		if peer == p {
+			delete(d.stalled, key)
+		}
+	}
+	return released
+}
+
+// 오래 응답이 없는 요청을 취소
+func (d *blockDownloader) expire(now time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for key, req := range d.inFlight {
+		if now.Sub(req.requested) > blockRequestTimeout {
+			logP2P.Info("Block request timed out, reassigning", hexAttr("hash", req.hash), "peer", req.peer.String())
+			d.release(key, req)
+			d.stalled[key] = req.peer
+		}
+	}
+}
+
+// 피어가 요청한 블록을 가지고 있지 않다고 응답하면 요청을 취소 (다른 피어에게 다시 요청)
+func (d *blockDownloader) notFound(hash []byte, p *Peer) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	key := hex.EncodeToString(hash)
+	if req, ok := d.inFlight[key]; ok && req.peer == p {
+		d.release(key, req)
+		d.stalled[key] = p
+	}
+}
+
+// 헤더 체인에서 본문을 기다리던 블록을 버퍼에 보관
+func (d *blockDownloader) buffer(block *Block, from *Peer) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.buffered[block.Height] = &bufferedBlock{block: block, from: from}
+}
+
+// 버퍼에서 해당 높이의 블록을 꺼냄. tip 이하의 오래된 블록은 버림
+func (d *blockDownloader) popBuffered(height int64) *bufferedBlock {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for h := range d.buffered {
+		if h < height {
+			delete(d.buffered, h)
+		}
+	}
+	b := d.buffered[height]
+	delete(d.buffered, height)
+	return b
+}
+
+// 버퍼에서 from부터 to까지 이어지는 블록들을 꺼냄 (reorg 할 갈래)
+// 빠진 높이가 있거나 서로 이어지지 않으면 (헤더 체인이 바뀌기 전에 받은 블록) 아무것도 꺼내지 않음
+func (d *blockDownloader) bufferedRange(from, to int64) []*bufferedBlock {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var branch []*bufferedBlock
+	for height := from; height <= to; height++ {
+		b, ok := d.buffered[height]
+		if !ok {
+			return nil
+		}
+		if len(branch) > 0 && !bytes.Equal(b.block.PrevBlockHash, branch[len(branch)-1].block.Hash) {
+			return nil
+		}
+		branch = append(branch, b)
+	}
+	for height := from; height <= to; height++ {
+		delete(d.buffered, height)
+	}
+	return branch
+}
+
+// height의 블록을 요청할 피어 선택
+// 그 블록을 가진 피어 중 요청 중인 블록이 가장 적은 피어를 고르고, 타임아웃된 피어는 다른 피어가 없을 때만 사용
+func (d *blockDownloader) pickPeer(peers []*Peer, key string, height int64) *Peer {
+	var best, fallback *Peer
+	for _, peer := range peers {
+		version := peer.Version()
+		if peer.BestHeight() < height || version.PrunedHeight >= height {
+			continue
+		}
+		if d.perPeer[peer] >= maxBlocksInFlightPerPeer {
+			continue
+		}
+		if d.stalled[key] == peer {
+			fallback = peer
+			continue
+		}
+		if best == nil || d.perPeer[peer] < d.perPeer[best] {
+			best = peer
+		}
+	}
+	if best == nil {
+		return fallback
+	}
+	return best
+}
+
+// 본문이 없는 블록을 피어들에게 나눠 요청
+func (s *Server) scheduleDownloads() {
+	start, missing, err := s.bc.MissingBlockHashes()
+	if err != nil {
+		logChain.Error("Failed to read header chain", "err", err)
+		return
+	}
+	peers := s.connectedPeers()
+
+	d := s.downloads
+	requests := make(map[*Peer][][]byte)
+
+	d.lock.Lock()
+	now := time.Now()
+	for i, hash := range missing {
+		height := start + int64(i)
+		if height >= start+downloadWindow {
+			break
+		}
+
+		key := hex.EncodeToString(hash)
+		if _, ok := d.inFlight[key]; ok {
+			continue
+		}
+		if b, ok := d.buffered[height]; ok && hex.EncodeToString(b.block.Hash) == key {
+			continue
+		}
+
+		peer := d.pickPeer(peers, key, height)
+		if peer == nil {
+			continue
+		}
+		d.inFlight[key] = &blockRequest{hash: hash, height: height, peer: peer, requested: now}
+		d.perPeer[peer]++
+		d.syncing = true
+		requests[peer] = append(requests[peer], hash)
+	}
+	d.lock.Unlock()
+
+	for peer, hashes := range requests {
+		logP2P.Debug("Requesting blocks", "peer", peer.String(), "count", len(hashes))
+		s.sendGetData(peer, "block", hashes...)
+	}
+}
+
+// 주기적으로 타임아웃된 요청을 정리하고 요청을 채움 (새로 연결된 피어도 다운로드에 참여)
+func (s *Server) downloadLoop() {
+	for s.sleep(downloadTickInterval) {
+		s.downloads.expire(time.Now())
+		s.scheduleDownloads()
+
+		for _, pb := range s.compactBlocks.expire(time.Now()) {
+			s.fallbackToFullBlock(pb)
+		}
+	}
+}
+
+// 받은 블록 처리
+// - tip에 이어지면 추가하고, 버퍼와 고아 풀에서 이어지는 블록들도 연결
+// - 헤더 체인에서 본문을 기다리던 블록은 버퍼에 보관하고, 다른 갈래가 tip보다 무거워지면 reorg (다운로드 스케줄러가 요청한 블록)
+// - 부모가 메인 체인에 없으면 고아 풀에 보관하고 조상을 요청
+// - 부모가 tip이 아닌 메인 체인 블록이면 다른 갈래이므로, 헤더를 받아 작업량을 비교
+func (s *Server) receiveBlock(p *Peer, block *Block) {
+	s.downloads.received(block.Hash)
+
+	tipHash, tip, err := s.bc.GetTipInfo()
+	if err != nil {
+		logChain.Error("Failed to read chain tip", "err", err)
+		return
+	}
+	fork, err := s.bc.ForkHeight()
+	if err != nil {
+		logChain.Error("Failed to read header chain", "err", err)
+		return
+	}
+	switch {
+	case bytes.Equal(block.PrevBlockHash, tipHash):
+		if s.connectBlock(p, block) {
+			s.connectPendingBlocks()
+		}
+	case block.Height <= fork+downloadWindow && s.bc.IsPendingBlock(block.Hash, block.Height):
+		s.downloads.buffer(block, p)
+		s.connectPendingBlocks()
+	case !s.bc.InMainChain(block.PrevBlockHash):
+		s.addOrphan(p, block)
+	case !s.bc.InMainChain(block.Hash):
+		logP2P.Debug("Block on another branch, requesting headers", hexAttr("hash", block.Hash), "height", block.Height, "tip", tip)
+		s.sendGetHeaders(p)
+	default:
+		logP2P.Debug("Block already in main chain, ignoring", hexAttr("hash", block.Hash), "height", block.Height)
+	}
+
+	s.scheduleDownloads()
+	s.checkSyncComplete()
+}
+
+// 블록을 체인에 추가. 성공하면 true
+func (s *Server) connectBlock(p *Peer, block *Block) bool {
+	if err := s.bc.AddBlock(block); err != nil {
+		logChain.Warn("Failed to add block", hexAttr("hash", block.Hash), "err", err)
+
+		// 어떤 체인에도 들어갈 수 없는 블록을 보낸 피어는 차단
+		// (헤더는 남아있으므로 다른 피어로부터 다시 받을 수 있음)
+		if errors.Is(err, ErrInvalidBlock) {
+			s.misbehaving(p, scoreInvalid, err.Error())
+		}
+		return false
+	}
+
+	// 블록 추가에 성공하면 해당 블록에 있는 트랜잭션을 멤풀에서 제거
+	s.mempool.Clear(block)
+	p.updateBestHeight(block.Height)
+	return true
+}
+
+// 부모가 연결되어 이어 붙일 수 있게 된 버퍼와 고아 풀의 블록들을 순서대로 추가
+// 헤더 체인이 tip 아래에서 갈라졌으면, 갈래의 블록이 tip 높이 다음까지 모였을 때 reorg 함
+func (s *Server) connectPendingBlocks() {
+	for {
+		tipHash, tip, err := s.bc.GetTipInfo()
+		if err != nil {
+			logChain.Error("Failed to read chain tip", "err", err)
+			return
+		}
+
+		fork, err := s.bc.ForkHeight()
+		if err != nil {
+			logChain.Error("Failed to read header chain", "err", err)
+			return
+		}
+		if fork < tip {
+			branch := s.downloads.bufferedRange(fork+1, tip+1)
+			if branch == nil || !s.reorganize(branch) {
+				return
+			}
+			continue
+		}
+
+		if b := s.downloads.popBuffered(tip + 1); b != nil {
+			if !s.connectBlock(b.from, b.block) {
+				return
+			}
+			continue
+		}
+
+		// 같은 부모를 가진 고아 블록이 여럿이면 처음 연결되는 하나만 사용 (나머지는 다른 갈래)
+		connected := false
+		for _, orphan := range s.orphans.takeChildren(tipHash) {
+			if !connected && s.connectBlock(orphan.from, orphan.block) {
+				connected = true
+			}
+		}
+		if !connected {
+			return
+		}
+	}
+}
+
+// 다운로드할 블록이 더 없으면 동기화 완료 처리
+func (s *Server) checkSyncComplete() {
+	d := s.downloads
+
+	d.lock.Lock()
+	_, missing, err := s.bc.MissingBlockHashes()
+	if err != nil {
+		d.lock.Unlock()
+		logChain.Error("Failed to read header chain", "err", err)
+		return
+	}
+	done := d.syncing && len(d.inFlight) == 0 && len(missing) == 0
+	if done {
+		d.syncing = false
+	}
+	d.lock.Unlock()
+
+	if !done {
+		return
+	}
+
+	// UTXO Set은 AddBlock이 블록과 같은 저장소 트랜잭션에서 갱신하므로 따로 Reindex 하지 않음
+	height, err := s.bc.GetBestHeight()
+	if err != nil {
+		logChain.Error("Failed to read chain tip", "err", err)
+		return
+	}
+	logP2P.Info("Block sync complete", "height", height)
+
+	// 동기화 중에는 멤풀 트랜잭션이 모르는 출력을 참조하므로 이제 요청함
+	for _, peer := range s.connectedPeers() {
+		s.requestMempool(peer)
+	}
+}
+
+// 피어의 연결이 끊기면 그 피어에 대한 블록/트랜잭션 요청을 다른 피어에게 넘기고,
+// 헤더 동기화가 끝나지 않았으면 앞서 있는 다른 피어로 이어감
+func (s *Server) onPeerDisconnected(p *Peer) {
+	if released := s.downloads.releasePeer(p); released > 0 {
+		logP2P.Info("Reassigning block requests from disconnected peer", "peer", p.String(), "count", released)
+	}
+	s.scheduleDownloads()
+
+	// 재구성 중이던 compact block은 버림 (다른 피어가 알려주면 헤더부터 받음)
+	s.compactBlocks.releasePeer(p)
+
+	for peer, txids := range s.txRequests.releasePeer(p, time.Now()) {
+		s.sendGetData(peer, "tx", txids...)
+	}
+
+	best, err := s.bc.BestHeader()
+	if err != nil {
+		logChain.Error("Failed to read header chain", "err", err)
+		return
+	}
+	for _, peer := range s.connectedPeers() {
+		if peer.BestHeight() > best.Height {
+			s.sendGetHeaders(peer)
+			return
+		}
+	}
+}
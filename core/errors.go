@@ -0,0 +1,103 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// 호출한 쪽에서 errors.Is로 원인을 구분할 수 있는 에러
+// (블록 관련 에러 ErrInvalidBlock, ErrBlockPruned는 chain.go)
+var (
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrTxNotFound         = errors.New("transaction not found") // 입력이 참조하는 트랜잭션(출력)을 찾을 수 없음
+	ErrInvalidSignature   = errors.New("invalid signature")
+	ErrInvalidTransaction = errors.New("invalid transaction") // 서명 외의 이유로 유효하지 않은 트랜잭션
+	ErrInvalidAddress     = errors.New("invalid address")
+	ErrWalletNotFound     = errors.New("wallet not found")
+	ErrInvalidRequest     = errors.New("invalid request") // 디코딩할 수 없거나 값이 잘못된 RPC 요청
+	ErrTxInMempool        = errors.New("transaction already in mempool")
+	ErrMempoolFull        = errors.New("mempool is full")
+	ErrUnauthorized       = errors.New("unauthorized") // RPC 사용자 이름이나 비밀번호가 틀림
+)
+
+// 잔액이 모자라 트랜잭션을 만들 수 없음 (errors.Is(err, ErrInsufficientFunds))
+type InsufficientFundsError struct {
+	Balance  int
+	Required int
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("%v: balance %d, required %d", ErrInsufficientFunds, e.Balance, e.Required)
+}
+
+func (e *InsufficientFundsError) Is(target error) bool {
+	return target == ErrInsufficientFunds
+}
+
+// RPC 응답의 에러 코드 (클라이언트가 메시지를 해석하지 않고 원인을 구분하도록)
+const (
+	rpcErrInsufficientFunds = "insufficient_funds"
+	rpcErrTxNotFound        = "tx_not_found"
+	rpcErrInvalidSignature  = "invalid_signature"
+	rpcErrInvalidTx         = "invalid_transaction"
+	rpcErrInvalidAddress    = "invalid_address"
+	rpcErrWalletNotFound    = "wallet_not_found"
+	rpcErrInvalidRequest    = "invalid_request"
+	rpcErrMempoolFull       = "mempool_full"
+	rpcErrUnauthorized      = "unauthorized"
+	rpcErrInternal          = "internal_error"
+	rpcErrUnavailable       = "rpc_unavailable" // 노드에 연결하지 못하거나 응답을 읽지 못함 (클라이언트에서만 사용)
+)
+
+// 에러를 실패한 RPC 응답으로 변환
+func rpcError(err error) RPCResponse {
+	code := rpcErrInternal
+	switch {
+	case errors.Is(err, ErrInsufficientFunds):
+		code = rpcErrInsufficientFunds
+	case errors.Is(err, ErrTxNotFound):
+		code = rpcErrTxNotFound
+	case errors.Is(err, ErrInvalidSignature):
+		code = rpcErrInvalidSignature
+	case errors.Is(err, ErrInvalidTransaction):
+		code = rpcErrInvalidTx
+	case errors.Is(err, ErrInvalidAddress):
+		code = rpcErrInvalidAddress
+	case errors.Is(err, ErrWalletNotFound):
+		code = rpcErrWalletNotFound
+	case errors.Is(err, ErrInvalidRequest):
+		code = rpcErrInvalidRequest
+	case errors.Is(err, ErrMempoolFull):
+		code = rpcErrMempoolFull
+	case errors.Is(err, ErrUnauthorized):
+		code = rpcErrUnauthorized
+	}
+	return RPCResponse{Success: false, Code: code, Message: err.Error()}
+}
+
+// 피어 메시지 처리 중 발생한 패닉을 복구하는 핸들러 래퍼
+// 노드는 계속 실행하고, 패닉을 일으킨 메시지를 보낸 피어는 점수를 매긴 뒤 연결을 끊음
+func (s *Server) recoverMessage(handle func(p *Peer, command string, payload []byte)) func(p *Peer, command string, payload []byte) {
+	return func(p *Peer, command string, payload []byte) {
+		defer func() {
+			if r := recover(); r != nil {
+				logP2P.Error("Panic while handling message", "command", command, "peer", p.String(), "panic", r, "stack", string(debug.Stack()))
+				s.misbehaving(p, scoreMalformed, fmt.Sprintf("%s message caused an internal error", command))
+				s.disconnectPeer(p, "internal error")
+			}
+		}()
+		handle(p, command, payload)
+	}
+}
+
+// RPC 명령 처리 중 발생한 패닉을 복구하여 실패 응답으로 바꿈
+func (s *Server) recoverRPC(command string, handle func() RPCResponse) (response RPCResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			logRPC.Error("Panic while handling request", "command", command, "panic", r, "stack", string(debug.Stack()))
+			response = RPCResponse{Success: false, Code: rpcErrInternal, Message: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+	return handle()
+}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"time"
+)
+
+// 프로토콜 버전
+// 2: version/verack 핸드셰이크
+// 3: getheaders/headers (headers-first 동기화, getblocks 제거)
+// 4: inv 기반 트랜잭션 전파 (여러 항목을 담는 getdata, notfound)
+// 5: cmpctblock/getblocktxn/blocktxn (compact block 전파)
+// 6: ping/pong (연결 상태 확인)
+// 7: mempool (연결 후 상대방 멤풀의 트랜잭션을 inv로 받아옴)
+const minProtocolVersion = 4
+
+// 이 버전 이상의 피어에게는 새 블록을 compact block으로 보냄
+const compactBlocksVersion = 5
+
+// 이 버전 이상의 피어에게는 주기적으로 ping을 보내고, 응답이 없으면 연결을 끊음
+const pingVersion = 6
+
+// 이 버전 이상이면서 ServiceMempool을 제공하는 피어에게 연결 후 'mempool'을 요청함
+const mempoolVersion = 7
+
+const userAgent = "/go-chain-study:0.7/"
+
+// 연결 후 이 시간 안에 핸드셰이크가 끝나지 않으면 연결 종료
+const handshakeTimeout = 10 * time.Second
+
+// 노드가 제공하는 서비스 (version 메시지의 Services 비트)
+const (
+	ServiceFullNode uint64 = 1 << iota // 모든 블록을 제공
+	ServicePruned                      // 최근 블록만 제공 (prune 노드)
+	ServiceTxRelay                     // 트랜잭션 전파
+	ServiceMempool                     // 'mempool' 요청에 응답
+)
+
+// 메시지 구조체 (간소화한 버전)
+type Version struct {
+	Version      int64  // 프로토콜 버전
+	Services     uint64 // 제공하는 서비스 비트
+	UserAgent    string // 노드 소프트웨어 이름/버전
+	Timestamp    int64  // 메시지를 보낸 시각 (unix)
+	Nonce        uint64 // 자기 자신과의 연결을 감지하기 위한 노드별 난수
+	BestHeight   int64  // 이 노드가 가진 블록의 최고 높이
+	AddrFrom     string // 이 메시지를 보낸 노드의 주소
+	PrunedHeight int64  // 블록 본문을 삭제한 최고 높이 (0이면 모든 블록을 제공할 수 있음)
+}
+
+// 노드별 난수 생성 (자기 연결 감지용)
+func newNodeNonce() uint64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		log.Panic(err)
+	}
+	return binary.BigEndian.Uint64(b[:])
+}
+
+// 이 노드가 제공하는 서비스 비트
+func (s *Server) services(prunedHeight int64) uint64 {
+	services := ServiceTxRelay
+	if s.serveMempool {
+		services |= ServiceMempool
+	}
+	if s.bc.IsPruneMode() || prunedHeight > 0 {
+		services |= ServicePruned
+	} else {
+		services |= ServiceFullNode
+	}
+	return services
+}
+
+// 'version' 메시지 전송
+// 체인을 읽지 못하면 보내지 않음 (핸드셰이크 시간이 지나면 연결이 끊김)
+func (s *Server) sendVersion(p *Peer) {
+	bestHeight, err := s.bc.GetBestHeight()
+	if err != nil {
+		logChain.Error("Failed to read chain tip", "err", err)
+		return
+	}
+	prunedHeight, err := s.bc.PrunedHeight()
+	if err != nil {
+		logChain.Error("Failed to read pruned height", "err", err)
+		return
+	}
+
+	ver := Version{
+		Version:      nodeVersion,
+		Services:     s.services(prunedHeight),
+		UserAgent:    userAgent,
+		Timestamp:    time.Now().Unix(),
+		Nonce:        s.nonce,
+		BestHeight:   bestHeight,
+		AddrFrom:     s.nodeAddress,
+		PrunedHeight: prunedHeight,
+	}
+	p.markVersionSent()
+	s.sendMessage(p, "version", ver)
+}
+
+// 'version' 메시지 처리
+// 호환되지 않는 피어는 다른 메시지를 처리하기 전에 연결을 끊음
+func (s *Server) handleVersion(p *Peer, payload []byte) {
+	var version Version
+
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&version); err != nil {
+		s.disconnectPeer(p, fmt.Sprintf("malformed version: %v", err))
+		return
+	}
+
+	if p.Version() != nil {
+		s.disconnectPeer(p, "duplicate version message")
+		return
+	}
+	if version.Nonce == s.nonce {
+		// 자기 자신을 가리키는 주소는 다시 연결하지 않도록 목록에서 제거
+		s.peerManager.Remove(p.addr)
+		s.disconnectPeer(p, "connected to self")
+		return
+	}
+	// 연결 주소는 연결을 받을 때 이미 확인했지만, 그 사이에 차단되었을 수 있으므로 다시 확인
+	// (스스로 알려준 listen 주소만 확인하면 차단된 호스트가 다른 주소를 사칭하여 다시 연결할 수 있음)
+	if s.banManager.IsBanned(p.addr) {
+		s.disconnectPeer(p, fmt.Sprintf("%s is banned", p.addr))
+		return
+	}
+	if s.banManager.IsBanned(version.AddrFrom) {
+		s.disconnectPeer(p, fmt.Sprintf("%s is banned", version.AddrFrom))
+		return
+	}
+	if version.Version < minProtocolVersion {
+		s.disconnectPeer(p, fmt.Sprintf("incompatible protocol version %d (minimum %d)", version.Version, minProtocolVersion))
+		return
+	}
+
+	logP2P.Debug("Received version", "peer", p.String(), "addr_from", version.AddrFrom, "height", version.BestHeight,
+		"version", version.Version, "user_agent", version.UserAgent, "services", fmt.Sprintf("%b", version.Services))
+
+	p.setVersion(&version)
+	p.updateBestHeight(version.BestHeight)
+	p.setListenAddr(version.AddrFrom)
+
+	// 상대방이 연결해 온 경우 아직 version을 보내지 않았으므로 먼저 보냄
+	if !p.versionWasSent() {
+		s.sendVersion(p)
+	}
+	s.sendMessage(p, "verack", struct{}{})
+
+	if p.handshakeDone() {
+		s.onHandshakeComplete(p)
+	}
+}
+
+// 'verack' 메시지 처리
+func (s *Server) handleVerack(p *Peer) {
+	if !p.versionWasSent() || p.verackWasReceived() {
+		s.disconnectPeer(p, "unexpected verack")
+		return
+	}
+
+	p.markVerackReceived()
+
+	if p.handshakeDone() {
+		s.onHandshakeComplete(p)
+	}
+}
+
+// 핸드셰이크가 끝난 뒤 블록 동기화 시작
+func (s *Server) onHandshakeComplete(p *Peer) {
+	version := p.Version()
+	logP2P.Info("Handshake complete", "peer", p.String())
+
+	if p.inbound {
+		// 연결해 온 피어의 P2P 주소를 피어 목록에 추가
+		s.peerManager.AddAddress(version.AddrFrom, "", time.Now())
+	} else {
+		// 직접 연결한 주소는 살아있음이 확인되었으므로 다른 주소도 물어봄
+		// (-connect 모드에서는 지정한 피어에만 연결하므로 주소가 필요 없음)
+		s.peerManager.MarkGood(p.addr)
+		if len(s.connectOnly) == 0 {
+			s.sendGetAddr(p)
+		}
+	}
+
+	// 상대방보다 뒤처져 있지 않으면 바로 멤풀을 받아옴 (뒤처져 있으면 동기화를 마친 뒤 요청)
+	s.requestMempool(p)
+
+	// 상대방이 우리 헤더 체인보다 앞서 있으면 헤더부터 받아오기
+	// 헤더가 이미 있으면 (재시작 등으로 중단된 경우) 본문 다운로드를 이어서 함
+	// (상대방의 bestHeight가 더 낮으면, 상대방이 우리 version을 보고 동기화를 요청함)
+	best, err := s.bc.BestHeader()
+	if err != nil {
+		logChain.Error("Failed to read header chain", "err", err)
+		return
+	}
+	if best.Height < version.BestHeight {
+		s.sendGetHeaders(p)
+	} else {
+		s.scheduleDownloads()
+	}
+}
+
+// 연결 후 handshakeTimeout 안에 핸드셰이크가 끝나지 않으면 연결 종료
+func (s *Server) watchHandshake(p *Peer) {
+	time.AfterFunc(handshakeTimeout, func() {
+		if !p.handshakeDone() {
+			s.disconnectPeer(p, "handshake timeout")
+		}
+	})
+}
+
+func (s *Server) disconnectPeer(p *Peer, reason string) {
+	logP2P.Info("Disconnecting peer", "peer", p.String(), "reason", reason)
+	p.close()
+}
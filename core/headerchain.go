@@ -0,0 +1,513 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// headers-first 동기화 중 본문을 아직 받지 못한 블록의 헤더
+// 메인 체인(본문이 있는 블록)의 헤더는 headersIndex에, 그 밖의 헤더는 아래 인덱스에 보관
+// syncHeightsIndex에는 작업량이 가장 많은 갈래(헤더 체인)에서 메인 체인과 갈라진 뒤의 헤더만 높이별로 기록하고,
+// 다른 갈래의 헤더는 나중에 더 무거워질 수 있으므로 syncHeadersIndex에만 남겨둠
+// 재시작해도 유지되므로, 이미 받은 헤더를 다시 받지 않고 본문 다운로드를 이어서 할 수 있음
+const (
+	syncHeadersIndex = "syncheaders" // key: 블록 해시, value: 직렬화된 BlockHeader
+	syncHeightsIndex = "syncheights" // key: 높이(big endian), value: 블록 해시
+)
+
+// 검증에 실패한 블록과 그 자손의 해시 (key: 블록 해시, value: 1)
+// 이 블록들의 헤더는 다시 받아도 헤더 체인에 넣지 않음
+const invalidHeadersIndex = "invalidheaders"
+
+// 헤더 체인의 마지막 헤더 해시 (metadata)
+const bestHeaderKey = "bestheader"
+
+// 'headers' 메시지 하나에 담을 수 있는 최대 헤더 수
+const maxHeadersPerMsg = 2000
+
+// 헤더가 우리 헤더 체인에 이어지지 않음 (다른 체인의 헤더)
+var ErrHeadersNotConnected = errors.New("headers do not connect to the header chain")
+
+// 헤더가 검증에 실패한 블록이거나 그 자손임
+// 헤더만 전달한 피어는 본문을 검증하지 않았을 수 있으므로 피어의 잘못으로 보지 않음
+var ErrInvalidHeaderChain = errors.New("headers descend from an invalid block")
+
+// 메인 체인의 tip 높이
+func tipHeight(tx StorageTx) (int64, error) {
+	tip := tx.GetTip()
+	if tip == nil {
+		return 0, nil
+	}
+	headerData := tx.GetIndex(headersIndex, tip)
+	if headerData == nil {
+		return 0, nil
+	}
+	header, err := DeserializeBlockHeader(headerData)
+	if err != nil {
+		return 0, err
+	}
+	return header.Height, nil
+}
+
+// 헤더 체인에서 해당 높이의 블록 해시 (갈림 지점 이하는 메인 체인에서 찾음)
+func headerHashAt(tx StorageTx, height int64) []byte {
+	if hash := tx.GetIndex(syncHeightsIndex, heightKey(height)); hash != nil {
+		return hash
+	}
+	return tx.GetIndex(heightsIndex, heightKey(height))
+}
+
+// 헤더 체인이 메인 체인과 갈라지는 높이 (헤더 체인이 메인 체인에 이어지면 tip 높이)
+// 이 높이 위의 블록은 본문을 받아 연결해야 하고, tip이 더 높으면 그 사이의 메인 체인 블록은 reorg로 끊어야 함
+func forkHeight(tx StorageTx) (int64, error) {
+	height, err := tipHeight(tx)
+	if err != nil {
+		return 0, err
+	}
+	for height > 0 && tx.GetIndex(syncHeightsIndex, heightKey(height)) != nil {
+		height--
+	}
+	return height, nil
+}
+
+// 메인 체인 또는 동기화 중인 헤더에서 헤더를 찾음 (없으면 nil)
+func getAnyHeader(tx StorageTx, hash []byte) (*BlockHeader, error) {
+	if headerData := tx.GetIndex(headersIndex, hash); headerData != nil {
+		return DeserializeBlockHeader(headerData)
+	}
+	if headerData := tx.GetIndex(syncHeadersIndex, hash); headerData != nil {
+		return DeserializeBlockHeader(headerData)
+	}
+	return nil, nil
+}
+
+// 헤더 체인의 마지막 헤더 (동기화 중인 헤더가 없으면 메인 체인의 tip)
+func bestHeader(tx StorageTx) (*BlockHeader, error) {
+	tip, err := tipHeight(tx)
+	if err != nil {
+		return nil, err
+	}
+	if hash := tx.GetMeta(bestHeaderKey); hash != nil {
+		header, err := getAnyHeader(tx, hash)
+		if err != nil {
+			return nil, err
+		}
+		if header != nil && header.Height > tip {
+			return header, nil
+		}
+	}
+	return getAnyHeader(tx, tx.GetTip())
+}
+
+// 메인 체인 또는 동기화 중인 헤더에 있는 블록인지 확인
+func (bc *Blockchain) HasHeader(hash []byte) bool {
+	found := false
+	bc.store.View(func(tx StorageTx) error {
+		found = tx.GetIndex(headersIndex, hash) != nil || tx.GetIndex(syncHeadersIndex, hash) != nil
+		return nil
+	})
+	return found
+}
+
+// 메인 체인에 추가된 블록인지 확인 (본문이 prune된 블록 포함)
+func (bc *Blockchain) InMainChain(hash []byte) bool {
+	found := false
+	bc.store.View(func(tx StorageTx) error {
+		found = tx.GetIndex(headersIndex, hash) != nil
+		return nil
+	})
+	return found
+}
+
+// 헤더 체인이 메인 체인과 갈라지는 높이
+func (bc *Blockchain) ForkHeight() (int64, error) {
+	var height int64
+	err := bc.store.View(func(tx StorageTx) error {
+		var err error
+		height, err = forkHeight(tx)
+		return err
+	})
+	return height, err
+}
+
+// 헤더 체인에서 본문을 기다리는 블록인지 확인 (다운로드 스케줄러가 요청한 블록)
+func (bc *Blockchain) IsPendingBlock(hash []byte, height int64) bool {
+	found := false
+	bc.store.View(func(tx StorageTx) error {
+		found = bytes.Equal(tx.GetIndex(syncHeightsIndex, heightKey(height)), hash)
+		return nil
+	})
+	return found
+}
+
+// 헤더 체인의 마지막 헤더
+func (bc *Blockchain) BestHeader() (*BlockHeader, error) {
+	var header *BlockHeader
+	err := bc.store.View(func(tx StorageTx) error {
+		var err error
+		header, err = bestHeader(tx)
+		return err
+	})
+	return header, err
+}
+
+// 블록 로케이터 생성
+// 헤더 체인의 끝에서부터 최근 10개는 하나씩, 그 뒤로는 간격을 두 배씩 늘려가며 해시를 고르고 제네시스로 끝남
+// 상대방은 로케이터에서 자신이 아는 첫 번째 해시를 기준으로 그 다음 헤더들을 보내줌
+func (bc *Blockchain) BlockLocator() ([][]byte, error) {
+	var locator [][]byte
+
+	err := bc.store.View(func(tx StorageTx) error {
+		best, err := bestHeader(tx)
+		if err != nil || best == nil {
+			return err
+		}
+
+		step := int64(1)
+		for height := best.Height; height > 1; height -= step {
+			if hash := headerHashAt(tx, height); hash != nil {
+				locator = append(locator, hash)
+			}
+			if len(locator) >= 10 {
+				step *= 2
+			}
+		}
+		if genesis := tx.GetIndex(heightsIndex, heightKey(1)); genesis != nil {
+			locator = append(locator, genesis)
+		}
+		return nil
+	})
+
+	return locator, err
+}
+
+// 로케이터에서 메인 체인에 있는 첫 번째 해시를 찾아, 그 다음 헤더들을 최대 max개 반환
+// hashStop을 만나면 거기까지만 반환. 아는 해시가 없으면 제네시스 다음부터 반환
+func (bc *Blockchain) HeadersAfter(locator [][]byte, hashStop []byte, max int) ([]*BlockHeader, error) {
+	var headers []*BlockHeader
+
+	err := bc.store.View(func(tx StorageTx) error {
+		start := int64(1)
+		for _, hash := range locator {
+			if headerData := tx.GetIndex(headersIndex, hash); headerData != nil {
+				header, err := DeserializeBlockHeader(headerData)
+				if err != nil {
+					return err
+				}
+				start = header.Height
+				break
+			}
+		}
+
+		tip, err := tipHeight(tx)
+		if err != nil {
+			return err
+		}
+		for height := start + 1; height <= tip && len(headers) < max; height++ {
+			hash := tx.GetIndex(heightsIndex, heightKey(height))
+			if hash == nil {
+				break
+			}
+			header, err := DeserializeBlockHeader(tx.GetIndex(headersIndex, hash))
+			if err != nil {
+				return err
+			}
+			headers = append(headers, header)
+			if hashStop != nil && bytes.Equal(hash, hashStop) {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return headers, nil
+}
+
+// 받은 헤더들을 검증하여 저장하고, 새로 저장한 헤더 수를 반환
+//   - 헤더는 순서대로 이어져야 하고, 첫 헤더의 이전 블록은 이미 알고 있어야 함 (어느 갈래든 상관없음)
+//   - 모든 헤더의 PoW를 검증하고, 하나라도 틀리면 아무것도 추가하지 않음 (ErrInvalidBlock)
+//   - 마지막 헤더까지의 작업량이 헤더 체인보다 많으면 그 갈래를 헤더 체인으로 삼음
+//     (메인 체인과 다른 갈래라면 본문을 받은 뒤 reorg 함. 작업량이 같으면 먼저 받은 갈래를 유지)
+func (bc *Blockchain) AddHeaders(headers []*BlockHeader) (int, error) {
+	if len(headers) == 0 {
+		return 0, nil
+	}
+
+	// 저장소를 건드리기 전에 헤더들끼리 이어지는지와 PoW를 먼저 확인
+	for i, header := range headers {
+		if !header.ValidatePoW() {
+			return 0, fmt.Errorf("%w: invalid PoW in header %x", ErrInvalidBlock, header.Hash)
+		}
+		if i > 0 {
+			prev := headers[i-1]
+			if !bytes.Equal(header.PrevBlockHash, prev.Hash) || header.Height != prev.Height+1 {
+				return 0, fmt.Errorf("%w: header %x does not follow %x", ErrInvalidBlock, header.Hash, prev.Hash)
+			}
+		}
+	}
+
+	added := 0
+	err := bc.store.Update(func(tx StorageTx) error {
+		first := headers[0]
+		if tx.GetIndex(invalidHeadersIndex, first.PrevBlockHash) != nil {
+			return fmt.Errorf("%w: parent %x of header %x", ErrInvalidHeaderChain, first.PrevBlockHash, first.Hash)
+		}
+		for _, header := range headers {
+			if tx.GetIndex(invalidHeadersIndex, header.Hash) != nil {
+				return fmt.Errorf("%w: header %x", ErrInvalidHeaderChain, header.Hash)
+			}
+		}
+		prev, err := getAnyHeader(tx, first.PrevBlockHash)
+		if err != nil {
+			return err
+		}
+		if prev == nil || first.Height != prev.Height+1 {
+			return fmt.Errorf("%w: unknown parent %x of header %x", ErrHeadersNotConnected, first.PrevBlockHash, first.Hash)
+		}
+
+		// 이미 가진 헤더는 건너뜀
+		for _, header := range headers {
+			known, err := getAnyHeader(tx, header.Hash)
+			if err != nil {
+				return err
+			}
+			if known != nil {
+				continue
+			}
+			if err := tx.PutIndex(syncHeadersIndex, header.Hash, header.Serialize()); err != nil {
+				return err
+			}
+			added++
+		}
+
+		last := headers[len(headers)-1]
+		best, err := bestHeader(tx)
+		if err != nil {
+			return err
+		}
+		if best != nil && !heavierThan(last, best) {
+			return nil
+		}
+		return setBestHeader(tx, last)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
+
+// last로 끝나는 갈래를 헤더 체인으로 삼음
+// last에서 메인 체인(또는 이미 헤더 체인에 있는 헤더)을 만날 때까지 내려가며 높이를 기록하고, 기존 갈래의 기록은 지움
+// 갈림 지점의 블록 본문이 prune되었으면 reorg 할 수 없으므로 헤더만 남겨두고 바꾸지 않음
+func setBestHeader(tx StorageTx, last *BlockHeader) error {
+	var branch []*BlockHeader
+	shared := false
+	header := last
+	for tx.GetIndex(headersIndex, header.Hash) == nil {
+		if bytes.Equal(tx.GetIndex(syncHeightsIndex, heightKey(header.Height)), header.Hash) {
+			shared = true
+			break
+		}
+		branch = append(branch, header)
+		var err error
+		if header, err = getAnyHeader(tx, header.PrevBlockHash); err != nil {
+			return err
+		}
+		if header == nil {
+			return fmt.Errorf("%w: missing ancestor of header %x", ErrHeadersNotConnected, last.Hash)
+		}
+	}
+
+	// 메인 체인과 새로 갈라지는 경우, 갈림 지점(header) 이하에 남은 기존 갈래의 기록을 지움
+	if !shared {
+		if prunedHeight := readPrunedHeight(tx); header.Height < prunedHeight {
+			logChain.Warn("Ignoring heavier header branch forking below pruned height",
+				hexAttr("hash", last.Hash), "height", last.Height, "fork_height", header.Height, "pruned_height", prunedHeight)
+			return nil
+		}
+		for height := header.Height; height > 0; height-- {
+			key := heightKey(height)
+			if tx.GetIndex(syncHeightsIndex, key) == nil {
+				break
+			}
+			if err := tx.DeleteIndex(syncHeightsIndex, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, h := range branch {
+		if err := tx.PutIndex(syncHeightsIndex, heightKey(h.Height), h.Hash); err != nil {
+			return err
+		}
+	}
+	for height := last.Height + 1; tx.GetIndex(syncHeightsIndex, heightKey(height)) != nil; height++ {
+		if err := tx.DeleteIndex(syncHeightsIndex, heightKey(height)); err != nil {
+			return err
+		}
+	}
+	return tx.PutMeta(bestHeaderKey, last.Hash)
+}
+
+// 헤더는 받았지만 본문이 없는 헤더 체인의 블록 해시 (갈림 지점 다음부터 높이 순)
+// 첫 블록의 높이도 함께 반환
+func (bc *Blockchain) MissingBlockHashes() (int64, [][]byte, error) {
+	var start int64
+	var hashes [][]byte
+
+	err := bc.store.View(func(tx StorageTx) error {
+		fork, err := forkHeight(tx)
+		if err != nil {
+			return err
+		}
+		start = fork + 1
+		best, err := bestHeader(tx)
+		if err != nil || best == nil {
+			return err
+		}
+		for height := start; height <= best.Height; height++ {
+			hash := tx.GetIndex(syncHeightsIndex, heightKey(height))
+			if hash == nil {
+				break
+			}
+			hashes = append(hashes, hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return start, hashes, nil
+}
+
+// 메인 체인에 추가된 블록의 동기화용 헤더를 정리 (AddBlock이 headersIndex에 헤더를 기록하므로)
+// 헤더 체인의 블록이면 그 높이의 기록만 지우고, 다른 블록이면 (직접 채굴한 경우 등)
+// 헤더 체인이 새 tip보다 무겁지 않을 때만 헤더 체인의 기록을 모두 지움 (더 무거운 갈래는 계속 받아서 reorg)
+func removeSyncHeader(tx StorageTx, block *Block) error {
+	if err := tx.DeleteIndex(syncHeadersIndex, block.Hash); err != nil {
+		return err
+	}
+
+	key := heightKey(block.Height)
+	if bytes.Equal(tx.GetIndex(syncHeightsIndex, key), block.Hash) {
+		return tx.DeleteIndex(syncHeightsIndex, key)
+	}
+
+	best := block.Height
+	if hash := tx.GetMeta(bestHeaderKey); hash != nil {
+		header, err := getAnyHeader(tx, hash)
+		if err != nil {
+			return err
+		}
+		if header != nil {
+			if heavierThan(header, block.Header()) {
+				return nil
+			}
+			best = max(best, header.Height)
+		}
+	}
+
+	for height := best; height > 0; height-- {
+		key := heightKey(height)
+		if tx.GetIndex(syncHeightsIndex, key) == nil {
+			break
+		}
+		if err := tx.DeleteIndex(syncHeightsIndex, key); err != nil {
+			return err
+		}
+	}
+	return tx.PutMeta(bestHeaderKey, block.Hash)
+}
+
+// 검증에 실패한 블록을 기록 (AddBlock과 Reorganize가 ErrInvalidBlock으로 실패하면 호출)
+// 본문이 해시와 맞지 않는 블록(PoW 실패)은 같은 해시의 올바른 본문이 있을 수 있으므로 기록하지 않음
+func (bc *Blockchain) invalidateBlock(block *Block) {
+	if !NewProofOfWork(block).Validate() {
+		return
+	}
+	err := bc.store.Update(func(tx StorageTx) error {
+		return markInvalidHeader(tx, block.Hash)
+	})
+	if err != nil {
+		logChain.Error("Failed to mark block invalid", hexAttr("hash", block.Hash), "err", err)
+		return
+	}
+	logChain.Warn("Marked block invalid", hexAttr("hash", block.Hash), "height", block.Height)
+}
+
+// 블록과 이미 받은 그 자손의 헤더를 무효로 기록하고 동기화 헤더에서 지운 뒤,
+// 남은 헤더 중 가장 무거운 갈래(없으면 메인 체인)를 헤더 체인으로 다시 고름
+// (지우지 않으면 헤더 체인이 무효한 갈래에 머물러, 그 본문을 계속 요청하고 보낸 피어를 차단하게 됨)
+func markInvalidHeader(tx StorageTx, hash []byte) error {
+	if err := tx.PutIndex(invalidHeadersIndex, hash, []byte{1}); err != nil {
+		return err
+	}
+
+	headers := make(map[string]*BlockHeader)
+	err := tx.ForEachIndex(syncHeadersIndex, func(_, value []byte) error {
+		header, err := DeserializeBlockHeader(value)
+		if err != nil {
+			return err
+		}
+		headers[string(header.Hash)] = header
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 동기화 헤더를 부모 쪽으로 따라가며 무효한 블록을 만나는지 확인 (결과는 memo에 기록)
+	memo := make(map[string]bool)
+	var invalid func(header *BlockHeader) bool
+	invalid = func(header *BlockHeader) bool {
+		key := string(header.Hash)
+		if result, ok := memo[key]; ok {
+			return result
+		}
+		result := tx.GetIndex(invalidHeadersIndex, header.Hash) != nil
+		if !result {
+			if parent, ok := headers[string(header.PrevBlockHash)]; ok {
+				result = invalid(parent)
+			} else {
+				result = tx.GetIndex(invalidHeadersIndex, header.PrevBlockHash) != nil
+			}
+		}
+		memo[key] = result
+		return result
+	}
+
+	best, err := getAnyHeader(tx, tx.GetTip())
+	if err != nil {
+		return err
+	}
+	tip := best
+	for key, header := range headers {
+		if !invalid(header) {
+			if heavierThan(header, best) {
+				best = header
+			}
+			continue
+		}
+		if err := tx.PutIndex(invalidHeadersIndex, header.Hash, []byte{1}); err != nil {
+			return err
+		}
+		if err := tx.DeleteIndex(syncHeadersIndex, []byte(key)); err != nil {
+			return err
+		}
+	}
+
+	// 기존 갈래의 기록을 모두 지운 뒤 새 갈래를 기록
+	if err := setBestHeader(tx, tip); err != nil {
+		return err
+	}
+	if best == tip {
+		return nil
+	}
+	return setBestHeader(tx, best)
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+)
+
+// 블록 로케이터에 담을 수 있는 최대 해시 수
+const maxLocatorSize = 101
+
+type GetHeaders struct {
+	Locator  [][]byte // 요청하는 쪽 헤더 체인의 블록 로케이터
+	HashStop []byte   // 이 해시까지만 요청 (nil이면 maxHeadersPerMsg개까지)
+}
+
+type HeadersMsg struct {
+	Headers [][]byte // 직렬화된 BlockHeader (높이 순)
+}
+
+// 'getheaders' 메시지 전송
+func (s *Server) sendGetHeaders(p *Peer) {
+	locator, err := s.bc.BlockLocator()
+	if err != nil {
+		logChain.Error("Failed to build block locator", "err", err)
+		return
+	}
+	s.sendMessage(p, "getheaders", GetHeaders{Locator: locator})
+}
+
+// 'getheaders' 메시지 처리
+// 로케이터에서 우리가 아는 첫 블록 다음부터 메인 체인의 헤더를 보냄
+// (prune된 블록도 헤더는 남아있으므로 보낼 수 있음)
+func (s *Server) handleGetHeaders(p *Peer, payload []byte) {
+	var req GetHeaders
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&req); err != nil {
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed getheaders: %v", err))
+		return
+	}
+	if len(req.Locator) > maxLocatorSize {
+		s.misbehaving(p, scoreOversized, fmt.Sprintf("getheaders with %d locator hashes (maximum %d)", len(req.Locator), maxLocatorSize))
+		return
+	}
+
+	headers, err := s.bc.HeadersAfter(req.Locator, req.HashStop, maxHeadersPerMsg)
+	if err != nil {
+		logChain.Error("Failed to read headers", "err", err)
+		return
+	}
+
+	msg := HeadersMsg{Headers: make([][]byte, 0, len(headers))}
+	for _, header := range headers {
+		msg.Headers = append(msg.Headers, header.Serialize())
+	}
+	s.sendMessage(p, "headers", msg)
+}
+
+// 'headers' 메시지 처리
+// 헤더 체인의 PoW를 검증하여 저장하고, 헤더를 모두 받으면 블록 본문을 요청
+func (s *Server) handleHeaders(p *Peer, payload []byte) {
+	var msg HeadersMsg
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&msg); err != nil {
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed headers: %v", err))
+		return
+	}
+	if len(msg.Headers) > maxHeadersPerMsg {
+		s.misbehaving(p, scoreOversized, fmt.Sprintf("headers message with %d headers (maximum %d)", len(msg.Headers), maxHeadersPerMsg))
+		return
+	}
+
+	headers := make([]*BlockHeader, 0, len(msg.Headers))
+	for _, data := range msg.Headers {
+		header, err := DeserializeBlockHeader(data)
+		if err != nil {
+			s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed header: %v", err))
+			return
+		}
+		headers = append(headers, header)
+	}
+
+	added, err := s.bc.AddHeaders(headers)
+	if errors.Is(err, ErrInvalidBlock) {
+		s.misbehaving(p, scoreInvalid, err.Error())
+		return
+	}
+	if err != nil {
+		// 우리가 모르는 블록에서 갈라졌거나 무효한 블록에 이어진 헤더 (피어는 본문을 검증하지 않았을 수 있으므로 피어의 잘못으로 보지 않음)
+		logP2P.Info("Ignoring headers", "peer", p.String(), "err", err)
+		return
+	}
+
+	if len(headers) > 0 {
+		p.updateBestHeight(headers[len(headers)-1].Height)
+	}
+	if best, err := s.bc.BestHeader(); err == nil && best != nil {
+		logP2P.Debug("Received headers", "peer", p.String(), "count", len(headers), "new", added, "best_header", best.Height)
+	}
+
+	// 꽉 찬 메시지를 받았으면 헤더가 더 남아있음
+	if len(headers) == maxHeadersPerMsg {
+		s.sendGetHeaders(p)
+		return
+	}
+
+	s.scheduleDownloads()
+}
@@ -0,0 +1,238 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Accept가 실패했을 때 다시 시도하기까지 기다리는 시간
+const acceptRetryDelay = 100 * time.Millisecond
+
+var errServerStopping = errors.New("server is shutting down")
+
+// 리스너를 열고 백그라운드 작업을 시작한 뒤 바로 반환
+// ctx가 취소되거나 Stop이 호출되면 종료하고, Wait로 종료가 끝날 때까지 기다릴 수 있음
+func (s *Server) Start(ctx context.Context) error {
+	if !s.started.CompareAndSwap(false, true) {
+		return errors.New("server already started")
+	}
+	logP2P.Info("Starting server", "addr", s.nodeAddress, "rpc", net.JoinHostPort(s.rpcBind, s.rpcPort))
+
+	ln, err := s.transport.Listen(s.nodeAddress)
+	if err != nil {
+		return err
+	}
+	s.p2pListener = ln
+
+	if s.rpcEnabled {
+		rpcLn, err := net.Listen(protocol, net.JoinHostPort(s.rpcBind, s.rpcPort))
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		s.rpcListener = rpcLn
+		if s.rpcUser == "" && !isLoopbackHost(s.rpcBind) {
+			logRPC.Warn("RPC is reachable from other hosts without a user and password", "bind", s.rpcBind)
+		}
+		s.spawn(&s.rpcWG, s.acceptRPC)
+	}
+
+	s.spawn(&s.p2pWG, s.acceptP2P)
+	s.spawn(&s.p2pWG, s.downloadLoop)
+	s.spawn(&s.p2pWG, s.txRelayLoop)
+	s.spawn(&s.p2pWG, s.pingLoop)
+	// 피어 목록의 노드들에 연결하고, 연결 수를 유지
+	s.spawn(&s.p2pWG, s.maintainPeers)
+
+	// 채굴자일 경우, 채굴 루프 시작
+	if s.miningAddress != "" {
+		logMiner.Info("Mining is enabled", "reward_to", s.miningAddress)
+		s.spawn(&s.minerWG, s.startMining)
+	}
+
+	// 호출한 쪽의 ctx가 취소되면 종료 (Stop이 먼저 호출되면 s.ctx가 취소되어 끝남)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Stop()
+		case <-s.ctx.Done():
+		}
+	}()
+	return nil
+}
+
+// 서버를 순서대로 종료하고 끝날 때까지 기다림. 여러 번 호출해도 한 번만 종료함
+// 채굴 → RPC → P2P (리스너, 피어, 백그라운드 루프) → 피어 목록/차단 목록/멤풀 저장 → 저장소 닫기
+func (s *Server) Stop() error {
+	s.stopOnce.Do(func() {
+		logP2P.Info("Shutting down server")
+		s.cancel()
+
+		// 채굴 중인 블록은 마저 추가하고 멈춤
+		s.minerWG.Wait()
+
+		// 새 RPC 요청을 받지 않고, 처리 중인 요청이 끝날 때까지 기다림
+		if s.rpcListener != nil {
+			s.rpcListener.Close()
+		}
+		s.rpcWG.Wait()
+
+		// 새 연결을 받지 않고 모든 피어의 연결을 끊음
+		// 피어가 처리 중이던 메시지(블록 추가 등)는 마저 처리한 뒤 끝남
+		if s.p2pListener != nil {
+			s.p2pListener.Close()
+		}
+		s.peersLock.RLock()
+		peers := make([]*Peer, 0, len(s.peers))
+		for _, peer := range s.peers {
+			peers = append(peers, peer)
+		}
+		s.peersLock.RUnlock()
+		for _, peer := range peers {
+			s.disconnectPeer(peer, "shutting down")
+		}
+		s.p2pWG.Wait()
+		for _, peer := range peers {
+			peer.wait()
+		}
+
+		s.stopErr = errors.Join(s.flush(), s.bc.Close())
+		if s.stopErr != nil {
+			logP2P.Error("Server stopped with errors", "err", s.stopErr)
+		} else {
+			logP2P.Info("Server stopped")
+		}
+		close(s.stopped)
+	})
+	return s.stopErr
+}
+
+// 종료가 끝날 때까지 기다리고 종료 중에 발생한 에러를 반환
+func (s *Server) Wait() error {
+	<-s.stopped
+	return s.stopErr
+}
+
+// 메모리에만 있는 상태를 데이터 디렉토리에 저장
+func (s *Server) flush() error {
+	var errs []error
+	if err := s.peerManager.Save(); err != nil {
+		errs = append(errs, fmt.Errorf("saving peers: %w", err))
+	}
+	if err := s.banManager.Save(); err != nil {
+		errs = append(errs, fmt.Errorf("saving ban list: %w", err))
+	}
+	if err := s.mempool.SaveToFile(s.dataDir.MempoolFile()); err != nil {
+		errs = append(errs, fmt.Errorf("saving mempool: %w", err))
+	} else {
+		logMempool.Info("Saved mempool transactions", "count", len(s.mempool.GetTxs()))
+	}
+	return errors.Join(errs...)
+}
+
+// 종료할 때 저장한 멤풀을 다시 불러옴
+// 그 사이 사용된 출력을 참조하거나 검증에 실패하는 트랜잭션은 버림
+func (s *Server) loadMempool() {
+	txs, err := LoadMempoolFile(s.dataDir.MempoolFile())
+	if err != nil {
+		logMempool.Warn("Failed to load mempool", "err", err)
+		return
+	}
+
+	utxoSet := UTXOSet{s.bc}
+	loaded := 0
+	for _, tx := range txs {
+		if !s.spendsUnspentOutputs(utxoSet, tx) || s.bc.VerifyTransaction(tx) != nil {
+			continue
+		}
+		if s.mempool.Add(tx) == nil {
+			loaded++
+		}
+	}
+	if len(txs) > 0 {
+		logMempool.Info("Loaded saved mempool transactions", "loaded", loaded, "saved", len(txs))
+	}
+}
+
+// 트랜잭션의 입력이 모두 UTXO Set에 남아있는 출력을 참조하는지 확인
+func (s *Server) spendsUnspentOutputs(utxoSet UTXOSet, tx *Transaction) bool {
+	if tx.IsCoinbase() {
+		return false
+	}
+	for _, vin := range tx.Vin {
+		prev, err := utxoSet.FindTransaction(vin.Txid)
+		if err != nil || vin.Vout < 0 || vin.Vout >= len(prev.VOut) || prev.VOut[vin.Vout].PubKeyHash == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// wg에 등록하고 fn을 고루틴으로 실행 (Stop이 끝날 때까지 기다림)
+func (s *Server) spawn(wg *sync.WaitGroup, fn func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		fn()
+	}()
+}
+
+// d만큼 기다림. 그 사이 서버가 종료되기 시작하면 false
+func (s *Server) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// P2P 연결을 받아 처리. 리스너가 닫히면 끝남
+func (s *Server) acceptP2P() {
+	for {
+		conn, err := s.p2pListener.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+			logP2P.Warn("Accept error", "err", err)
+			if !s.sleep(acceptRetryDelay) {
+				return
+			}
+			continue
+		}
+		s.spawn(&s.p2pWG, func() { s.handleP2PConnection(conn) })
+	}
+}
+
+// RPC 연결을 받아 처리. 리스너가 닫히면 끝남
+func (s *Server) acceptRPC() {
+	for {
+		conn, err := s.rpcListener.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+			logRPC.Warn("Accept error", "err", err)
+			if !s.sleep(acceptRetryDelay) {
+				return
+			}
+			continue
+		}
+		s.spawn(&s.rpcWG, func() { s.handleRPCConnection(conn) })
+	}
+}
+
+// 'stop' RPC. 응답을 보낸 뒤 종료를 시작
+// (Stop은 처리 중인 RPC 요청이 끝나기를 기다리므로 별도 고루틴에서 호출)
+func (s *Server) rpcStop() RPCResponse {
+	go s.Stop()
+	return RPCResponse{Success: true, Message: fmt.Sprintf("Node %s is shutting down", s.nodeAddress)}
+}
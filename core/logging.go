@@ -0,0 +1,317 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 로그 서브시스템. 서브시스템마다 로그 레벨을 따로 정할 수 있음
+const (
+	subsysP2P      = "p2p"      // 피어 연결, 메시지, 동기화
+	subsysRPC      = "rpc"      // RPC 요청
+	subsysChain    = "chain"    // 블록 추가, 저장소, prune, 마이그레이션
+	subsysMempool  = "mempool"  // 트랜잭션 수신, 전파, 멤풀 저장
+	subsysMiner    = "miner"    // 채굴
+	subsysWallet   = "wallet"   // 지갑, 트랜잭션 생성
+	subsysScenario = "scenario" // 시나리오 실행 단계
+)
+
+var logSubsystems = []string{subsysP2P, subsysRPC, subsysChain, subsysMempool, subsysMiner, subsysWallet, subsysScenario}
+
+// 로그 파일
+const (
+	logFileName     = "node.log"
+	logFileMaxSize  = 10 * 1024 * 1024 // 이 크기를 넘으면 node.log.1로 옮기고 새 파일에 기록
+	logFileMaxFiles = 5                // 보관하는 이전 로그 파일 수 (node.log.1 ~ node.log.5)
+)
+
+// 서브시스템별 로그 레벨 (기본 info, 실행 중에 바꿀 수 있음)
+var logLevels = func() map[string]*slog.LevelVar {
+	levels := make(map[string]*slog.LevelVar)
+	for _, subsys := range logSubsystems {
+		levels[subsys] = new(slog.LevelVar)
+	}
+	return levels
+}()
+
+// 서브시스템별 로거
+var (
+	logP2P      = newSubsystemLogger(subsysP2P)
+	logRPC      = newSubsystemLogger(subsysRPC)
+	logChain    = newSubsystemLogger(subsysChain)
+	logMempool  = newSubsystemLogger(subsysMempool)
+	logMiner    = newSubsystemLogger(subsysMiner)
+	logWallet   = newSubsystemLogger(subsysWallet)
+	logScenario = newSubsystemLogger(subsysScenario)
+)
+
+// 모든 서브시스템이 공유하는 출력 핸들러 (ConfigureLogging으로 교체)
+// 레벨은 서브시스템 핸들러가 확인하므로 출력 핸들러는 모든 레벨을 기록함
+type logOutput struct {
+	handler slog.Handler
+}
+
+var currentLogOutput atomic.Pointer[logOutput]
+
+func init() {
+	currentLogOutput.Store(&logOutput{newLogHandler(os.Stdout, false)})
+}
+
+func newLogHandler(w io.Writer, json bool) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	if json {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+func newSubsystemLogger(subsys string) *slog.Logger {
+	return slog.New(&subsystemHandler{subsys: subsys, level: logLevels[subsys]})
+}
+
+// 서브시스템의 레벨을 확인하고 subsys 속성을 붙여 현재 출력 핸들러로 넘기는 핸들러
+// 출력 핸들러가 바뀔 수 있으므로 WithAttrs/WithGroup은 기록해 두었다가 Handle에서 적용
+type subsystemHandler struct {
+	subsys string
+	level  *slog.LevelVar
+	wraps  []func(slog.Handler) slog.Handler
+}
+
+func (h *subsystemHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := currentLogOutput.Load().handler.WithAttrs([]slog.Attr{slog.String("subsys", h.subsys)})
+	for _, wrap := range h.wraps {
+		out = wrap(out)
+	}
+	return out.Handle(ctx, r)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler { return out.WithAttrs(attrs) })
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler { return out.WithGroup(name) })
+}
+
+func (h *subsystemHandler) with(wrap func(slog.Handler) slog.Handler) slog.Handler {
+	return &subsystemHandler{subsys: h.subsys, level: h.level, wraps: append(slices.Clip(h.wraps), wrap)}
+}
+
+// 해시, 트랜잭션 ID 같은 바이트 값을 hex 문자열 속성으로
+func hexAttr(key string, b []byte) slog.Attr {
+	return slog.String(key, hex.EncodeToString(b))
+}
+
+// 로그 설정
+type LogConfig struct {
+	Levels string // 로그 레벨 (SetLogLevels 형식). 비어있으면 모두 info
+	JSON   bool   // 한 줄에 JSON 객체 하나씩 출력
+	Dir    string // 비어있지 않으면 이 디렉토리의 node.log에도 기록 (크기가 넘으면 교체)
+}
+
+// 로그 레벨, 형식, 파일 출력을 설정
+// 반환된 Closer를 닫으면 로그 파일을 닫고 표준 출력으로만 기록함
+func ConfigureLogging(cfg LogConfig) (io.Closer, error) {
+	if cfg.Levels != "" {
+		if err := SetLogLevels(cfg.Levels); err != nil {
+			return nil, err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	var file *rotatingFile
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+			return nil, err
+		}
+		var err error
+		file, err = openRotatingFile(filepath.Join(cfg.Dir, logFileName), logFileMaxSize, logFileMaxFiles)
+		if err != nil {
+			return nil, err
+		}
+		w = io.MultiWriter(os.Stdout, file)
+	}
+
+	currentLogOutput.Store(&logOutput{newLogHandler(w, cfg.JSON)})
+	return closerFunc(func() error {
+		currentLogOutput.Store(&logOutput{newLogHandler(os.Stdout, cfg.JSON)})
+		if file != nil {
+			return file.Close()
+		}
+		return nil
+	}), nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// 로그 레벨 변경
+// spec은 쉼표로 구분한 항목들. "level"은 모든 서브시스템, "subsys=level"은 해당 서브시스템에 적용
+// (예: "info", "debug", "info,p2p=debug,rpc=warn"). level은 debug, info, warn, error
+// 항목 하나라도 잘못되었으면 아무것도 바꾸지 않음
+func SetLogLevels(spec string) error {
+	changes, err := parseLogLevels(spec)
+	if err != nil {
+		return err
+	}
+	for subsys, level := range changes {
+		logLevels[subsys].Set(level)
+	}
+	return nil
+}
+
+// 로그 레벨 spec을 서브시스템별 레벨로 해석 (적용하지 않음)
+func parseLogLevels(spec string) (map[string]slog.Level, error) {
+	changes := make(map[string]slog.Level)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		subsys, levelText, found := strings.Cut(item, "=")
+		if !found {
+			subsys, levelText = "", item
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(levelText))); err != nil {
+			return nil, fmt.Errorf("invalid log level %q", levelText)
+		}
+
+		subsys = strings.ToLower(strings.TrimSpace(subsys))
+		if subsys == "" {
+			for _, name := range logSubsystems {
+				changes[name] = level
+			}
+			continue
+		}
+		if _, ok := logLevels[subsys]; !ok {
+			return nil, fmt.Errorf("unknown log subsystem %q (subsystems: %s)", subsys, strings.Join(logSubsystems, ", "))
+		}
+		changes[subsys] = level
+	}
+	return changes, nil
+}
+
+// 현재 로그 레벨 ("chain=INFO,mempool=INFO,...")
+func LogLevels() string {
+	var items []string
+	for _, subsys := range logSubsystems {
+		items = append(items, fmt.Sprintf("%s=%s", subsys, logLevels[subsys].Level()))
+	}
+	slices.Sort(items)
+	return strings.Join(items, ",")
+}
+
+// 크기가 maxSize를 넘으면 교체되는 로그 파일
+// node.log → node.log.1 → ... → node.log.<maxFiles> 순서로 옮기고, 가장 오래된 파일은 지움
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	lock     sync.Mutex
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// 현재 파일을 닫고 번호를 하나씩 밀어낸 뒤 새 파일을 엶
+// 옮기지 못하면 같은 파일을 다시 열어 계속 기록함 (새 파일을 열지 못한 경우만 에러)
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxFiles))
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	os.Rename(f.path, f.path+".1")
+	return f.open()
+}
+
+func (f *rotatingFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// 'setloglevel' RPC 요청. Levels가 비어있으면 현재 레벨만 조회
+type SetLogLevelRequest struct {
+	Levels string
+}
+
+// 로그 레벨을 바꾸고 현재 레벨을 반환
+func (s *Server) rpcSetLogLevel(payload []byte) RPCResponse {
+	var req SetLogLevelRequest
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&req); err != nil {
+		return rpcError(fmt.Errorf("%w: setloglevel: %v", ErrInvalidRequest, err))
+	}
+
+	if req.Levels != "" {
+		if err := SetLogLevels(req.Levels); err != nil {
+			return rpcError(fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+		}
+		logRPC.Info("Log levels changed", "levels", LogLevels())
+	}
+	return RPCResponse{Success: true, Message: LogLevels()}
+}
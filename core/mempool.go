@@ -1,34 +1,71 @@
 package core
 
 import (
+	"bytes"
+	"encoding/gob"
 	"encoding/hex"
+	"fmt"
+	"os"
 	"sync"
 )
 
 type Mempool struct {
 	transactions map[string]*Transaction // key: txID
+	sizes        map[string]int          // 트랜잭션의 직렬화된 크기 (key: txID)
+	bytes        int                     // 멤풀에 있는 트랜잭션 크기의 합
+	maxTxs       int                     // 최대 트랜잭션 수 (0이면 제한 없음)
+	maxBytes     int                     // 최대 크기 합 (0이면 제한 없음)
 	lock         sync.RWMutex
 }
 
 func NewMempool() *Mempool {
 	return &Mempool{
 		transactions: make(map[string]*Transaction),
+		sizes:        make(map[string]int),
 	}
 }
 
+// 멤풀 크기 제한 설정 (0이면 제한 없음)
+// 이미 들어있는 트랜잭션은 그대로 두고, 이후 추가할 때만 적용
+func (m *Mempool) SetLimits(maxTxs, maxBytes int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.maxTxs, m.maxBytes = maxTxs, maxBytes
+}
+
 // mempool에 트랜잭션 추가 (유효성 검사는 서버가 수행)
-// return bool : 새로 추가되었는지 여부
-func (m *Mempool) Add(tx *Transaction) bool {
+// 이미 있으면 ErrTxInMempool, 제한을 넘으면 ErrMempoolFull
+// (수수료가 없어 우선순위를 매길 수 없으므로 기존 트랜잭션을 밀어내지 않고 새 트랜잭션을 거부)
+func (m *Mempool) Add(tx *Transaction) error {
+	size := len(gobEncode(tx))
+
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
 	txID := hex.EncodeToString(tx.ID)
 	if _, ok := m.transactions[txID]; ok {
-		return false // 멤풀에 이미 존재하는 경우 false
+		return ErrTxInMempool
+	}
+	if m.maxTxs > 0 && len(m.transactions) >= m.maxTxs {
+		return fmt.Errorf("%w: %d transactions", ErrMempoolFull, len(m.transactions))
+	}
+	if m.maxBytes > 0 && m.bytes+size > m.maxBytes {
+		return fmt.Errorf("%w: %d bytes", ErrMempoolFull, m.bytes)
 	}
 
 	m.transactions[txID] = tx
-	return true
+	m.sizes[txID] = size
+	m.bytes += size
+	return nil
+}
+
+// 멤풀의 트랜잭션 수와 크기 합
+func (m *Mempool) Size() (count, size int) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return len(m.transactions), m.bytes
 }
 
 func (m *Mempool) Get(ID string) *Transaction {
@@ -63,6 +100,37 @@ func (m *Mempool) Exists(ID string) bool {
 	return ok
 }
 
+// 멤풀의 트랜잭션을 파일에 저장 (노드를 종료할 때 호출)
+func (m *Mempool) SaveToFile(file string) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m.GetTxs()); err != nil {
+		return err
+	}
+
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// SaveToFile로 저장한 트랜잭션을 읽음. 파일이 없으면 빈 목록
+func LoadMempoolFile(file string) ([]*Transaction, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var txs []*Transaction
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&txs); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
 // 블록에 포함된 트랜잭션들을 멤풀에서 제거
 func (m *Mempool) Clear(block *Block) {
 	m.lock.Lock()
@@ -72,6 +140,8 @@ func (m *Mempool) Clear(block *Block) {
 		txID := hex.EncodeToString(tx.ID)
 		if _, ok := m.transactions[txID]; ok {
 			delete(m.transactions, txID)
+			m.bytes -= m.sizes[txID]
+			delete(m.sizes, txID)
 		}
 	}
 }
@@ -0,0 +1,46 @@
+package core
+
+// 피어에게 'mempool' 요청 (연결마다 한 번)
+// 우리 체인이 피어보다 뒤처져 있으면 받은 트랜잭션이 모르는 출력을 참조해 버려지므로 요청하지 않음
+// (동기화를 마치면 checkSyncComplete에서 다시 시도)
+func (s *Server) requestMempool(p *Peer) {
+	if p.Version().Version < mempoolVersion || !p.hasService(ServiceMempool) {
+		return
+	}
+	if _, tip, err := s.bc.GetTipInfo(); err != nil || tip < p.BestHeight() {
+		return
+	}
+	if !p.markMempoolRequested() {
+		return
+	}
+
+	logMempool.Debug("Requesting mempool", "peer", p.String())
+	s.sendMessage(p, "mempool", struct{}{})
+}
+
+// 'mempool' 메시지 처리
+// 멤풀의 트랜잭션 중 피어가 모르는 것을 inv로 알림 (피어가 getdata로 필요한 것만 요청)
+// 멤풀 전체를 훑으므로 연결마다 한 번만 응답하고, 비활성화되어 있으면 무시
+func (s *Server) handleMempool(p *Peer) {
+	if !s.serveMempool {
+		logMempool.Debug("Ignoring mempool request, serving mempool is disabled", "peer", p.String())
+		return
+	}
+	if !p.markMempoolServed() {
+		logMempool.Debug("Ignoring repeated mempool request", "peer", p.String())
+		return
+	}
+
+	var txids [][]byte
+	for _, tx := range s.mempool.GetTxs() {
+		if !p.knowsInventory(tx.ID) {
+			txids = append(txids, tx.ID)
+		}
+	}
+	logMempool.Debug("Announcing mempool transactions", "peer", p.String(), "count", len(txids))
+	for len(txids) > 0 {
+		n := min(len(txids), maxInvPerMsg)
+		s.sendInv(p, "tx", txids[:n])
+		txids = txids[n:]
+	}
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// P2P 메시지 형식
+// 헤더: 매직(4바이트) | 명령어(12바이트) | 페이로드 길이(4바이트) | 체크섬(4바이트)
+// 헤더 뒤에 페이로드(GOB)가 이어짐. 매직과 길이는 big endian
+// 체크섬은 페이로드의 double SHA-256 앞 4바이트
+
+const messageHeaderLen = 4 + commandLen + 4 + 4
+
+// 페이로드 최대 크기. 본문을 읽기 전에 확인하여 과도한 메모리 할당을 방지
+const maxPayloadSize = 32 * 1024 * 1024
+
+// 하나의 메시지를 만듦 (헤더 + 페이로드)
+func encodeMessage(magic uint32, command string, payload []byte) []byte {
+	msg := make([]byte, messageHeaderLen, messageHeaderLen+len(payload))
+
+	binary.BigEndian.PutUint32(msg[0:4], magic)
+	copy(msg[4:4+commandLen], commandToBytes(command))
+	binary.BigEndian.PutUint32(msg[4+commandLen:8+commandLen], uint32(len(payload)))
+	copy(msg[8+commandLen:messageHeaderLen], checksum(payload))
+
+	return append(msg, payload...)
+}
+
+// 메시지를 한 번의 Write로 전송
+func writeMessage(w io.Writer, magic uint32, command string, payload []byte) error {
+	_, err := w.Write(encodeMessage(magic, command, payload))
+	return err
+}
+
+// r에서 메시지 하나를 읽음
+// 매직, 페이로드 길이, 체크섬 중 하나라도 맞지 않으면 에러
+func readMessage(r io.Reader, magic uint32) (string, []byte, error) {
+	header := make([]byte, messageHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", nil, err
+	}
+
+	if got := binary.BigEndian.Uint32(header[0:4]); got != magic {
+		return "", nil, fmt.Errorf("Invalid network magic %08x", got)
+	}
+
+	command := bytesToCommand(header[4 : 4+commandLen])
+
+	length := binary.BigEndian.Uint32(header[4+commandLen : 8+commandLen])
+	if length > maxPayloadSize {
+		return "", nil, fmt.Errorf("Payload of %s too large: %d bytes", command, length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", nil, err
+	}
+
+	if !bytes.Equal(header[8+commandLen:messageHeaderLen], checksum(payload)) {
+		return "", nil, fmt.Errorf("Invalid checksum for %s", command)
+	}
+
+	return command, payload, nil
+}
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// 현재 코드가 사용하는 DB 스키마 버전
+// Block, TXOutput 등 저장 형식이 바뀌면 버전을 올리고 migrations에 변환 함수를 추가해야 함
+const schemaVersion = 3
+
+const schemaVersionKey = "schemaversion"
+
+var (
+	ErrSchemaTooNew      = errors.New("database schema is newer than this node supports")
+	ErrMigrationRequired = errors.New("database schema is outdated, migration required")
+	errMigrationDryRun   = errors.New("migration dry-run")
+)
+
+// 스키마 버전 from -> from+1 로 변환하는 마이그레이션
+type migration struct {
+	from        int
+	description string
+	migrate     func(tx StorageTx) error
+}
+
+// 버전 순서대로 정렬된 마이그레이션 목록
+var migrations = []migration{
+	{
+		from:        0,
+		description: "Record schema version in metadata bucket",
+		// 버전 0(버전 정보가 없던 DB)과 1의 레이아웃은 같으므로 버전 기록만 하면 됨
+		migrate: func(tx StorageTx) error { return nil },
+	},
+	{
+		from:        1,
+		description: "Build block header/height indexes and store UTXOs with output indexes",
+		migrate:     migrateBlockIndexes,
+	},
+	{
+		from:        2,
+		description: "Record total size of stored block bodies for pruning",
+		migrate:     migrateBlockDataSize,
+	},
+}
+
+// 버전 1 -> 2
+// 모든 블록에 대해 헤더/높이 인덱스를 만들고, UTXO Set을 UTXOEntry 형식으로 다시 만듦
+func migrateBlockIndexes(tx StorageTx) error {
+	hash := tx.GetTip()
+	var blocks []*Block
+	for len(hash) > 0 {
+		data := tx.GetBlock(hash)
+		if data == nil {
+			break
+		}
+		block, err := DeserializeBlock(data)
+		if err != nil {
+			return err
+		}
+		if err := putBlockIndexes(tx, block); err != nil {
+			return err
+		}
+		blocks = append(blocks, block)
+		hash = block.PrevBlockHash
+	}
+
+	i := 0
+	allUTXOs, err := collectUTXOs(func() (*Block, error) {
+		if i >= len(blocks) {
+			return nil, nil
+		}
+		i++
+		return blocks[i-1], nil
+	})
+	if err != nil {
+		return err
+	}
+	return putAllUTXOs(tx, allUTXOs)
+}
+
+// 버전 2 -> 3
+// 본문이 남아있는 메인 체인 블록들의 크기를 더해 기록 (이후로는 블록을 연결하거나 끊거나 prune할 때 갱신)
+func migrateBlockDataSize(tx StorageTx) error {
+	tip, err := tipHeight(tx)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for height := readPrunedHeight(tx) + 1; height <= tip; height++ {
+		hash := tx.GetIndex(heightsIndex, heightKey(height))
+		if hash == nil {
+			return fmt.Errorf("Block at height %d not found in height index", height)
+		}
+		total += int64(len(tx.GetBlock(hash)))
+	}
+	return writeBlockDataSize(tx, total)
+}
+
+type MigrateOptions struct {
+	DryRun     bool   // 마이그레이션을 실행한 뒤 롤백 (적용될 내용만 확인)
+	BackupPath string // 비어있지 않으면 마이그레이션 전에 DB를 이 경로에 백업
+}
+
+// 백업을 지원하는 저장소
+type backupStorage interface {
+	Backup(path string) error
+}
+
+// 저장소에 기록된 스키마 버전을 반환
+// 버전이 없을 때, 체인이 있으면 버전 기록 이전의 DB(0), 비어있으면 새 DB(schemaVersion)
+func readSchemaVersion(tx StorageTx) int {
+	v := tx.GetMeta(schemaVersionKey)
+	if v == nil {
+		if tx.GetTip() == nil {
+			return schemaVersion
+		}
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(v))
+}
+
+func writeSchemaVersion(tx StorageTx, version int) error {
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint32(v, uint32(version))
+	return tx.PutMeta(schemaVersionKey, v)
+}
+
+// 저장소의 스키마 버전이 현재 코드와 일치하는지 확인
+func checkSchemaVersion(tx StorageTx) error {
+	version := readSchemaVersion(tx)
+	if version > schemaVersion {
+		return fmt.Errorf("%w (database: %d, supported: %d)", ErrSchemaTooNew, version, schemaVersion)
+	}
+	if version < schemaVersion {
+		return fmt.Errorf("%w (database: %d, current: %d)", ErrMigrationRequired, version, schemaVersion)
+	}
+	return nil
+}
+
+// 저장소를 현재 스키마 버전으로 업그레이드
+// 모든 마이그레이션은 하나의 트랜잭션 안에서 실행되므로, 중간에 실패하면 원래 상태로 돌아감
+// 적용된(DryRun이면 적용될) 마이그레이션 설명 목록을 반환
+func MigrateStorage(store Storage, opts MigrateOptions) ([]string, error) {
+	var version int
+	err := store.View(func(tx StorageTx) error {
+		version = readSchemaVersion(tx)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if version > schemaVersion {
+		return nil, fmt.Errorf("%w (database: %d, supported: %d)", ErrSchemaTooNew, version, schemaVersion)
+	}
+	if version == schemaVersion {
+		return nil, nil
+	}
+
+	if opts.BackupPath != "" && !opts.DryRun {
+		bs, ok := store.(backupStorage)
+		if !ok {
+			return nil, fmt.Errorf("Storage does not support backup")
+		}
+		if err := bs.Backup(opts.BackupPath); err != nil {
+			return nil, fmt.Errorf("Backup failed: %w", err)
+		}
+		logChain.Info("Database backed up", "path", opts.BackupPath)
+	}
+
+	var applied []string
+	err = store.Update(func(tx StorageTx) error {
+		for _, m := range migrations {
+			if m.from < version {
+				continue
+			}
+			logChain.Info("Migrating database schema", "from", m.from, "to", m.from+1, "description", m.description)
+			if err := m.migrate(tx); err != nil {
+				return fmt.Errorf("Migration %d -> %d failed: %w", m.from, m.from+1, err)
+			}
+			if err := writeSchemaVersion(tx, m.from+1); err != nil {
+				return err
+			}
+			applied = append(applied, m.description)
+		}
+
+		if err := checkSchemaVersion(tx); err != nil {
+			return err
+		}
+
+		// dry-run이면 에러를 반환해 모든 변경을 롤백
+		if opts.DryRun {
+			return errMigrationDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errMigrationDryRun) {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// DB 파일을 열어 현재 스키마 버전으로 업그레이드한 뒤 닫음
+// 노드가 시작될 때 블록체인을 열기 전에 호출
+func MigrateDatabase(dbFile string, opts MigrateOptions) ([]string, error) {
+	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	store, err := NewBoltStorage(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	return MigrateStorage(store, opts)
+}
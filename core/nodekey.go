@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// 노드 식별 키
+// P2P 연결을 TLS로 암호화할 때 이 키로 만든 자체 서명 인증서를 사용하고,
+// 공개키의 SHA-256 해시(hex)를 노드 ID로 사용함 (허용 목록에 등록하는 값)
+type NodeKey struct {
+	key  *ecdsa.PrivateKey
+	cert tls.Certificate
+	id   string
+}
+
+// file에 저장된 노드 키를 불러옴. 파일이 없으면 새로 만들어 저장
+func LoadOrCreateNodeKey(file string) (*NodeKey, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return createNodeKey(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("Invalid node key file %s", file)
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid node key file %s: %w", file, err)
+	}
+	return newNodeKey(key)
+}
+
+func createNodeKey(file string) (*NodeKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return nil, err
+	}
+	return newNodeKey(key)
+}
+
+// 키로 자체 서명 인증서를 만듦 (인증서는 저장하지 않고 시작할 때마다 다시 만듦)
+func newNodeKey(key *ecdsa.PrivateKey) (*NodeKey, error) {
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	id := nodeIDFromPublicKey(pub)
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: id},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NodeKey{
+		key:  key,
+		cert: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		id:   id,
+	}, nil
+}
+
+func (k *NodeKey) ID() string { return k.id }
+
+// DER로 인코딩된 공개키(SubjectPublicKeyInfo)의 노드 ID
+func nodeIDFromPublicKey(der []byte) string {
+	hash := sha256.Sum256(der)
+	return hex.EncodeToString(hash[:])
+}
+
+// TLS 연결이면 상대방의 노드 ID, 아니면 빈 문자열
+func remoteNodeID(conn net.Conn) string {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return ""
+	}
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ""
+	}
+	return nodeIDFromPublicKey(certs[0].RawSubjectPublicKeyInfo)
+}
+
+// P2P 연결에 사용하는 TLS 설정
+// CA 없이 자체 서명 인증서를 쓰므로 인증서 체인은 검증하지 않고, 양쪽 모두 인증서를 요구함
+// TLS 1.3 핸드셰이크에서 상대방이 인증서의 키를 가졌음을 증명하므로, 공개키로 노드를 식별할 수 있음
+func (s *Server) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:            tls.VersionTLS13,
+		Certificates:          []tls.Certificate{s.nodeKey.cert},
+		ClientAuth:            tls.RequireAnyClientCert,
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: s.verifyPeerCertificate,
+	}
+}
+
+// 상대방 인증서의 노드 ID가 허용 목록에 있는지 확인 (허용 목록이 비어 있으면 모든 노드 허용)
+func (s *Server) verifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("peer sent no certificate")
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return fmt.Errorf("invalid peer certificate: %w", err)
+	}
+
+	id := nodeIDFromPublicKey(cert.RawSubjectPublicKeyInfo)
+	if len(s.allowedPeers) > 0 && !s.allowedPeers[id] {
+		return fmt.Errorf("node %s is not in the allowlist", id)
+	}
+	return nil
+}
+
+// 암호화를 사용하면 연결에서 TLS 핸드셰이크를 수행
+// 핸드셰이크에 실패하면 연결을 닫고 에러를 반환
+func (s *Server) secureConn(conn net.Conn, inbound bool) (net.Conn, error) {
+	if s.nodeKey == nil {
+		return conn, nil
+	}
+
+	var tlsConn *tls.Conn
+	if inbound {
+		tlsConn = tls.Server(conn, s.tlsConfig())
+	} else {
+		tlsConn = tls.Client(conn, s.tlsConfig())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with %s failed: %w", conn.RemoteAddr(), err)
+	}
+	return tlsConn, nil
+}
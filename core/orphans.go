@@ -0,0 +1,175 @@
+package core
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	maxOrphanBlocks   = 100              // 보관하는 최대 고아 블록 수
+	maxOrphansPerPeer = 20               // 한 피어가 보낸 고아 블록을 보관하는 최대 수
+	orphanExpiry      = 10 * time.Minute // 이 시간 동안 부모가 오지 않으면 제거
+)
+
+// 부모 블록을 모르는 채로 도착한 블록
+type orphanBlock struct {
+	block *Block
+	from  *Peer // 블록을 보낸 피어 (부모를 요청하고, 검증 실패 시 책임을 물을 대상)
+	added time.Time
+}
+
+// 고아 블록 풀
+// 부모 블록 해시로 찾을 수 있도록 보관하고, 부모가 체인에 추가되면 이어서 연결
+type orphanPool struct {
+	byHash   map[string]*orphanBlock   // key: 블록 해시(hex)
+	byParent map[string][]*orphanBlock // key: 부모 블록 해시(hex)
+	lock     sync.Mutex
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		byHash:   make(map[string]*orphanBlock),
+		byParent: make(map[string][]*orphanBlock),
+	}
+}
+
+// 고아 블록 추가. 가득 차면 가장 오래된 블록을 제거
+// 보낸 피어의 블록이 maxOrphansPerPeer개이면 그 피어의 가장 오래된 블록을 제거
+// (한 피어가 쓸모없는 블록으로 다른 피어의 고아 블록을 밀어내지 못하도록)
+// 이미 있는 블록이면 false
+func (op *orphanPool) add(block *Block, from *Peer) bool {
+	op.lock.Lock()
+	defer op.lock.Unlock()
+
+	key := hex.EncodeToString(block.Hash)
+	if _, ok := op.byHash[key]; ok {
+		return false
+	}
+
+	op.expire(time.Now())
+	for op.countFrom(from) >= maxOrphansPerPeer {
+		op.removeOldest(func(orphan *orphanBlock) bool { return orphan.from == from })
+	}
+	for len(op.byHash) >= maxOrphanBlocks {
+		op.removeOldest(func(*orphanBlock) bool { return true })
+	}
+
+	orphan := &orphanBlock{block: block, from: from, added: time.Now()}
+	op.byHash[key] = orphan
+	parent := hex.EncodeToString(block.PrevBlockHash)
+	op.byParent[parent] = append(op.byParent[parent], orphan)
+	return true
+}
+
+// 고아 블록이 이어진 줄기를 따라 올라가, 가장 먼저 받아와야 하는 조상의 해시를 반환
+func (op *orphanPool) missingAncestor(block *Block) []byte {
+	op.lock.Lock()
+	defer op.lock.Unlock()
+
+	hash := block.PrevBlockHash
+	for {
+		orphan, ok := op.byHash[hex.EncodeToString(hash)]
+		if !ok {
+			return hash
+		}
+		hash = orphan.block.PrevBlockHash
+	}
+}
+
+// parent를 부모로 하는 고아 블록들을 풀에서 꺼냄
+func (op *orphanPool) takeChildren(parent []byte) []*orphanBlock {
+	op.lock.Lock()
+	defer op.lock.Unlock()
+
+	key := hex.EncodeToString(parent)
+	children := op.byParent[key]
+	delete(op.byParent, key)
+	for _, child := range children {
+		delete(op.byHash, hex.EncodeToString(child.block.Hash))
+	}
+	return children
+}
+
+func (op *orphanPool) size() int {
+	op.lock.Lock()
+	defer op.lock.Unlock()
+	return len(op.byHash)
+}
+
+// 오래된 고아 블록 제거
+func (op *orphanPool) expire(now time.Time) {
+	for _, orphan := range op.byHash {
+		if now.Sub(orphan.added) > orphanExpiry {
+			op.remove(orphan)
+		}
+	}
+}
+
+// 피어가 보낸 고아 블록 수
+func (op *orphanPool) countFrom(p *Peer) int {
+	count := 0
+	for _, orphan := range op.byHash {
+		if orphan.from == p {
+			count++
+		}
+	}
+	return count
+}
+
+// match를 만족하는 고아 블록 중 가장 오래된 블록 제거
+func (op *orphanPool) removeOldest(match func(*orphanBlock) bool) {
+	var oldest *orphanBlock
+	for _, orphan := range op.byHash {
+		if match(orphan) && (oldest == nil || orphan.added.Before(oldest.added)) {
+			oldest = orphan
+		}
+	}
+	if oldest != nil {
+		op.remove(oldest)
+	}
+}
+
+func (op *orphanPool) remove(orphan *orphanBlock) {
+	delete(op.byHash, hex.EncodeToString(orphan.block.Hash))
+
+	parent := hex.EncodeToString(orphan.block.PrevBlockHash)
+	siblings := op.byParent[parent]
+	for i, sibling := range siblings {
+		if sibling == orphan {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(op.byParent, parent)
+	} else {
+		op.byParent[parent] = siblings
+	}
+}
+
+// 부모를 모르는 블록을 고아 풀에 넣고, 빠진 조상 블록을 보낸 피어에게 요청
+// 부모가 없어 체인 검증은 할 수 없으므로, PoW만 먼저 확인하여 만들기 쉬운 블록으로 풀을 채우지 못하도록 함
+func (s *Server) addOrphan(p *Peer, block *Block) {
+	if !block.Header().ValidatePoW() {
+		s.misbehaving(p, scoreInvalid, fmt.Sprintf("orphan block %x has invalid PoW", block.Hash))
+		return
+	}
+	if !s.orphans.add(block, p) {
+		return
+	}
+
+	ancestor := s.orphans.missingAncestor(block)
+
+	// 헤더 체인에 있는 조상은 다운로드 스케줄러가 받아옴
+	if s.bc.HasHeader(ancestor) {
+		logChain.Debug("Orphan block, waiting for ancestor", hexAttr("hash", block.Hash), "height", block.Height,
+			"orphans", s.orphans.size(), hexAttr("ancestor", ancestor))
+		return
+	}
+
+	logChain.Debug("Orphan block, requesting ancestor", hexAttr("hash", block.Hash), "height", block.Height,
+		"orphans", s.orphans.size(), hexAttr("ancestor", ancestor), "peer", p.String())
+	s.sendGetData(p, "block", ancestor)
+}
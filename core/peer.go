@@ -0,0 +1,465 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// 피어 한 명에게 보낼 수 있도록 대기 중인 메시지 수
+const peerSendQueueSize = 256
+
+// 다른 노드와의 장기 연결
+// 읽기/쓰기 고루틴이 하나씩 있고, 메시지는 양방향으로 주고받음
+type Peer struct {
+	addr       string // 연결 주소 (outbound: 연결한 주소, inbound: 원격 주소)
+	listenAddr string // 'version' 메시지로 알게 된 피어의 P2P 주소
+	inbound    bool   // 상대방이 연결해 온 경우 true
+	nodeID     string // 암호화된 연결이면 상대방 노드 키의 ID
+	conn       net.Conn
+
+	// 핸드셰이크 상태
+	version        *Version // 피어가 보낸 version 메시지
+	versionSent    bool
+	verackReceived bool
+
+	banScore   int   // 잘못된 행동 누적 점수
+	bestHeight int64 // 피어가 가진 것으로 알려진 최고 블록 높이
+
+	// 인벤토리 전파 상태
+	knownInventory *inventorySet // 피어가 이미 가진 것으로 알려진 블록/트랜잭션 (다시 알리지 않음)
+	txInvQueue     [][]byte      // 다음 차례에 inv로 알릴 트랜잭션 ID
+	nextTxInv      time.Time     // 다음으로 트랜잭션 inv를 보낼 시각
+
+	// 멤풀 동기화 ('mempool' 요청은 연결마다 한 번씩만 주고받음)
+	mempoolRequested bool // 이 피어에게 'mempool'을 보냈음
+	mempoolServed    bool // 이 피어의 'mempool' 요청에 응답했음
+
+	// 연결 상태 확인 (ping/pong)
+	connectedAt time.Time
+	pingNonce   uint64        // 응답을 기다리는 ping의 nonce (0이면 없음)
+	pingSent    time.Time     // 마지막으로 ping을 보낸 시각
+	pingRTT     time.Duration // 마지막으로 측정한 왕복 시간
+	minPingRTT  time.Duration
+
+	// 자원 제한과 트래픽 카운터
+	msgLimiter  *rateLimiter
+	byteLimiter *rateLimiter
+	counters    peerCounters
+	netCounters *netCounters // 노드 전체 카운터
+
+	recvQueue chan peerMessage // 읽기 고루틴이 읽고 처리 고루틴이 처리할 메시지
+	sendQueue chan []byte
+	quit      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup // 읽기/처리/쓰기 고루틴
+	lock      sync.RWMutex
+}
+
+// 받은 메시지 하나
+type peerMessage struct {
+	command string
+	payload []byte
+}
+
+func newPeer(conn net.Conn, addr string, inbound bool, counters *netCounters) *Peer {
+	return &Peer{
+		addr:           addr,
+		inbound:        inbound,
+		nodeID:         remoteNodeID(conn),
+		conn:           conn,
+		knownInventory: newInventorySet(maxKnownInventory),
+		connectedAt:    time.Now(),
+		msgLimiter:     newRateLimiter(peerMsgRate, peerMsgBurst),
+		byteLimiter:    newRateLimiter(peerByteRate, peerByteBurst),
+		netCounters:    counters,
+		recvQueue:      make(chan peerMessage, peerRecvQueueSize),
+		sendQueue:      make(chan []byte, peerSendQueueSize),
+		quit:           make(chan struct{}),
+	}
+}
+
+func (p *Peer) String() string {
+	if listenAddr := p.ListenAddr(); listenAddr != "" && listenAddr != p.addr {
+		return fmt.Sprintf("%s (%s)", p.addr, listenAddr)
+	}
+	return p.addr
+}
+
+func (p *Peer) ListenAddr() string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.listenAddr
+}
+
+func (p *Peer) setListenAddr(addr string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.listenAddr = addr
+}
+
+// 피어가 보낸 version 메시지 (아직 받지 않았으면 nil)
+func (p *Peer) Version() *Version {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.version
+}
+
+func (p *Peer) setVersion(v *Version) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.version = v
+}
+
+func (p *Peer) markVersionSent() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.versionSent = true
+}
+
+func (p *Peer) versionWasSent() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.versionSent
+}
+
+func (p *Peer) markVerackReceived() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.verackReceived = true
+}
+
+func (p *Peer) verackWasReceived() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.verackReceived
+}
+
+// version을 주고받고 상대방의 verack까지 받았으면 핸드셰이크 완료
+func (p *Peer) handshakeDone() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.version != nil && p.versionSent && p.verackReceived
+}
+
+// 피어가 가진 최고 블록 높이 (version 이후 받은 헤더와 블록으로 갱신)
+func (p *Peer) BestHeight() int64 {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.bestHeight
+}
+
+func (p *Peer) updateBestHeight(height int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if height > p.bestHeight {
+		p.bestHeight = height
+	}
+}
+
+// 잘못된 행동 점수를 더하고 누적 점수를 반환
+func (p *Peer) addBanScore(score int) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.banScore += score
+	return p.banScore
+}
+
+// 피어가 가진 것으로 알려진 인벤토리에 추가
+func (p *Peer) addKnownInventory(hashes ...[]byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, hash := range hashes {
+		p.knownInventory.add(hash)
+	}
+}
+
+func (p *Peer) knowsInventory(hash []byte) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.knownInventory.has(hash)
+}
+
+// 다음 차례에 알릴 트랜잭션으로 추가 (피어가 이미 아는 트랜잭션이면 무시)
+func (p *Peer) queueTxInv(txid []byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.knownInventory.has(txid) {
+		p.txInvQueue = append(p.txInvQueue, txid)
+	}
+}
+
+// 알릴 차례가 되었으면 모아둔 트랜잭션 ID를 꺼내고 다음 차례를 무작위로 정함
+// 그 사이 피어가 알게 된 트랜잭션은 제외하고, 꺼낸 트랜잭션은 피어가 아는 것으로 기록
+func (p *Peer) takeTxInv(now time.Time) [][]byte {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.txInvQueue) == 0 || now.Before(p.nextTxInv) {
+		return nil
+	}
+	p.nextTxInv = now.Add(txInvDelay(p.inbound))
+
+	var txids [][]byte
+	for _, txid := range p.txInvQueue {
+		if !p.knownInventory.has(txid) {
+			p.knownInventory.add(txid)
+			txids = append(txids, txid)
+		}
+	}
+	p.txInvQueue = nil
+	return txids
+}
+
+// 'mempool'을 보낸 것으로 기록. 이미 보냈으면 false
+func (p *Peer) markMempoolRequested() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.mempoolRequested {
+		return false
+	}
+	p.mempoolRequested = true
+	return true
+}
+
+// 'mempool' 요청에 응답한 것으로 기록. 이미 응답했으면 false
+func (p *Peer) markMempoolServed() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.mempoolServed {
+		return false
+	}
+	p.mempoolServed = true
+	return true
+}
+
+// 응답을 기다리는 ping과 마지막으로 ping을 보낸 시각
+func (p *Peer) pendingPing() (uint64, time.Time) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.pingNonce, p.pingSent
+}
+
+func (p *Peer) startPing(nonce uint64, now time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pingNonce = nonce
+	p.pingSent = now
+}
+
+// 기다리던 ping의 응답이면 왕복 시간을 기록하고 반환
+func (p *Peer) finishPing(nonce uint64, now time.Time) (time.Duration, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.pingNonce == 0 || nonce != p.pingNonce {
+		return 0, false
+	}
+	p.pingNonce = 0
+	p.pingRTT = now.Sub(p.pingSent)
+	if p.minPingRTT == 0 || p.pingRTT < p.minPingRTT {
+		p.minPingRTT = p.pingRTT
+	}
+	return p.pingRTT, true
+}
+
+// 'getpeerinfo'에 보여줄 피어 정보
+func (p *Peer) info(now time.Time) PeerInfo {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	info := PeerInfo{
+		Addr:        p.addr,
+		ListenAddr:  p.listenAddr,
+		Inbound:     p.inbound,
+		NodeID:      p.nodeID,
+		BestHeight:  p.bestHeight,
+		BanScore:    p.banScore,
+		ConnectedAt: p.connectedAt,
+		PingRTT:     p.pingRTT,
+		MinPingRTT:  p.minPingRTT,
+		MsgsRecv:    p.counters.msgsRecv.Load(),
+		MsgsSent:    p.counters.msgsSent.Load(),
+		BytesRecv:   p.counters.bytesRecv.Load(),
+		BytesSent:   p.counters.bytesSent.Load(),
+		Throttled:   p.counters.throttled.Load(),
+	}
+	if p.version != nil {
+		info.Version = p.version.Version
+		info.UserAgent = p.version.UserAgent
+		info.Services = p.version.Services
+	}
+	if p.pingNonce != 0 {
+		info.PingWait = now.Sub(p.pingSent)
+	}
+	return info
+}
+
+// 피어가 해당 서비스를 제공하는지 확인
+func (p *Peer) hasService(service uint64) bool {
+	v := p.Version()
+	return v != nil && v.Services&service != 0
+}
+
+// 주소가 이 피어를 가리키는지 확인 (연결 주소 또는 P2P 주소)
+func (p *Peer) matches(addr string) bool {
+	return p.addr == addr || p.ListenAddr() == addr
+}
+
+// 쓰기 고루틴이 보낼 수 있도록 메시지를 큐에 넣음
+// 이미 연결이 끊긴 피어면 false. 큐가 peerSendQueueWait 동안 비워지지 않으면 느린 피어로 보고 연결을 끊음
+func (p *Peer) send(msg []byte) bool {
+	select {
+	case p.sendQueue <- msg:
+		return true
+	case <-p.quit:
+		return false
+	default:
+	}
+
+	timer := time.NewTimer(peerSendQueueWait)
+	defer timer.Stop()
+	select {
+	case p.sendQueue <- msg:
+		return true
+	case <-p.quit:
+		return false
+	case <-timer.C:
+		logP2P.Warn("Disconnecting peer, send queue full", "peer", p.String(), "wait", peerSendQueueWait)
+		p.netCounters.slowPeers.Add(1)
+		p.close()
+		return false
+	}
+}
+
+// 연결 종료. 여러 번 호출해도 한 번만 닫힘
+func (p *Peer) close() {
+	p.closeOnce.Do(func() {
+		close(p.quit)
+		p.conn.Close()
+	})
+}
+
+// 연결이 끊길 때까지 메시지를 읽어 handle에 전달
+func (p *Peer) readLoop(magic uint32) error {
+	for {
+		command, payload, err := readMessage(p.conn, magic)
+		if err != nil {
+			return err
+		}
+
+		size := uint64(messageHeaderLen + len(payload))
+		p.counters.msgsRecv.Add(1)
+		p.counters.bytesRecv.Add(size)
+		p.netCounters.msgsRecv.Add(1)
+		p.netCounters.bytesRecv.Add(size)
+
+		// 메시지 수나 바이트 예산을 넘기면 예산이 찰 때까지 읽기를 멈춤
+		// (TCP 흐름 제어로 상대방의 전송도 느려짐)
+		if !p.throttle(float64(size)) {
+			return nil
+		}
+
+		// 처리 큐가 가득 차 있으면 처리 고루틴이 따라잡을 때까지 읽기를 멈춤
+		select {
+		case p.recvQueue <- peerMessage{command: command, payload: payload}:
+		case <-p.quit:
+			return nil
+		}
+	}
+}
+
+// 예산을 넘긴 만큼 기다림. 기다리는 중에 연결이 끊기면 false
+func (p *Peer) throttle(size float64) bool {
+	now := time.Now()
+	delay := max(p.msgLimiter.reserve(1, now), p.byteLimiter.reserve(size, now))
+	if delay <= 0 {
+		return true
+	}
+	delay = min(delay, maxThrottleDelay)
+
+	p.counters.throttled.Add(1)
+	p.netCounters.throttled.Add(1)
+	p.netCounters.throttledNanos.Add(int64(delay))
+	if delay >= throttleLogMinimum {
+		logP2P.Info("Peer exceeded its rate budget, pausing reads", "peer", p.String(), "delay", delay.Round(time.Millisecond))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-p.quit:
+		return false
+	}
+}
+
+// 읽은 메시지를 순서대로 처리
+func (p *Peer) handleLoop(handle func(p *Peer, command string, payload []byte)) {
+	for {
+		select {
+		case msg := <-p.recvQueue:
+			handle(p, msg.command, msg.payload)
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// 큐에 쌓인 메시지를 순서대로 전송
+func (p *Peer) writeLoop() error {
+	for {
+		select {
+		case msg := <-p.sendQueue:
+			if _, err := p.conn.Write(msg); err != nil {
+				return err
+			}
+			p.counters.msgsSent.Add(1)
+			p.counters.bytesSent.Add(uint64(len(msg)))
+			p.netCounters.msgsSent.Add(1)
+			p.netCounters.bytesSent.Add(uint64(len(msg)))
+		case <-p.quit:
+			return nil
+		}
+	}
+}
+
+// 읽기/처리/쓰기 고루틴을 시작. 읽기나 쓰기가 끝나면 연결을 닫고 onClose 호출
+func (p *Peer) start(magic uint32, handle func(p *Peer, command string, payload []byte), onClose func(p *Peer)) {
+	p.wg.Add(3)
+
+	go func() {
+		defer p.wg.Done()
+		if err := p.writeLoop(); err != nil {
+			logP2P.Info("Peer write error", "peer", p.String(), "err", err)
+		}
+		p.close()
+	}()
+
+	go func() {
+		defer p.wg.Done()
+		p.handleLoop(handle)
+	}()
+
+	go func() {
+		defer p.wg.Done()
+		err := p.readLoop(magic)
+		if err != nil && err != io.EOF {
+			select {
+			case <-p.quit:
+			default:
+				logP2P.Info("Peer read error", "peer", p.String(), "err", err)
+			}
+		}
+		p.close()
+		onClose(p)
+	}()
+}
+
+// 연결이 닫히고 고루틴들이 모두 끝날 때까지 기다림 (처리 중이던 메시지도 마저 처리됨)
+func (p *Peer) wait() {
+	p.wg.Wait()
+}
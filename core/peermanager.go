@@ -0,0 +1,274 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	targetOutboundPeers = 8  // 유지하려는 outbound 연결 수 (기본값, ServerConfig.MaxOutbound)
+	maxInboundPeers     = 32 // 허용하는 최대 inbound 연결 수 (기본값, ServerConfig.MaxInbound)
+
+	peerMaintainInterval = 30 * time.Second // 연결 수 확인 및 피어 목록 저장 주기
+	peerConnectDelay     = 2 * time.Second  // 시작 후 처음 연결을 시도하기까지 기다리는 시간
+
+	maxKnownAddrs    = 2000               // 피어 목록에 보관하는 최대 주소 수
+	maxAddrPerMsg    = 1000               // 'addr' 메시지 하나에 담을 수 있는 최대 주소 수
+	maxAddrFailures  = 5                  // 연속 실패가 이 횟수에 도달하면 목록에서 제거
+	addrExpiry       = 7 * 24 * time.Hour // 이 기간 동안 소식이 없는 주소는 제거
+	addrRetryBackoff = time.Minute        // 실패한 주소를 다시 시도하기까지의 기본 대기 시간
+)
+
+// 피어 목록에 보관하는 주소 정보
+type KnownAddress struct {
+	Addr        string    `json:"addr"`
+	Source      string    `json:"source,omitempty"` // 이 주소를 알려준 피어 (직접 알게 된 경우 비어있음)
+	LastSeen    time.Time `json:"last_seen"`        // 마지막으로 살아있다고 확인된 시각
+	LastAttempt time.Time `json:"last_attempt,omitzero"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	Failures    int       `json:"failures"` // 마지막 성공 이후 연속 실패 횟수
+}
+
+// 다른 노드의 주소를 관리하는 피어 목록
+// 'addr' 메시지와 연결 결과로 갱신되고, 파일에 저장하여 재시작 후에도 유지됨
+type PeerManager struct {
+	file  string
+	addrs map[string]*KnownAddress
+	seeds map[string]bool // 설정의 seed 주소 (실패해도 제거하지 않고 다시 시도할 때까지 기다리기만 함)
+	lock  sync.Mutex
+}
+
+// file에 저장된 피어 목록을 불러옴. 파일이 없으면 빈 목록으로 시작
+func NewPeerManager(file string) (*PeerManager, error) {
+	pm := &PeerManager{
+		file:  file,
+		addrs: make(map[string]*KnownAddress),
+		seeds: make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return pm, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []*KnownAddress
+	if err := json.Unmarshal(data, &addrs); err != nil {
+		return nil, fmt.Errorf("Failed to parse peers file %s: %w", file, err)
+	}
+	for _, ka := range addrs {
+		if ka.Addr != "" {
+			pm.addrs[ka.Addr] = ka
+		}
+	}
+	pm.evict()
+
+	return pm, nil
+}
+
+// 피어 목록을 파일에 저장
+func (pm *PeerManager) Save() error {
+	pm.lock.Lock()
+	addrs := make([]*KnownAddress, 0, len(pm.addrs))
+	for _, ka := range pm.addrs {
+		addrs = append(addrs, ka)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Addr < addrs[j].Addr })
+	data, err := json.MarshalIndent(addrs, "", "  ")
+	pm.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// 저장 중 종료되어도 기존 파일이 깨지지 않도록 임시 파일에 쓰고 교체
+	tmp := pm.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, pm.file)
+}
+
+// 주소를 목록에 추가. 이미 있으면 lastSeen만 갱신
+// lastSeen이 0이면 현재 시각을 사용
+func (pm *PeerManager) AddAddress(addr, source string, lastSeen time.Time) {
+	if addr == "" {
+		return
+	}
+	if lastSeen.IsZero() || lastSeen.After(time.Now()) {
+		lastSeen = time.Now()
+	}
+
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	if ka, ok := pm.addrs[addr]; ok {
+		if lastSeen.After(ka.LastSeen) {
+			ka.LastSeen = lastSeen
+		}
+		return
+	}
+
+	pm.addrs[addr] = &KnownAddress{Addr: addr, Source: source, LastSeen: lastSeen}
+	if len(pm.addrs) > maxKnownAddrs {
+		pm.evictOldest()
+	}
+}
+
+// seed 주소를 목록에 추가
+// seed는 다른 주소를 모두 잃어도 네트워크에 다시 들어올 수 있는 통로이므로,
+// 연결에 계속 실패하거나 오래되어도 목록에서 제거하지 않음
+func (pm *PeerManager) AddSeed(addr string) {
+	pm.AddAddress(addr, "", time.Now())
+
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	pm.seeds[addr] = true
+}
+
+// 연결 시도 시각 기록
+func (pm *PeerManager) MarkAttempt(addr string) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	if ka, ok := pm.addrs[addr]; ok {
+		ka.LastAttempt = time.Now()
+	}
+}
+
+// 연결(핸드셰이크)에 성공한 주소
+func (pm *PeerManager) MarkGood(addr string) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	now := time.Now()
+	ka, ok := pm.addrs[addr]
+	if !ok {
+		ka = &KnownAddress{Addr: addr}
+		pm.addrs[addr] = ka
+	}
+	ka.LastSeen = now
+	ka.LastSuccess = now
+	ka.Failures = 0
+}
+
+// 연결에 실패한 주소. 연속 실패가 maxAddrFailures에 도달하면 목록에서 제거 (seed는 제외)
+func (pm *PeerManager) MarkFailed(addr string) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	ka, ok := pm.addrs[addr]
+	if !ok {
+		return
+	}
+	ka.Failures++
+	if ka.Failures >= maxAddrFailures && !pm.seeds[addr] {
+		delete(pm.addrs, addr)
+		logP2P.Debug("Evicted peer address", "addr", addr, "failures", ka.Failures)
+	}
+}
+
+// 주소를 목록에서 제거 (자기 자신의 주소 등)
+func (pm *PeerManager) Remove(addr string) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	delete(pm.addrs, addr)
+}
+
+// 'addr' 메시지로 알려줄 주소 목록 (최근에 확인된 주소부터 최대 max개)
+func (pm *PeerManager) Addresses(max int) []*KnownAddress {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	addrs := make([]*KnownAddress, 0, len(pm.addrs))
+	for _, ka := range pm.addrs {
+		copied := *ka
+		addrs = append(addrs, &copied)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].LastSeen.After(addrs[j].LastSeen) })
+
+	if len(addrs) > max {
+		addrs = addrs[:max]
+	}
+	return addrs
+}
+
+// 연결을 시도할 주소 목록
+// 실패한 주소는 실패 횟수에 비례해 일정 시간 동안 제외하고, 나머지는 무작위 순서로 반환
+// (계속 실패하는 seed도 maxAddrFailures배보다 오래 기다리지는 않음)
+func (pm *PeerManager) Candidates(exclude func(addr string) bool) []string {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	now := time.Now()
+	var candidates []string
+	for addr, ka := range pm.addrs {
+		if exclude(addr) {
+			continue
+		}
+		if ka.Failures > 0 && now.Sub(ka.LastAttempt) < time.Duration(min(ka.Failures, maxAddrFailures))*addrRetryBackoff {
+			continue
+		}
+		candidates = append(candidates, addr)
+	}
+
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates
+}
+
+func (pm *PeerManager) Len() int {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	return len(pm.addrs)
+}
+
+// 오래 소식이 없는 주소를 제거
+func (pm *PeerManager) Evict() {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	pm.evict()
+}
+
+func (pm *PeerManager) evict() {
+	cutoff := time.Now().Add(-addrExpiry)
+	for addr, ka := range pm.addrs {
+		if pm.seeds[addr] {
+			continue
+		}
+		if ka.LastSeen.Before(cutoff) || ka.Failures >= maxAddrFailures {
+			delete(pm.addrs, addr)
+		}
+	}
+	for len(pm.addrs) > maxKnownAddrs {
+		if !pm.evictOldest() {
+			break
+		}
+	}
+}
+
+// 가장 오래전에 확인된 주소 하나를 제거 (seed는 제외). 제거할 주소가 없으면 false
+func (pm *PeerManager) evictOldest() bool {
+	var oldest *KnownAddress
+	for _, ka := range pm.addrs {
+		if pm.seeds[ka.Addr] {
+			continue
+		}
+		if oldest == nil || ka.LastSeen.Before(oldest.LastSeen) {
+			oldest = ka
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	delete(pm.addrs, oldest.Addr)
+	return true
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// seed 주소는 연결에 계속 실패해도 목록에 남고, 대기 시간이 지나면 다시 후보가 됨
+func TestSeedAddressIsNotEvicted(t *testing.T) {
+	pm, err := NewPeerManager(filepath.Join(t.TempDir(), "peers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.AddSeed("seed:1")
+	pm.AddAddress("peer:1", "", time.Now())
+
+	for range maxAddrFailures * 2 {
+		pm.MarkAttempt("seed:1")
+		pm.MarkFailed("seed:1")
+		pm.MarkAttempt("peer:1")
+		pm.MarkFailed("peer:1")
+	}
+	pm.Evict()
+
+	addrs := pm.Addresses(maxKnownAddrs)
+	if len(addrs) != 1 || addrs[0].Addr != "seed:1" {
+		t.Fatalf("known addresses = %v, want only seed:1", addrs)
+	}
+
+	none := func(string) bool { return false }
+	if got := pm.Candidates(none); len(got) != 0 {
+		t.Fatalf("candidates right after failures = %v, want none", got)
+	}
+
+	// 대기 시간은 maxAddrFailures배에서 멈춤
+	pm.lock.Lock()
+	pm.addrs["seed:1"].LastAttempt = time.Now().Add(-maxAddrFailures * addrRetryBackoff)
+	pm.lock.Unlock()
+	if got := pm.Candidates(none); len(got) != 1 || got[0] != "seed:1" {
+		t.Fatalf("candidates after backoff = %v, want seed:1", got)
+	}
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	pingInterval      = 30 * time.Second // 피어에게 'ping'을 보내는 간격
+	pingTimeout       = 20 * time.Second // 이 시간 안에 'pong'이 오지 않으면 연결 종료
+	pingCheckInterval = 5 * time.Second  // ping 전송과 타임아웃을 확인하는 주기
+)
+
+type Ping struct {
+	Nonce uint64 // 'pong'에 그대로 돌려받아 어떤 ping에 대한 응답인지 확인
+}
+
+type Pong struct {
+	Nonce uint64
+}
+
+// 'getpeerinfo' RPC로 보여주는 피어 정보
+type PeerInfo struct {
+	Addr        string
+	ListenAddr  string
+	Inbound     bool
+	NodeID      string // 암호화된 연결이면 상대방의 노드 ID
+	Version     int64
+	UserAgent   string
+	Services    uint64
+	BestHeight  int64
+	BanScore    int
+	ConnectedAt time.Time
+	PingRTT     time.Duration // 마지막으로 측정한 왕복 시간 (측정 전이면 0)
+	MinPingRTT  time.Duration // 측정한 왕복 시간 중 최소값
+	PingWait    time.Duration // 응답을 기다리고 있는 ping을 보낸 뒤 지난 시간
+	MsgsRecv    uint64
+	MsgsSent    uint64
+	BytesRecv   uint64
+	BytesSent   uint64
+	Throttled   uint64 // 예산을 넘겨 읽기를 멈춘 횟수
+}
+
+type GetPeerInfoResponse struct {
+	Peers []PeerInfo
+}
+
+// 0이 아닌 ping nonce (0은 응답을 기다리는 ping이 없다는 뜻)
+func newPingNonce() uint64 {
+	for {
+		if nonce := newNodeNonce(); nonce != 0 {
+			return nonce
+		}
+	}
+}
+
+// 주기적으로 피어들에게 'ping'을 보내고, 응답하지 않는 피어의 연결을 끊음
+// ping을 지원하지 않는 이전 버전의 피어는 건너뜀
+func (s *Server) pingLoop() {
+	for s.sleep(pingCheckInterval) {
+
+		now := time.Now()
+		for _, peer := range s.connectedPeers() {
+			if peer.Version().Version < pingVersion {
+				continue
+			}
+
+			nonce, sent := peer.pendingPing()
+			if nonce != 0 {
+				if now.Sub(sent) > pingTimeout {
+					s.disconnectPeer(peer, fmt.Sprintf("ping timeout (no pong in %s)", pingTimeout))
+				}
+				continue
+			}
+			if now.Sub(sent) >= pingInterval {
+				s.sendPing(peer, now)
+			}
+		}
+	}
+}
+
+// 'ping' 메시지 전송
+func (s *Server) sendPing(p *Peer, now time.Time) {
+	nonce := newPingNonce()
+	p.startPing(nonce, now)
+	s.sendMessage(p, "ping", Ping{Nonce: nonce})
+}
+
+// 'ping' 메시지 처리. 같은 nonce로 'pong' 응답
+func (s *Server) handlePing(p *Peer, payload []byte) {
+	var ping Ping
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&ping); err != nil {
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed ping: %v", err))
+		return
+	}
+	s.sendMessage(p, "pong", Pong{Nonce: ping.Nonce})
+}
+
+// 'pong' 메시지 처리. 기다리던 ping의 응답이면 왕복 시간을 기록
+func (s *Server) handlePong(p *Peer, payload []byte) {
+	var pong Pong
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&pong); err != nil {
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed pong: %v", err))
+		return
+	}
+
+	rtt, ok := p.finishPing(pong.Nonce, time.Now())
+	if !ok {
+		logP2P.Debug("Unexpected pong, ignoring", "peer", p.String(), "nonce", pong.Nonce)
+		return
+	}
+	logP2P.Debug("Ping", "peer", p.String(), "rtt", rtt)
+}
+
+// 연결된 피어 정보 조회
+func (s *Server) rpcGetPeerInfo() RPCResponse {
+	now := time.Now()
+	s.peersLock.RLock()
+	peers := make([]PeerInfo, 0, len(s.peers))
+	for _, peer := range s.peers {
+		peers = append(peers, peer.info(now))
+	}
+	s.peersLock.RUnlock()
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ConnectedAt.Before(peers[j].ConnectedAt) })
+
+	return RPCResponse{
+		Success: true,
+		Data:    gobEncode(GetPeerInfoResponse{Peers: peers}),
+	}
+}
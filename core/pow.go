@@ -3,10 +3,12 @@ package core
 import (
 	"bytes"
 	"crypto/sha256"
-	"fmt"
 	"math"
 	"math/big"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // 난이도 값(여기서는 16bit, 즉 앞의 0이 16개)
@@ -16,6 +18,9 @@ const targetBits = 16
 // Nonce의 최대값 (오버플로우 방지)
 const maxNonce = math.MaxInt64
 
+// 채굴 진행 상황을 debug 로그로 남기는 간격 (시도한 nonce 수)
+const powProgressInterval = 1 << 20
+
 type ProofOfWork struct {
 	block  *Block   // 검증할 블록
 	target *big.Int // 목표값 (이 값보다 작은 해시를 찾아야 함)
@@ -35,14 +40,19 @@ func NewProofOfWork(b *Block) *ProofOfWork {
 // PoW를 위한 데이터 준비 (Block -> []byte)
 // 해시 계산에는 Nonce와 Difficulty(targetBits)가 모두 포함되어야 함
 func (pow *ProofOfWork) prepareData(nonce int) []byte {
+	return powData(pow.block.PrevBlockHash, pow.block.HashTransactions(), pow.block.Timestamp, nonce, pow.block.Height)
+}
+
+// 해시 계산에 들어가는 값들은 모두 헤더에 있으므로, 블록 본문 없이 헤더만으로도 PoW를 검증할 수 있음
+func powData(prevBlockHash, txHash []byte, timestamp int64, nonce int, height int64) []byte {
 	data := bytes.Join(
 		[][]byte{
-			pow.block.PrevBlockHash,
-			pow.block.HashTransactions(),
-			[]byte(strconv.FormatInt(pow.block.Timestamp, 10)),
+			prevBlockHash,
+			txHash,
+			[]byte(strconv.FormatInt(timestamp, 10)),
 			[]byte(strconv.FormatInt(int64(targetBits), 10)),
 			[]byte(strconv.FormatInt(int64(nonce), 10)),
-			[]byte(strconv.FormatInt(pow.block.Height, 10)),
+			[]byte(strconv.FormatInt(height, 10)),
 		},
 		[]byte{},
 	)
@@ -53,8 +63,9 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 	var hashInt big.Int
 	var hash [32]byte
 	nonce := 0
+	start := time.Now()
 
-	fmt.Printf(`Mining the block...`)
+	logMiner.Debug("Mining block", "height", pow.block.Height, "txs", len(pow.block.Transactions), "target_bits", targetBits)
 
 	for nonce < maxNonce {
 		// nonce를 설정하여 데이터 준비
@@ -68,12 +79,14 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 		// Cmp: hashInt < pow.target 이면 -1
 		if hashInt.Cmp(pow.target) == -1 {
 			// PoW는 target보다 작은 해시를 찾는 과정이므로, 이 경우 PoW 작업이 완료
-			fmt.Printf("Found! Hash: %x\n", hash)
+			logMiner.Info("Found proof of work", "height", pow.block.Height, hexAttr("hash", hash[:]), "nonce", nonce, "elapsed", time.Since(start).Round(time.Millisecond))
 			break
 		} else {
 			// 못 찾았으면 Nonce를 증가시켜 다시 진행
 			nonce++
-			fmt.Printf("\rHashing... %d (Target bits: %d)", nonce, targetBits)
+			if nonce%powProgressInterval == 0 {
+				logMiner.Debug("Hashing", "height", pow.block.Height, "nonce", nonce)
+			}
 		}
 	}
 
@@ -81,6 +94,48 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 	return nonce, hash[:]
 }
 
+// threads개의 고루틴이 nonce를 나누어 탐색 (i번째 고루틴은 i, i+threads, i+2*threads, ...)
+// 한 고루틴이 답을 찾으면 나머지는 멈춤. threads가 1 이하이면 Run과 같음
+func (pow *ProofOfWork) RunParallel(threads int) (int, []byte) {
+	if threads <= 1 {
+		return pow.Run()
+	}
+	start := time.Now()
+
+	logMiner.Debug("Mining block", "height", pow.block.Height, "txs", len(pow.block.Transactions), "target_bits", targetBits, "threads", threads)
+
+	var found atomic.Bool
+	var resultNonce int
+	var resultHash []byte
+	var wg sync.WaitGroup
+	for first := 0; first < threads; first++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var hashInt big.Int
+			for nonce := first; nonce < maxNonce-threads && !found.Load(); nonce += threads {
+				hash := sha256.Sum256(pow.prepareData(nonce))
+				hashInt.SetBytes(hash[:])
+				if hashInt.Cmp(pow.target) == -1 {
+					// 동시에 찾은 경우 먼저 기록한 답을 사용
+					if found.CompareAndSwap(false, true) {
+						resultNonce, resultHash = nonce, hash[:]
+					}
+					return
+				}
+				if first == 0 && (nonce/threads)%powProgressInterval == 0 && nonce > 0 {
+					logMiner.Debug("Hashing", "height", pow.block.Height, "nonce", nonce)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	logMiner.Info("Found proof of work", "height", pow.block.Height, hexAttr("hash", resultHash), "nonce", resultNonce, "elapsed", time.Since(start).Round(time.Millisecond), "threads", threads)
+	return resultNonce, resultHash
+}
+
 func (pow *ProofOfWork) Validate() bool {
 	var hashInt big.Int
 
@@ -90,8 +145,21 @@ func (pow *ProofOfWork) Validate() bool {
 	hash := sha256.Sum256(data)
 	hashInt.SetBytes(hash[:])
 
-	// Hash와 target을 비교
-	isValid := hashInt.Cmp(pow.target) == -1
+	// Hash와 target을 비교하고, 블록에 기록된 해시와 같은지 확인
+	isValid := hashInt.Cmp(pow.target) == -1 && bytes.Equal(hash[:], pow.block.Hash)
 
 	return isValid
 }
+
+// 블록 본문 없이 헤더만으로 PoW 검증 (headers-first 동기화에서 사용)
+func (h *BlockHeader) ValidatePoW() bool {
+	var hashInt big.Int
+
+	target := big.NewInt(1)
+	target.Lsh(target, uint(256-targetBits))
+
+	hash := sha256.Sum256(powData(h.PrevBlockHash, h.TxHash, h.Timestamp, h.Nonce, h.Height))
+	hashInt.SetBytes(hash[:])
+
+	return hashInt.Cmp(target) == -1 && bytes.Equal(hash[:], h.Hash)
+}
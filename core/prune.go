@@ -0,0 +1,134 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// prune 모드에서도 최근 블록 N개의 본문은 항상 보관
+const pruneRetentionDepth = 100
+
+// 본문이 삭제된 가장 높은 블록 높이 (이 높이 이하의 블록은 헤더만 남음)
+const prunedHeightKey = "prunedheight"
+
+// 본문이 남아있는 블록들의 전체 크기 (바이트, metadata)
+// 블록을 연결하거나 끊거나 prune할 때 갱신하여, prune 검사에서 블록 헤더를 모두 읽지 않도록 함
+const blockDataSizeKey = "blockdatasize"
+
+// prune 모드 설정. targetMB 만큼만 블록 본문을 보관 (0이면 prune 하지 않음)
+func (bc *Blockchain) SetPruneTarget(targetMB int64) {
+	bc.pruneTarget = targetMB * 1024 * 1024
+}
+
+func (bc *Blockchain) IsPruneMode() bool {
+	return bc.pruneTarget > 0
+}
+
+// 본문이 삭제된 가장 높은 블록 높이 (0이면 모든 블록 본문을 가지고 있음)
+func (bc *Blockchain) PrunedHeight() (int64, error) {
+	var height int64
+
+	err := bc.store.View(func(tx StorageTx) error {
+		height = readPrunedHeight(tx)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return height, nil
+}
+
+func readPrunedHeight(tx StorageTx) int64 {
+	v := tx.GetMeta(prunedHeightKey)
+	if v == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(v))
+}
+
+func readBlockDataSize(tx StorageTx) int64 {
+	v := tx.GetMeta(blockDataSizeKey)
+	if v == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(v))
+}
+
+func writeBlockDataSize(tx StorageTx, size int64) error {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(size))
+	return tx.PutMeta(blockDataSizeKey, v)
+}
+
+// 블록 본문을 저장하거나 지울 때 전체 크기를 갱신
+func addBlockDataSize(tx StorageTx, delta int64) error {
+	return writeBlockDataSize(tx, readBlockDataSize(tx)+delta)
+}
+
+// 보관 용량을 넘는 오래된 블록 본문을 삭제 (AddBlock이 addLock을 잡은 채로 호출)
+// 헤더, 높이 인덱스, UTXO Set은 그대로 두므로 새 블록과 트랜잭션 검증에는 영향이 없음
+// 블록의 undo 데이터도 본문과 함께 삭제하므로, prune된 높이 아래로는 reorg 할 수 없음
+func (bc *Blockchain) Prune() error {
+	if !bc.IsPruneMode() {
+		return nil
+	}
+
+	// 보관 용량을 넘었고, 보관 깊이 밖에 본문이 남은 블록이 있을 때만 삭제
+	var check bool
+	err := bc.store.View(func(tx StorageTx) error {
+		tip, err := tipHeight(tx)
+		if err != nil {
+			return err
+		}
+		check = readBlockDataSize(tx) > bc.pruneTarget && tip-pruneRetentionDepth > readPrunedHeight(tx)
+		return nil
+	})
+	if err != nil || !check {
+		return err
+	}
+
+	return bc.store.Update(func(tx StorageTx) error {
+		tip, err := tipHeight(tx)
+		if err != nil {
+			return err
+		}
+		prunedHeight := readPrunedHeight(tx)
+		total := readBlockDataSize(tx)
+
+		// 오래된 블록부터, 보관 용량 이하가 되거나 보관 깊이에 닿을 때까지 삭제
+		pruned := 0
+		for height := prunedHeight + 1; total > bc.pruneTarget && height <= tip-pruneRetentionDepth; height++ {
+			hash := tx.GetIndex(heightsIndex, heightKey(height))
+			if hash == nil {
+				return fmt.Errorf("Block at height %d not found in height index", height)
+			}
+			header, err := DeserializeBlockHeader(tx.GetIndex(headersIndex, hash))
+			if err != nil {
+				return err
+			}
+			if err := tx.DeleteBlock(header.Hash); err != nil {
+				return err
+			}
+			if err := tx.DeleteIndex(undoIndex, header.Hash); err != nil {
+				return err
+			}
+			total -= int64(header.Size)
+			prunedHeight = height
+			pruned++
+		}
+
+		if pruned == 0 {
+			return nil
+		}
+
+		logChain.Info("Pruned blocks", "count", pruned, "pruned_height", prunedHeight)
+
+		if err := writeBlockDataSize(tx, total); err != nil {
+			return err
+		}
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, uint64(prunedHeight))
+		return tx.PutMeta(prunedHeightKey, v)
+	})
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 피어별 자원 제한
+const (
+	maxInboundPerIP    = 8                // 한 IP에서 동시에 들어올 수 있는 연결 수 (루프백 제외)
+	peerMsgRate        = 200              // 피어별 초당 처리하는 메시지 수
+	peerMsgBurst       = 1000             // 한 번에 몰려도 지연 없이 처리하는 메시지 수
+	peerByteRate       = 4 * 1024 * 1024  // 피어별 초당 처리하는 바이트 수
+	peerByteBurst      = 32 * 1024 * 1024 // 한 번에 몰려도 지연 없이 처리하는 바이트 수 (최대 페이로드 하나는 항상 허용)
+	peerRecvQueueSize  = 64               // 읽었지만 아직 처리하지 않은 메시지 수 (가득 차면 읽기를 멈춤)
+	peerSendQueueWait  = 5 * time.Second  // 보낼 메시지 큐가 이 시간 동안 가득 차 있으면 연결 종료
+	maxThrottleDelay   = 10 * time.Second // 예산 초과 시 한 번에 읽기를 멈추는 최대 시간
+	throttleLogMinimum = time.Second      // 이보다 긴 지연만 로그에 남김
+)
+
+// 토큰 버킷 방식의 속도 제한
+// rate만큼 초당 토큰이 채워지고 burst까지 쌓임. 토큰이 모자라면 모자란 만큼 기다려야 함
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// n개의 토큰을 사용하고, 토큰이 채워질 때까지 기다려야 하는 시간을 반환
+// (토큰이 음수가 될 수 있으므로 예산을 넘긴 만큼 다음 메시지가 늦어짐)
+func (rl *rateLimiter) reserve(n float64, now time.Time) time.Duration {
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > rl.burst {
+		rl.tokens = rl.burst
+	}
+	rl.last = now
+
+	rl.tokens -= n
+	if rl.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+}
+
+// inbound 연결 수 제한
+// accept 시점부터 연결이 닫힐 때까지 세므로, 핸드셰이크 중인 연결도 포함됨
+type connLimiter struct {
+	max   int // 최대 inbound 연결 수
+	total int
+	perIP map[string]int
+	lock  sync.Mutex
+}
+
+func newConnLimiter(max int) *connLimiter {
+	return &connLimiter{max: max, perIP: make(map[string]int)}
+}
+
+// 연결을 받을 수 있으면 수를 늘리고 ""를, 아니면 거부 이유를 반환
+// 루프백 주소는 IP별 제한에서 제외 (로컬 테스트 네트워크는 모두 127.0.0.1에서 연결함)
+func (cl *connLimiter) acquire(host string) string {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	if cl.total >= cl.max {
+		return "too many inbound connections"
+	}
+	if !isLoopback(host) && cl.perIP[host] >= maxInboundPerIP {
+		return "too many connections from this IP"
+	}
+	cl.total++
+	cl.perIP[host]++
+	return ""
+}
+
+func (cl *connLimiter) release(host string) {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	cl.total--
+	if cl.perIP[host]--; cl.perIP[host] <= 0 {
+		delete(cl.perIP, host)
+	}
+}
+
+// 현재 inbound 연결 수
+func (cl *connLimiter) count() int {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+	return cl.total
+}
+
+// "host:port"의 host (포트가 없으면 그대로)
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// 루프백 IP인지 확인 (호스트 이름은 루프백으로 보지 않음)
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// 노드 전체의 네트워크 카운터 (모니터링용)
+type netCounters struct {
+	inboundAccepted atomic.Uint64 // 받아들인 inbound 연결
+	inboundRejected atomic.Uint64 // 차단, 연결 수 제한, TLS 실패로 거부한 inbound 연결
+	msgsRecv        atomic.Uint64
+	msgsSent        atomic.Uint64
+	bytesRecv       atomic.Uint64
+	bytesSent       atomic.Uint64
+	throttled       atomic.Uint64 // 예산을 넘겨 읽기를 멈춘 횟수
+	throttledNanos  atomic.Int64  // 읽기를 멈춘 총 시간
+	slowPeers       atomic.Uint64 // 보낼 메시지를 비우지 못해 연결을 끊은 피어 수
+}
+
+// 피어별 트래픽 카운터
+type peerCounters struct {
+	msgsRecv  atomic.Uint64
+	msgsSent  atomic.Uint64
+	bytesRecv atomic.Uint64
+	bytesSent atomic.Uint64
+	throttled atomic.Uint64
+}
+
+// 'getnettotals' RPC 응답
+type NetTotals struct {
+	InboundAccepted uint64
+	InboundRejected uint64
+	InboundConns    int // 현재 inbound 연결 수 (핸드셰이크 중인 연결 포함)
+	Peers           int // 핸드셰이크를 마친 피어 수
+	MsgsRecv        uint64
+	MsgsSent        uint64
+	BytesRecv       uint64
+	BytesSent       uint64
+	Throttled       uint64
+	ThrottledTime   time.Duration
+	SlowPeers       uint64
+}
+
+// 네트워크 카운터 조회
+func (s *Server) rpcGetNetTotals() RPCResponse {
+	c := s.counters
+	totals := NetTotals{
+		InboundAccepted: c.inboundAccepted.Load(),
+		InboundRejected: c.inboundRejected.Load(),
+		InboundConns:    s.inboundConns.count(),
+		Peers:           len(s.connectedPeers()),
+		MsgsRecv:        c.msgsRecv.Load(),
+		MsgsSent:        c.msgsSent.Load(),
+		BytesRecv:       c.bytesRecv.Load(),
+		BytesSent:       c.bytesSent.Load(),
+		Throttled:       c.throttled.Load(),
+		ThrottledTime:   time.Duration(c.throttledNanos.Load()),
+		SlowPeers:       c.slowPeers.Load(),
+	}
+	return RPCResponse{Success: true, Data: gobEncode(totals)}
+}
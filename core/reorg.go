@@ -0,0 +1,292 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// 블록 undo 데이터 (key: 블록 해시, value: 블록이 사용한 출력 목록)
+// reorg로 블록을 끊을 때 사용된 출력을 UTXO Set에 되돌리는 데 사용. 블록 본문과 함께 prune됨
+const undoIndex = "undo"
+
+// 블록의 트랜잭션이 사용한 출력 (undo 데이터의 항목)
+type spentOutput struct {
+	Txid  []byte
+	Entry UTXOEntry
+}
+
+func putUndo(tx StorageTx, blockHash []byte, spent []spentOutput) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(spent); err != nil {
+		return err
+	}
+	return tx.PutIndex(undoIndex, blockHash, buf.Bytes())
+}
+
+// 블록이 사용한 출력
+// undo 데이터가 없으면(undo 데이터를 기록하기 전에 추가된 블록) 입력이 참조하는 트랜잭션을 찾아 만듦
+func (bc *Blockchain) readUndo(tx StorageTx, block *Block) ([]spentOutput, error) {
+	if data := tx.GetIndex(undoIndex, block.Hash); data != nil {
+		var spent []spentOutput
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&spent); err != nil {
+			return nil, fmt.Errorf("undo data of block %x: %w", block.Hash, err)
+		}
+		return spent, nil
+	}
+
+	var spent []spentOutput
+	for _, t := range block.Transactions {
+		if t.IsCoinbase() {
+			continue
+		}
+		for _, vin := range t.Vin {
+			prev, err := bc.findTransaction(tx, vin.Txid)
+			if err != nil {
+				return nil, fmt.Errorf("rebuilding undo data of block %x: %w", block.Hash, err)
+			}
+			if vin.Vout < 0 || vin.Vout >= len(prev.VOut) {
+				return nil, fmt.Errorf("rebuilding undo data of block %x: output %x:%d not found", block.Hash, vin.Txid, vin.Vout)
+			}
+			spent = append(spent, spentOutput{Txid: vin.Txid, Entry: UTXOEntry{Index: vin.Vout, Output: prev.VOut[vin.Vout]}})
+		}
+	}
+	return spent, nil
+}
+
+// 헤더 체인 끝까지의 누적 작업량 (블록 하나의 작업량은 2^targetBits번의 해시 계산)
+// 난이도가 고정이므로 높이에 비례하지만, 갈래를 비교할 때는 항상 이 값을 사용
+func chainWork(height int64) *big.Int {
+	work := new(big.Int).Lsh(big.NewInt(1), targetBits)
+	return work.Mul(work, big.NewInt(height))
+}
+
+// a까지의 갈래가 b까지의 갈래보다 작업량이 많은지 (같으면 먼저 받은 b를 유지)
+func heavierThan(a, b *BlockHeader) bool {
+	return chainWork(a.Height).Cmp(chainWork(b.Height)) > 0
+}
+
+// reorg 중 연결하지 못한 블록
+// 블록 자체가 잘못되었으면 errors.Is(err, ErrInvalidBlock)
+type ReorgError struct {
+	Block *Block
+	Err   error
+}
+
+func (e *ReorgError) Error() string {
+	return fmt.Sprintf("reorganizing to block %x at height %d: %v", e.Block.Hash, e.Block.Height, e.Err)
+}
+
+func (e *ReorgError) Unwrap() error {
+	return e.Err
+}
+
+// 메인 체인을 branch로 바꿈 (branch[0]의 부모는 메인 체인에 있어야 함)
+// 갈림 지점 위의 메인 체인 블록들을 tip부터 끊고(UTXO Set을 되돌림) branch의 블록들을 검증하며 연결
+// 한 저장소 트랜잭션에서 처리하므로, 블록 하나라도 잘못되면 아무것도 바뀌지 않음 (*ReorgError)
+// (잘못된 블록은 무효한 블록으로 기록하여 헤더 체인에서 제외)
+// branch가 tip보다 작업량이 많지 않으면 에러. 끊은 블록들을 tip부터 순서대로 반환
+func (bc *Blockchain) Reorganize(branch []*Block) ([]*Block, error) {
+	if len(branch) == 0 {
+		return nil, errors.New("empty branch")
+	}
+	for i := 1; i < len(branch); i++ {
+		if !bytes.Equal(branch[i].PrevBlockHash, branch[i-1].Hash) || branch[i].Height != branch[i-1].Height+1 {
+			return nil, &ReorgError{Block: branch[i], Err: fmt.Errorf("%w: block does not follow %x", ErrInvalidBlock, branch[i-1].Hash)}
+		}
+	}
+
+	bc.addLock.Lock()
+	defer bc.addLock.Unlock()
+
+	first, last := branch[0], branch[len(branch)-1]
+	var disconnected []*Block
+
+	err := bc.store.Update(func(tx StorageTx) error {
+		forkData := tx.GetIndex(headersIndex, first.PrevBlockHash)
+		if forkData == nil {
+			return fmt.Errorf("parent %x of block %x is not on the main chain", first.PrevBlockHash, first.Hash)
+		}
+		fork, err := DeserializeBlockHeader(forkData)
+		if err != nil {
+			return err
+		}
+		if first.Height != fork.Height+1 {
+			return fmt.Errorf("block %x at height %d does not follow %x at height %d", first.Hash, first.Height, fork.Hash, fork.Height)
+		}
+		if fork.Height < readPrunedHeight(tx) {
+			return fmt.Errorf("cannot reorganize below pruned height %d: %w", readPrunedHeight(tx), ErrBlockPruned)
+		}
+
+		tip, err := DeserializeBlockHeader(tx.GetIndex(headersIndex, tx.GetTip()))
+		if err != nil {
+			return err
+		}
+		if !heavierThan(last.Header(), tip) {
+			return fmt.Errorf("branch ending at %x (height %d) is not heavier than tip %x (height %d)", last.Hash, last.Height, tip.Hash, tip.Height)
+		}
+
+		// 갈림 지점까지 메인 체인 블록을 끊음
+		for hash := tip.Hash; !bytes.Equal(hash, fork.Hash); {
+			blockData := tx.GetBlock(hash)
+			if blockData == nil {
+				return fmt.Errorf("disconnecting block %x: %w", hash, ErrBlockPruned)
+			}
+			block, err := DeserializeBlock(blockData)
+			if err != nil {
+				return err
+			}
+			if err := bc.disconnectBlock(tx, block); err != nil {
+				return fmt.Errorf("disconnecting block %x: %w", block.Hash, err)
+			}
+			disconnected = append(disconnected, block)
+			hash = block.PrevBlockHash
+		}
+
+		// 갈래의 블록을 AddBlock과 같은 규칙으로 검증하며 연결
+		for _, block := range branch {
+			if !NewProofOfWork(block).Validate() {
+				return &ReorgError{Block: block, Err: fmt.Errorf("%w: invalid PoW", ErrInvalidBlock)}
+			}
+			for _, t := range block.Transactions {
+				if err := bc.verifyTransaction(tx, t); err != nil {
+					return &ReorgError{Block: block, Err: fmt.Errorf("%w: transaction %x: %w", ErrInvalidBlock, t.ID, err)}
+				}
+			}
+			if err := bc.connectBlock(tx, block); err != nil {
+				return &ReorgError{Block: block, Err: err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		var reorgErr *ReorgError
+		if errors.As(err, &reorgErr) && errors.Is(err, ErrInvalidBlock) {
+			bc.invalidateBlock(reorgErr.Block)
+		}
+		return nil, err
+	}
+	bc.tip = last.Hash
+
+	if err := bc.Prune(); err != nil {
+		logChain.Warn("Prune failed", "err", err)
+	}
+
+	logChain.Info("Chain reorganized", "fork_height", first.Height-1, "disconnected", len(disconnected), "connected", len(branch),
+		hexAttr("tip", last.Hash), "height", last.Height)
+	return disconnected, nil
+}
+
+// 저장소 트랜잭션 안에서 tip 블록을 끊음
+// 블록이 만든 출력을 UTXO Set에서 지우고 사용한 출력을 되돌린 뒤, tip을 부모 블록으로 옮김
+// 블록의 헤더는 다시 이 갈래로 돌아올 수 있도록 동기화 헤더로 남기고, 본문과 undo 데이터는 지움
+func (bc *Blockchain) disconnectBlock(tx StorageTx, block *Block) error {
+	spent, err := bc.readUndo(tx, block)
+	if err != nil {
+		return err
+	}
+
+	// 블록 안의 트랜잭션은 서로의 출력을 사용하지 않으므로, 만든 출력은 그대로 지움
+	for _, t := range block.Transactions {
+		if err := tx.DeleteUTXO(t.ID); err != nil {
+			return err
+		}
+	}
+	for _, s := range spent {
+		if err := restoreUTXO(tx, s); err != nil {
+			return err
+		}
+	}
+
+	if err := unindexBlockTxs(tx, block); err != nil {
+		return err
+	}
+	if err := tx.DeleteIndex(undoIndex, block.Hash); err != nil {
+		return err
+	}
+	if err := addBlockDataSize(tx, -int64(len(tx.GetBlock(block.Hash)))); err != nil {
+		return err
+	}
+	if err := tx.DeleteBlock(block.Hash); err != nil {
+		return err
+	}
+	if err := tx.DeleteIndex(heightsIndex, heightKey(block.Height)); err != nil {
+		return err
+	}
+	if err := tx.DeleteIndex(headersIndex, block.Hash); err != nil {
+		return err
+	}
+	if err := tx.PutIndex(syncHeadersIndex, block.Hash, block.Header().Serialize()); err != nil {
+		return err
+	}
+	return tx.SetTip(block.PrevBlockHash)
+}
+
+// 사용된 출력을 UTXO Set에 되돌림 (출력 인덱스 순서 유지)
+func restoreUTXO(tx StorageTx, s spentOutput) error {
+	var entries []UTXOEntry
+	if data := tx.GetUTXO(s.Txid); data != nil {
+		var err error
+		if entries, err = decodeUTXOEntries(data); err != nil {
+			return err
+		}
+	}
+	entries = append(entries, s.Entry)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Index < entries[j].Index })
+
+	data, err := encodeUTXOEntries(entries)
+	if err != nil {
+		return err
+	}
+	return tx.PutUTXO(s.Txid, data)
+}
+
+// 버퍼에 모인 갈래의 블록들로 reorg 하고, 끊은 블록의 트랜잭션을 멤풀로 되돌림. 성공하면 true
+// 잘못된 블록이 있으면 그 블록을 보낸 피어에게 책임을 물음
+func (s *Server) reorganize(branch []*bufferedBlock) bool {
+	blocks := make([]*Block, len(branch))
+	for i, b := range branch {
+		blocks[i] = b.block
+	}
+
+	disconnected, err := s.bc.Reorganize(blocks)
+	if err != nil {
+		logChain.Warn("Chain reorganization failed", "err", err)
+
+		var reorgErr *ReorgError
+		if errors.As(err, &reorgErr) && errors.Is(err, ErrInvalidBlock) {
+			for _, b := range branch {
+				if b.block == reorgErr.Block {
+					s.misbehaving(b.from, scoreInvalid, err.Error())
+				}
+			}
+		}
+		return false
+	}
+
+	for _, b := range branch {
+		s.mempool.Clear(b.block)
+		b.from.updateBestHeight(b.block.Height)
+	}
+
+	// 끊은 블록의 트랜잭션 중 새 체인에서도 유효한 것은 다시 채굴될 수 있도록 멤풀에 넣음
+	utxoSet := UTXOSet{s.bc}
+	restored := 0
+	for _, block := range disconnected {
+		for _, tx := range block.Transactions {
+			if !s.spendsUnspentOutputs(utxoSet, tx) || s.bc.VerifyTransaction(tx) != nil {
+				continue
+			}
+			if s.mempool.Add(tx) == nil {
+				restored++
+			}
+		}
+	}
+	if restored > 0 {
+		logMempool.Info("Returned transactions from disconnected blocks to mempool", "count", restored)
+	}
+	return true
+}
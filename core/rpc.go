@@ -2,22 +2,44 @@ package core
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/gob"
 	"fmt"
 	"io"
-	"log"
 	"net"
+	"time"
 )
 
 const (
 	rpcCmdGetBalance    = "getbalance"
 	rpcCmdSend          = "sendtx"
 	rpcCmdGetBestHeight = "getbestheight"
+	rpcCmdAddNode       = "addnode"
+	rpcCmdDisconnect    = "disconnectnode"
+	rpcCmdListBanned    = "listbanned"
+	rpcCmdSetBan        = "setban"
+	rpcCmdGetPeerInfo   = "getpeerinfo"
+	rpcCmdGetNetTotals  = "getnettotals"
+	rpcCmdStop          = "stop"
+	rpcCmdSetLogLevel   = "setloglevel"
+)
+
+// 연결 후 이 시간 안에 요청을 보내지 않으면 연결 종료 (종료할 때 요청을 기다리며 멈추지 않도록)
+const rpcReadTimeout = 10 * time.Second
+
+// addnode 명령
+const (
+	addNodeAdd    = "add"    // 목록에 추가하고 연결 유지
+	addNodeRemove = "remove" // 목록에서 제거 (연결은 유지)
+	addNodeOneTry = "onetry" // 한 번만 연결 시도
 )
 
 type RPCRequest struct {
-	Command []byte // 12바이트
-	Payload []byte // GOB
+	Command  []byte // 명령어 문자열
+	Payload  []byte // GOB
+	User     string // 노드에 RPC 사용자가 설정된 경우에만 확인
+	Password string
 }
 
 type GetBalanceRequest struct {
@@ -30,8 +52,28 @@ type SendRequest struct {
 	Amount int
 }
 
+type AddNodeRequest struct {
+	Addr    string
+	Command string // "add", "remove", "onetry"
+}
+
+type DisconnectNodeRequest struct {
+	Addr string
+}
+
+type SetBanRequest struct {
+	Addr     string // "host:port" 또는 "host"
+	Command  string // "add" 또는 "remove"
+	Duration int64  // 차단 기간(초). 0이면 기본값(24시간)
+}
+
+type ListBannedResponse struct {
+	Bans []BanEntry
+}
+
 type RPCResponse struct {
 	Success bool
+	Code    string // 실패 원인 (rpcErr* 상수, errors.go). 성공했거나 원인을 구분하지 않는 실패면 빈 문자열
 	Message string
 	Data    []byte // GOB
 }
@@ -40,29 +82,14 @@ type GetBalanceResponse struct {
 	Balance int
 }
 
-func (s *Server) startRPCListener() {
-	ln, err := net.Listen(protocol, fmt.Sprintf("localhost:%s", s.rpcPort))
-	if err != nil {
-		log.Panic(err)
-	}
-	defer ln.Close()
-
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			log.Panic(err)
-		}
-		go s.handleRPCConnection(conn)
-	}
-}
-
 func (s *Server) handleRPCConnection(conn net.Conn) {
 	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(rpcReadTimeout))
 
 	var req RPCRequest
 	if err := gob.NewDecoder(conn).Decode(&req); err != nil {
 		if err != io.EOF {
-			log.Printf("Failed to decode RPC request: %v\n", err)
+			logRPC.Warn("Failed to decode request", "err", err)
 		}
 		return
 	}
@@ -70,8 +97,37 @@ func (s *Server) handleRPCConnection(conn net.Conn) {
 	command := bytesToCommand(req.Command)
 	payload := req.Payload
 
-	fmt.Printf("Received RPC command: %s\n", command)
+	logRPC.Debug("Received command", "command", command)
+
+	var response RPCResponse
+	if s.rpcAuthorized(req) {
+		// 처리 중 패닉이 발생해도 노드는 계속 실행하고 실패 응답을 보냄
+		response = s.recoverRPC(command, func() RPCResponse {
+			return s.dispatchRPC(command, payload)
+		})
+	} else {
+		logRPC.Warn("Rejected request with wrong credentials", "command", command, "remote", conn.RemoteAddr().String())
+		response = rpcError(fmt.Errorf("%w: wrong RPC user or password", ErrUnauthorized))
+	}
+
+	if err := gob.NewEncoder(conn).Encode(response); err != nil {
+		logRPC.Warn("Failed to send response", "command", command, "err", err)
+	}
+}
 
+// RPC 사용자가 설정되어 있으면 요청의 사용자 이름과 비밀번호를 확인
+// (해시를 비교하여 비교 시간이 길이나 내용에 따라 달라지지 않도록)
+func (s *Server) rpcAuthorized(req RPCRequest) bool {
+	if s.rpcUser == "" {
+		return true
+	}
+	userHash, wantUser := sha256.Sum256([]byte(req.User)), sha256.Sum256([]byte(s.rpcUser))
+	passHash, wantPass := sha256.Sum256([]byte(req.Password)), sha256.Sum256([]byte(s.rpcPassword))
+	return subtle.ConstantTimeCompare(userHash[:], wantUser[:])&subtle.ConstantTimeCompare(passHash[:], wantPass[:]) == 1
+}
+
+// 명령어에 맞는 RPC 핸들러 실행
+func (s *Server) dispatchRPC(command string, payload []byte) RPCResponse {
 	var response RPCResponse
 
 	switch command {
@@ -79,35 +135,48 @@ func (s *Server) handleRPCConnection(conn net.Conn) {
 		response = s.rpcGetBalance(payload)
 	case rpcCmdSend:
 		response = s.rpcSend(payload)
+	case rpcCmdAddNode:
+		response = s.rpcAddNode(payload)
+	case rpcCmdDisconnect:
+		response = s.rpcDisconnectNode(payload)
+	case rpcCmdListBanned:
+		response = s.rpcListBanned()
+	case rpcCmdSetBan:
+		response = s.rpcSetBan(payload)
+	case rpcCmdGetPeerInfo:
+		response = s.rpcGetPeerInfo()
+	case rpcCmdGetNetTotals:
+		response = s.rpcGetNetTotals()
+	case rpcCmdStop:
+		response = s.rpcStop()
+	case rpcCmdSetLogLevel:
+		response = s.rpcSetLogLevel(payload)
 	default:
-		response = RPCResponse{Success: false, Message: "Unknown RPC command"}
+		response = RPCResponse{Success: false, Code: rpcErrInvalidRequest, Message: "Unknown RPC command"}
 	}
 
-	if err := gob.NewEncoder(conn).Encode(response); err != nil {
-		log.Printf("Failed to send RPC response: %v\n", err)
-	}
+	return response
 }
 
 func (s *Server) rpcGetBalance(payload []byte) RPCResponse {
 	var req GetBalanceRequest
 
 	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&req); err != nil {
-		log.Panic(err)
+		return rpcError(fmt.Errorf("%w: getbalance: %v", ErrInvalidRequest, err))
 	}
 
-	if !ValidateAddress(req.Address) {
-		return RPCResponse{
-			Success: false,
-			Message: "Invalid address",
-		}
-	}
 	// address -> base58 decode -> version, checksum 부분 제거 -> pubKeyHash
-	pubKeyHash := Base58Decode([]byte(req.Address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
+	pubKeyHash, err := AddressToPubKeyHash(req.Address)
+	if err != nil {
+		return rpcError(err)
+	}
 
 	// UTXO Set에서 balance 조회
 	utxoSet := UTXOSet{Blockchain: s.bc}
-	balance := utxoSet.GetBalance(pubKeyHash)
+	balance, err := utxoSet.GetBalance(pubKeyHash)
+	if err != nil {
+		return rpcError(err)
+	}
 
 	resData := gobEncode(GetBalanceResponse{
 		Balance: balance,
@@ -123,36 +192,141 @@ func (s *Server) rpcGetBalance(payload []byte) RPCResponse {
 func (s *Server) rpcSend(payload []byte) RPCResponse {
 	var req SendRequest
 	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&req); err != nil {
-		log.Panic(err)
+		return rpcError(fmt.Errorf("%w: sendtx: %v", ErrInvalidRequest, err))
 	}
 
-	// 서버가 자신의 포트(p2p port)로 지갑 파일 로드
-	wallets, err := NewWallets(s.p2pPort)
+	// 유효성 검사
+	if !ValidateAddress(req.From) || !ValidateAddress(req.To) {
+		return rpcError(fmt.Errorf("%w: sender or recipient", ErrInvalidAddress))
+	}
+	if req.Amount <= 0 {
+		return rpcError(fmt.Errorf("%w: amount must be positive", ErrInvalidRequest))
+	}
+
+	// 서버의 데이터 디렉토리에서 지갑 파일 로드
+	wallets, err := NewWallets(s.dataDir.WalletFile())
 	if err != nil {
-		return RPCResponse{Success: false, Message: "Server wallet file not found"}
+		return rpcError(fmt.Errorf("loading wallets: %w", err))
 	}
 
 	wallet, ok := wallets.GetWallet(req.From)
 	if !ok {
-		return RPCResponse{Success: false, Message: "Sender wallet not found in this node's wallet file"}
-	}
-	// 유효성 검사
-	if !ValidateAddress(req.From) || !ValidateAddress(req.To) || req.Amount <= 0 {
-		return RPCResponse{Success: false, Message: "Invalid send request parameters"}
+		return rpcError(fmt.Errorf("%w: %s is not in this node's wallet file", ErrWalletNotFound, req.From))
 	}
 
 	// 트랜잭션 생성
 	tx, err := s.bc.NewTransaction(wallet, req.To, req.Amount)
 	if err != nil {
-		return RPCResponse{Success: false, Message: fmt.Sprintf("TX creation failed: %v", err)}
+		return rpcError(fmt.Errorf("TX creation failed: %w", err))
 	}
 
 	// 멤풀에 추가 및 다른 노드에 전파
-	if added := s.mempool.Add(tx); !added {
-
+	if err := s.mempool.Add(tx); err != nil {
+		return rpcError(fmt.Errorf("adding TX %x to mempool: %w", tx.ID, err))
 	}
-	// TODO: broadcast 로직 추가
-	s.broadcastTx(tx, s.nodeAddress)
+	s.broadcastTx(tx, nil)
 
 	return RPCResponse{Success: true, Message: fmt.Sprintf("TX %x sent to mempool.", tx.ID)}
 }
+
+// 피어를 수동으로 추가/제거하거나 한 번 연결
+func (s *Server) rpcAddNode(payload []byte) RPCResponse {
+	var req AddNodeRequest
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&req); err != nil {
+		return rpcError(fmt.Errorf("%w: addnode: %v", ErrInvalidRequest, err))
+	}
+	if req.Addr == "" {
+		return rpcError(fmt.Errorf("%w: node address is required", ErrInvalidRequest))
+	}
+	if req.Addr == s.nodeAddress {
+		return rpcError(fmt.Errorf("%w: cannot add this node itself", ErrInvalidRequest))
+	}
+
+	switch req.Command {
+	case addNodeAdd:
+		s.peersLock.Lock()
+		exists := s.addedNodes[req.Addr]
+		s.addedNodes[req.Addr] = true
+		s.peersLock.Unlock()
+		if exists {
+			return rpcError(fmt.Errorf("%w: node %s already added", ErrInvalidRequest, req.Addr))
+		}
+
+		// 바로 연결을 시도하고, 실패하면 다음 연결 유지 주기에 다시 시도
+		if err := s.connectManual(req.Addr); err != nil {
+			return RPCResponse{Success: true, Message: fmt.Sprintf("Node %s added, connection failed (will retry): %v", req.Addr, err)}
+		}
+		return RPCResponse{Success: true, Message: fmt.Sprintf("Node %s added", req.Addr)}
+
+	case addNodeRemove:
+		s.peersLock.Lock()
+		exists := s.addedNodes[req.Addr]
+		delete(s.addedNodes, req.Addr)
+		s.peersLock.Unlock()
+		if !exists {
+			return rpcError(fmt.Errorf("%w: node %s has not been added", ErrInvalidRequest, req.Addr))
+		}
+		return RPCResponse{Success: true, Message: fmt.Sprintf("Node %s removed", req.Addr)}
+
+	case addNodeOneTry:
+		if err := s.connectManual(req.Addr); err != nil {
+			return rpcError(fmt.Errorf("connection to %s failed: %w", req.Addr, err))
+		}
+		return RPCResponse{Success: true, Message: fmt.Sprintf("Connected to %s", req.Addr)}
+	}
+
+	return rpcError(fmt.Errorf("%w: unknown addnode command %q", ErrInvalidRequest, req.Command))
+}
+
+// 연결된 피어의 연결을 끊음
+func (s *Server) rpcDisconnectNode(payload []byte) RPCResponse {
+	var req DisconnectNodeRequest
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&req); err != nil {
+		return rpcError(fmt.Errorf("%w: disconnectnode: %v", ErrInvalidRequest, err))
+	}
+
+	peer := s.findPeer(req.Addr)
+	if peer == nil {
+		return rpcError(fmt.Errorf("%w: node %s is not connected", ErrInvalidRequest, req.Addr))
+	}
+
+	s.disconnectPeer(peer, "disconnectnode RPC")
+	return RPCResponse{Success: true, Message: fmt.Sprintf("Disconnected from %s", peer)}
+}
+
+// 차단 목록 조회
+func (s *Server) rpcListBanned() RPCResponse {
+	return RPCResponse{
+		Success: true,
+		Data:    gobEncode(ListBannedResponse{Bans: s.banManager.List()}),
+	}
+}
+
+// 주소를 차단하거나 차단 해제
+func (s *Server) rpcSetBan(payload []byte) RPCResponse {
+	var req SetBanRequest
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&req); err != nil {
+		return rpcError(fmt.Errorf("%w: setban: %v", ErrInvalidRequest, err))
+	}
+	if req.Addr == "" {
+		return rpcError(fmt.Errorf("%w: address is required", ErrInvalidRequest))
+	}
+
+	switch req.Command {
+	case "add":
+		if req.Duration < 0 {
+			return rpcError(fmt.Errorf("%w: ban duration must not be negative", ErrInvalidRequest))
+		}
+		s.banManager.Ban(req.Addr, time.Duration(req.Duration)*time.Second, "manually banned")
+		s.disconnectBanned()
+		return RPCResponse{Success: true, Message: fmt.Sprintf("Banned %s", req.Addr)}
+
+	case "remove":
+		if !s.banManager.Unban(req.Addr) {
+			return rpcError(fmt.Errorf("%w: %s is not banned", ErrInvalidRequest, req.Addr))
+		}
+		return RPCResponse{Success: true, Message: fmt.Sprintf("Unbanned %s", req.Addr)}
+	}
+
+	return rpcError(fmt.Errorf("%w: unknown setban command %q", ErrInvalidRequest, req.Command))
+}
@@ -0,0 +1,465 @@
+package core
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	scenarioBasePort      = 20000                  // 시나리오 노드의 포트 (가상 네트워크를 사용하므로 실제 포트는 열지 않음)
+	scenarioNetwork       = "regtest"              // 시나리오 노드가 사용하는 네트워크 (다른 네트워크와 섞이지 않도록. 난이도는 모든 네트워크가 같음)
+	scenarioConnectWait   = 15 * time.Second       // 노드들이 모두 연결될 때까지 기다리는 최대 시간
+	defaultAssertTimeout  = 10 * time.Second       // assert 단계가 조건이 맞을 때까지 기다리는 기본 시간
+	scenarioPollInterval  = 100 * time.Millisecond // 조건을 다시 확인하는 간격
+	defaultScenarioBlocks = 1                      // mine 단계의 기본 블록 수
+)
+
+// 시나리오 단계 종류
+const (
+	stepMine      = "mine"      // 노드에서 블록 채굴
+	stepSend      = "send"      // 노드의 지갑에서 다른 노드의 지갑으로 송금
+	stepPartition = "partition" // 네트워크를 그룹으로 나눔
+	stepHeal      = "heal"      // 파티션 해제
+	stepLink      = "link"      // 링크 특성 변경 (지연, 버림, 순서 바꿈)
+	stepWait      = "wait"      // 일정 시간 대기
+	stepAssert    = "assert"    // 노드 상태 확인
+)
+
+// 여러 노드를 가상 네트워크로 연결해 실행하고 단계별로 조작하며 상태를 확인하는 시나리오
+// 노드들은 모두 서로 연결되고(full mesh), 노드마다 채굴 보상과 송금에 사용하는 지갑이 하나씩 있음
+type Scenario struct {
+	Name   string         `json:"name"`
+	Seed   int64          `json:"seed"`             // 가상 네트워크의 난수 seed
+	Nodes  int            `json:"nodes"`            // 노드 수
+	Miners []int          `json:"miners,omitempty"` // 채굴 루프를 실행할 노드 (10초마다 채굴하므로 결과가 시간에 따라 달라짐)
+	Link   *ScenarioLink  `json:"link,omitempty"`   // 모든 링크의 기본 특성
+	Steps  []ScenarioStep `json:"steps"`
+}
+
+// 시나리오의 한 단계. Action에 따라 필요한 필드만 사용
+type ScenarioStep struct {
+	Action   string           `json:"action"`
+	Node     int              `json:"node,omitempty"`     // mine, send: 실행할 노드
+	Blocks   int              `json:"blocks,omitempty"`   // mine: 채굴할 블록 수 (기본 1)
+	To       int              `json:"to,omitempty"`       // send: 받는 노드
+	Amount   int              `json:"amount,omitempty"`   // send: 보낼 금액
+	Groups   [][]int          `json:"groups,omitempty"`   // partition: 노드 그룹 (어느 그룹에도 없는 노드들은 함께 한 그룹)
+	Nodes    []int            `json:"nodes,omitempty"`    // link, assert: 대상 노드 (비어 있으면 모든 노드)
+	Link     *ScenarioLink    `json:"link,omitempty"`     // link: 대상 노드들 사이의 링크 특성
+	Duration ScenarioDuration `json:"duration,omitempty"` // wait: 기다릴 시간, assert: 조건을 기다리는 최대 시간
+	Expect   *ScenarioExpect  `json:"expect,omitempty"`   // assert: 확인할 조건
+}
+
+// JSON에서 사용하는 링크 특성 (LinkConfig와 같음)
+type ScenarioLink struct {
+	Latency     ScenarioDuration `json:"latency,omitempty"`
+	Jitter      ScenarioDuration `json:"jitter,omitempty"`
+	DropRate    float64          `json:"drop_rate,omitempty"`
+	ReorderRate float64          `json:"reorder_rate,omitempty"`
+}
+
+func (l *ScenarioLink) config() LinkConfig {
+	return LinkConfig{
+		Latency:     time.Duration(l.Latency),
+		Jitter:      time.Duration(l.Jitter),
+		DropRate:    l.DropRate,
+		ReorderRate: l.ReorderRate,
+	}
+}
+
+// assert 단계에서 확인할 조건. 대상 노드 모두가 조건을 만족해야 함
+type ScenarioExpect struct {
+	SameTip     bool        `json:"same_tip,omitempty"`     // tip이 모두 같음
+	SameUTXO    bool        `json:"same_utxo,omitempty"`    // UTXO Set이 모두 같음
+	SameMempool bool        `json:"same_mempool,omitempty"` // 멤풀의 트랜잭션이 모두 같음
+	Height      *int64      `json:"height,omitempty"`       // tip 높이
+	MempoolSize *int        `json:"mempool_size,omitempty"` // 멤풀의 트랜잭션 수
+	Balances    map[int]int `json:"balances,omitempty"`     // 노드 번호 -> 그 노드 지갑의 잔액
+}
+
+// JSON에서 "1.5s" 같은 문자열로 쓰는 시간
+type ScenarioDuration time.Duration
+
+func (d ScenarioDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *ScenarioDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = ScenarioDuration(v)
+	return nil
+}
+
+// JSON 시나리오 파일을 읽음
+func LoadScenario(file string) (*Scenario, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var sc Scenario
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("Invalid scenario file %s: %w", file, err)
+	}
+	if sc.Name == "" {
+		sc.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	return &sc, nil
+}
+
+// 노드 번호와 단계 구성이 올바른지 확인
+func (sc *Scenario) validate() error {
+	if sc.Nodes < 1 {
+		return errors.New("scenario needs at least one node")
+	}
+	checkNode := func(i int) error {
+		if i < 0 || i >= sc.Nodes {
+			return fmt.Errorf("node %d out of range (0-%d)", i, sc.Nodes-1)
+		}
+		return nil
+	}
+
+	for _, i := range sc.Miners {
+		if err := checkNode(i); err != nil {
+			return fmt.Errorf("miners: %w", err)
+		}
+	}
+
+	for n, step := range sc.Steps {
+		var nodes []int
+		switch step.Action {
+		case stepMine:
+			nodes = []int{step.Node}
+		case stepSend:
+			if step.Amount <= 0 {
+				return fmt.Errorf("step %d: send amount must be positive", n+1)
+			}
+			nodes = []int{step.Node, step.To}
+		case stepPartition:
+			if len(step.Groups) == 0 {
+				return fmt.Errorf("step %d: partition needs groups", n+1)
+			}
+			for _, group := range step.Groups {
+				nodes = append(nodes, group...)
+			}
+		case stepLink:
+			if step.Link == nil {
+				return fmt.Errorf("step %d: link needs link settings", n+1)
+			}
+			nodes = step.Nodes
+		case stepAssert:
+			if step.Expect == nil {
+				return fmt.Errorf("step %d: assert needs expect", n+1)
+			}
+			nodes = step.Nodes
+			for i := range step.Expect.Balances {
+				nodes = append(nodes, i)
+			}
+		case stepHeal, stepWait:
+		default:
+			return fmt.Errorf("step %d: unknown action %q", n+1, step.Action)
+		}
+
+		for _, i := range nodes {
+			if err := checkNode(i); err != nil {
+				return fmt.Errorf("step %d: %w", n+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 시나리오를 실행하는 노드 하나
+type scenarioNode struct {
+	server *Server
+	wallet *Wallet
+	addr   string // P2P 주소
+}
+
+func (n *scenarioNode) walletAddress() string {
+	return string(n.wallet.GetAddress())
+}
+
+// 시나리오 실행 상태
+type scenarioRunner struct {
+	sc    *Scenario
+	sim   *SimNetwork
+	nodes []*scenarioNode
+}
+
+// 시나리오를 실행. 노드의 데이터는 dir 아래 노드 번호별 디렉토리에 만듦
+// 단계가 실패하면 그 단계에서 멈추고 에러를 반환
+func RunScenario(sc *Scenario, dir string) error {
+	if err := sc.validate(); err != nil {
+		return fmt.Errorf("scenario %s: %w", sc.Name, err)
+	}
+
+	r := &scenarioRunner{sc: sc, sim: NewSimNetwork(sc.Seed)}
+	if sc.Link != nil {
+		r.sim.SetDefaultLink(sc.Link.config())
+	}
+	defer r.stopNodes()
+	if err := r.startNodes(dir); err != nil {
+		return fmt.Errorf("scenario %s: %w", sc.Name, err)
+	}
+
+	for n, step := range sc.Steps {
+		logScenario.Info("Running step", "scenario", sc.Name, "step", n+1, "steps", len(sc.Steps), "action", step.Action)
+		if err := r.runStep(step); err != nil {
+			return fmt.Errorf("scenario %s: step %d (%s): %w", sc.Name, n+1, step.Action, err)
+		}
+	}
+
+	logScenario.Info("Scenario passed", "scenario", sc.Name)
+	return nil
+}
+
+// 모든 노드를 종료 (시나리오가 끝나거나 실패한 뒤)
+func (r *scenarioRunner) stopNodes() {
+	for _, node := range r.nodes {
+		node.server.Stop()
+	}
+}
+
+// 노드들을 만들어 실행하고 모두 서로 연결될 때까지 기다림
+// 노드 i는 앞 번호의 노드들에 연결함 (0번 노드는 연결해 오기를 기다림)
+func (r *scenarioRunner) startNodes(dir string) error {
+	var addrs []string
+	for i := 0; i < r.sc.Nodes; i++ {
+		addrs = append(addrs, fmt.Sprintf("localhost:%d", scenarioBasePort+i))
+	}
+
+	for i, addr := range addrs {
+		dataDir, err := NewDataDir(filepath.Join(dir, fmt.Sprintf("node%d", i)), scenarioNetwork)
+		if err != nil {
+			return err
+		}
+
+		wallet := NewWallet()
+		minerAddress := ""
+		if slices.Contains(r.sc.Miners, i) {
+			minerAddress = string(wallet.GetAddress())
+		}
+
+		server, err := NewServer(ServerConfig{
+			Port:         fmt.Sprint(scenarioBasePort + i),
+			MinerAddress: minerAddress,
+			DataDir:      dataDir,
+			Connect:      addrs[:i],
+			Transport:    r.sim.Transport(addr),
+			NoRPC:        true,
+		})
+		if err != nil {
+			return fmt.Errorf("creating node %d: %w", i, err)
+		}
+		r.nodes = append(r.nodes, &scenarioNode{server: server, wallet: wallet, addr: addr})
+		if err := server.Start(context.Background()); err != nil {
+			return fmt.Errorf("starting node %d: %w", i, err)
+		}
+	}
+
+	deadline := time.Now().Add(scenarioConnectWait)
+	for {
+		connected := true
+		for _, node := range r.nodes {
+			if len(node.server.connectedPeers()) < r.sc.Nodes-1 {
+				connected = false
+				break
+			}
+		}
+		if connected {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("nodes did not connect within %s", scenarioConnectWait)
+		}
+		time.Sleep(scenarioPollInterval)
+	}
+}
+
+func (r *scenarioRunner) runStep(step ScenarioStep) error {
+	switch step.Action {
+	case stepMine:
+		node := r.nodes[step.Node]
+		blocks := step.Blocks
+		if blocks <= 0 {
+			blocks = defaultScenarioBlocks
+		}
+		for i := 0; i < blocks; i++ {
+			block, err := node.server.mineBlock(node.walletAddress())
+			if err != nil {
+				return err
+			}
+			logScenario.Info("Mined block", "node", step.Node, hexAttr("hash", block.Hash), "height", block.Height)
+		}
+
+	case stepSend:
+		from, to := r.nodes[step.Node], r.nodes[step.To]
+		tx, err := from.server.bc.NewTransaction(from.wallet, to.walletAddress(), step.Amount)
+		if err != nil {
+			return err
+		}
+		if err := from.server.mempool.Add(tx); err != nil {
+			return err
+		}
+		from.server.broadcastTx(tx, nil)
+		logScenario.Info("Sent transaction", "node", step.Node, "to", step.To, "amount", step.Amount, hexAttr("txid", tx.ID))
+
+	case stepPartition:
+		groups := make([][]string, len(step.Groups))
+		for i, group := range step.Groups {
+			for _, n := range group {
+				groups[i] = append(groups[i], r.nodes[n].addr)
+			}
+		}
+		r.sim.Partition(groups...)
+
+	case stepHeal:
+		r.sim.Heal()
+
+	case stepLink:
+		nodes := r.targets(step.Nodes)
+		for _, from := range nodes {
+			for _, to := range nodes {
+				if from != to {
+					r.sim.SetLink(from.addr, to.addr, step.Link.config())
+				}
+			}
+		}
+
+	case stepWait:
+		time.Sleep(time.Duration(step.Duration))
+
+	case stepAssert:
+		timeout := time.Duration(step.Duration)
+		if timeout <= 0 {
+			timeout = defaultAssertTimeout
+		}
+		return r.waitFor(timeout, func() error {
+			return r.check(r.targets(step.Nodes), step.Expect)
+		})
+	}
+	return nil
+}
+
+// 노드 번호 목록에 해당하는 노드 (비어 있으면 모든 노드)
+func (r *scenarioRunner) targets(indexes []int) []*scenarioNode {
+	if len(indexes) == 0 {
+		return r.nodes
+	}
+	nodes := make([]*scenarioNode, len(indexes))
+	for i, n := range indexes {
+		nodes[i] = r.nodes[n]
+	}
+	return nodes
+}
+
+// 블록과 트랜잭션 전파는 비동기이므로 조건이 맞을 때까지 다시 확인
+// timeout이 지나면 마지막으로 확인한 에러를 반환
+func (r *scenarioRunner) waitFor(timeout time.Duration, check func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := check()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(scenarioPollInterval)
+	}
+}
+
+// 노드들이 조건을 만족하는지 확인
+func (r *scenarioRunner) check(nodes []*scenarioNode, expect *ScenarioExpect) error {
+	states := make([]scenarioState, len(nodes))
+	for i, node := range nodes {
+		state, err := node.state()
+		if err != nil {
+			return fmt.Errorf("%s: %w", node.addr, err)
+		}
+		states[i] = state
+	}
+
+	for i, state := range states {
+		if expect.Height != nil && state.height != *expect.Height {
+			return fmt.Errorf("%s: height %d, expected %d", nodes[i].addr, state.height, *expect.Height)
+		}
+		if expect.MempoolSize != nil && len(state.mempool) != *expect.MempoolSize {
+			return fmt.Errorf("%s: %d mempool transactions, expected %d", nodes[i].addr, len(state.mempool), *expect.MempoolSize)
+		}
+		if i == 0 {
+			continue
+		}
+		if expect.SameTip && state.tip != states[0].tip {
+			return fmt.Errorf("tips differ: %s has %s at height %d, %s has %s at height %d",
+				nodes[0].addr, states[0].tip, states[0].height, nodes[i].addr, state.tip, state.height)
+		}
+		if expect.SameUTXO && state.utxo != states[0].utxo {
+			return fmt.Errorf("UTXO sets differ between %s and %s", nodes[0].addr, nodes[i].addr)
+		}
+		if expect.SameMempool && !slices.Equal(state.mempool, states[0].mempool) {
+			return fmt.Errorf("mempools differ: %s has %v, %s has %v", nodes[0].addr, states[0].mempool, nodes[i].addr, state.mempool)
+		}
+	}
+
+	// 잔액은 각 노드가 자신의 UTXO Set으로 계산한 값을 확인
+	for n, want := range expect.Balances {
+		owner := HashPubKey(r.nodes[n].wallet.PublicKey)
+		for _, node := range nodes {
+			got, err := UTXOSet{node.server.bc}.GetBalance(owner)
+			if err != nil {
+				return fmt.Errorf("%s: %w", node.addr, err)
+			}
+			if got != want {
+				return fmt.Errorf("%s: balance of node %d is %d, expected %d", node.addr, n, got, want)
+			}
+		}
+	}
+	return nil
+}
+
+// 비교에 사용하는 노드 상태
+type scenarioState struct {
+	tip     string
+	height  int64
+	utxo    string
+	mempool []string // 정렬한 트랜잭션 ID
+}
+
+func (n *scenarioNode) state() (scenarioState, error) {
+	tip, height, err := n.server.bc.GetTipInfo()
+	if err != nil {
+		return scenarioState{}, err
+	}
+	utxo, err := UTXOSet{n.server.bc}.Digest()
+	if err != nil {
+		return scenarioState{}, err
+	}
+
+	var mempool []string
+	for _, tx := range n.server.mempool.GetTxs() {
+		mempool = append(mempool, hex.EncodeToString(tx.ID))
+	}
+	sort.Strings(mempool)
+
+	return scenarioState{
+		tip:     hex.EncodeToString(tip),
+		height:  height,
+		utxo:    utxo,
+		mempool: mempool,
+	}, nil
+}
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// scenarios 디렉토리의 모든 시나리오를 실행
+func TestScenarios(t *testing.T) {
+	if testing.Short() {
+		t.Skip("scenarios run in-process nodes")
+	}
+
+	files, err := filepath.Glob(filepath.Join("..", "scenarios", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no scenario files found")
+	}
+
+	for _, file := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".json"), func(t *testing.T) {
+			sc, err := LoadScenario(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := RunScenario(sc, t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
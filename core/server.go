@@ -2,40 +2,74 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const protocol = "tcp"
-const nodeVersion = 1
+const nodeVersion = 7
 const commandLen = 12      // 명령어 길이 (12바이트로 고정)
 const rpcPortOffset = 1000 // P2P + 1000 = RPC 포트
+const dialTimeout = 5 * time.Second
 
-var (
-	// 다운로드 중인 블록 큐
-	// Server의 멤버 변수로 두고 Lock을 보호하는 것이 맞음.
-	blocksInTransit  = [][]byte{}
-	bootstrapAddress = "localhost:3000"
-)
+// 시드를 지정하지 않았을 때 사용하는 부트스트랩 노드
+const defaultSeed = "localhost:3000"
 
 type Server struct {
 	nodeAddress   string
 	p2pPort       string
 	rpcPort       string
-	miningAddress string // 채굴 보상 주소 (설정된 경우에만 채굴)
+	rpcBind       string // RPC 서버가 listen 하는 주소
+	rpcUser       string // 비어있지 않으면 RPC 요청을 인증함
+	rpcPassword   string
+	miningAddress string   // 채굴 보상 주소 (설정된 경우에만 채굴)
+	miningThreads int      // 채굴에 사용하는 고루틴 수
+	dataDir       *DataDir // 체인 DB, 지갑 등을 보관하는 데이터 디렉토리
+	magic         uint32   // 네트워크 매직 (다른 네트워크의 메시지를 구분)
+	nonce         uint64   // version 메시지의 노드별 난수 (자기 연결 감지)
 	bc            *Blockchain
 	mempool       *Mempool
-	knownNodes    map[string]bool
-}
-
-type GetBlocks struct {
-	AddrFrom string
+	peerManager   *PeerManager      // 알고 있는 피어 주소 목록
+	banManager    *BanManager       // 차단된 주소 목록
+	connectOnly   []string          // 설정되면 outbound 연결은 이 주소들에만 함 (-connect)
+	addedNodes    map[string]bool   // addnode로 추가되어 항상 연결을 유지하는 주소
+	peers         map[string]*Peer  // 연결된 피어 (key: 연결 주소)
+	peersLock     sync.RWMutex      // peers, addedNodes 보호
+	downloads     *blockDownloader  // 블록 본문 다운로드 스케줄러
+	orphans       *orphanPool       // 부모를 모르는 채로 도착한 블록
+	txRequests    *txRequestTracker // 알림을 받고 요청 중인 트랜잭션
+	compactBlocks *compactBlockPool // 빠진 트랜잭션을 기다리는 compact block
+	nodeKey       *NodeKey          // P2P 연결 암호화에 사용하는 노드 키 (nil이면 암호화하지 않음)
+	allowedPeers  map[string]bool   // 비어있지 않으면 이 노드 ID들과만 연결 (허용 목록 모드)
+	inboundConns  *connLimiter      // inbound 연결 수 제한 (전체, IP별)
+	maxOutbound   int               // 유지하려는 outbound 연결 수
+	counters      *netCounters      // 네트워크 카운터
+	serveMempool  bool              // 피어의 'mempool' 요청에 응답
+	transport     Transport         // P2P 연결 방식 (TCP 또는 가상 네트워크)
+	rpcEnabled    bool              // RPC 서버를 염
+
+	// 실행 상태 (lifecycle.go)
+	ctx         context.Context // 종료를 시작하면 취소됨 (백그라운드 작업의 종료 신호)
+	cancel      context.CancelFunc
+	started     atomic.Bool
+	p2pListener net.Listener
+	rpcListener net.Listener
+	minerWG     sync.WaitGroup // 채굴 루프
+	rpcWG       sync.WaitGroup // RPC 리스너와 처리 중인 요청
+	p2pWG       sync.WaitGroup // P2P 리스너, 연결 처리, 동기화/전파/연결 유지 루프
+	stopOnce    sync.Once
+	stopped     chan struct{} // 종료가 끝나면 닫힘
+	stopErr     error
 }
 
 type Inv struct {
@@ -46,8 +80,8 @@ type Inv struct {
 
 type GetData struct {
 	AddrFrom string
-	Type     string
-	ID       []byte // 요청할 해시
+	Type     string   // "block" 또는 "tx"
+	Items    [][]byte // 요청할 해시 목록
 }
 
 type BlockMsg struct {
@@ -55,507 +89,673 @@ type BlockMsg struct {
 	Block    []byte
 }
 
-// 메시지 구조체 (간소화한 버전)
-type Version struct {
-	Version    int64  // 블록체인 버전
-	BestHeight int64  // 이 노드가 가진 블록의 최고 높이
-	AddrFrom   string // 이 메시지를 보낸 노드의 주소
-}
-
 type TxMsg struct {
 	AddrFrom    string
 	Transaction []byte
 }
 
-func NewServer(port string, minerAddress string) *Server {
+// 노드 설정
+type ServerConfig struct {
+	Port            string
+	MinerAddress    string    // 채굴 보상 주소 (비어있으면 채굴하지 않음)
+	MiningThreads   int       // 채굴에 사용하는 고루틴 수 (0이면 1)
+	DataDir         *DataDir  // 데이터 디렉토리
+	PruneMB         int64     // 블록 본문 보관 용량(MB). 0이면 prune 하지 않음
+	TxIndex         bool      // 트랜잭션 인덱스를 만들어 FindTransaction에 사용
+	Seeds           []string  // 피어 목록에 항상 추가되는 시드 노드 주소
+	Connect         []string  // 비어있지 않으면 이 주소들에만 outbound 연결 (시드와 주소 전파는 사용하지 않음)
+	MaxOutbound     int       // 유지하려는 outbound 연결 수 (0이면 targetOutboundPeers)
+	MaxInbound      int       // 최대 inbound 연결 수 (0이면 maxInboundPeers)
+	Encrypt         bool      // P2P 연결을 TLS로 암호화 (모든 피어가 같은 설정이어야 함)
+	AllowPeers      []string  // 연결을 허용할 노드 ID 목록. 지정하면 암호화도 사용
+	NoMempool       bool      // 피어의 'mempool' 요청에 응답하지 않음 (멤풀 내용을 공개하지 않음)
+	MempoolMaxTxs   int       // 멤풀 최대 트랜잭션 수 (0이면 제한 없음)
+	MempoolMaxBytes int       // 멤풀 최대 크기 (바이트, 0이면 제한 없음)
+	Transport       Transport // P2P 연결 방식. nil이면 TCP (테스트에서는 SimNetwork.Transport)
+	NoRPC           bool      // RPC 서버를 열지 않음 (한 프로세스에서 여러 노드를 실행하는 경우)
+	RPCBind         string    // RPC 서버가 listen 하는 주소 (비어있으면 localhost)
+	RPCPort         int       // RPC 포트 (0이면 P2P 포트 + rpcPortOffset)
+	RPCUser         string    // 설정하면 RPC 요청에 사용자 이름과 비밀번호가 맞아야 함
+	RPCPassword     string
+}
+
+// 설정으로 서버를 만듦. 블록체인, 피어 목록, 차단 목록, 노드 키를 불러오지 못하면 에러
+func NewServer(cfg ServerConfig) (*Server, error) {
+	port := cfg.Port
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", port, err)
+	}
 	nodeAddr := fmt.Sprintf("localhost:%s", port)
-	rpcPortNum := (safeStringToInt(port) + rpcPortOffset)
+	rpcPortNum := cfg.RPCPort
+	if rpcPortNum == 0 {
+		rpcPortNum = portNum + rpcPortOffset
+	}
+	rpcBind := cfg.RPCBind
+	if rpcBind == "" {
+		rpcBind = "localhost"
+	}
+	if (cfg.RPCUser == "") != (cfg.RPCPassword == "") {
+		return nil, errors.New("RPC user and password must be set together")
+	}
+
+	// 채굴을 시작한 뒤에 실패하지 않도록 보상 주소를 미리 확인
+	if cfg.MinerAddress != "" && !ValidateAddress(cfg.MinerAddress) {
+		return nil, fmt.Errorf("%w: mining address %q", ErrInvalidAddress, cfg.MinerAddress)
+	}
 
 	// 블록체인 로드
-	bc := NewBlockchain(port)
-	UTXOSet{Blockchain: bc}.Reindex()
+	bc, err := NewBlockchain(cfg.DataDir.ChainFile())
+	if err != nil {
+		return nil, err
+	}
+	bc.SetPruneTarget(cfg.PruneMB)
+	// 이후 단계에서 실패하면 DB를 닫고 에러 반환
+	fail := func(err error) (*Server, error) {
+		bc.Close()
+		return nil, err
+	}
+	if cfg.TxIndex {
+		if err := bc.EnableTxIndex(); err != nil {
+			return fail(err)
+		}
+	}
+
+	// prune된 체인은 블록 본문이 없어 Reindex 할 수 없음
+	// (UTXO Set은 블록 추가와 같은 트랜잭션에서 갱신되므로 저장된 상태를 그대로 사용)
+	prunedHeight, err := bc.PrunedHeight()
+	if err != nil {
+		return fail(err)
+	}
+	if prunedHeight == 0 {
+		if err := (UTXOSet{Blockchain: bc}).Reindex(); err != nil {
+			return fail(err)
+		}
+	}
 
 	// 멤풀 생성
 	mempool := NewMempool()
+	mempool.SetLimits(cfg.MempoolMaxTxs, cfg.MempoolMaxBytes)
+
+	transport := cfg.Transport
+	if transport == nil {
+		transport = tcpTransport{}
+	}
+
+	// 저장된 피어 목록 로드
+	peerManager, err := NewPeerManager(cfg.DataDir.PeersFile())
+	if err != nil {
+		return fail(err)
+	}
+	banManager, err := NewBanManager(cfg.DataDir.BanList())
+	if err != nil {
+		return fail(err)
+	}
+	// 암호화를 사용하면 노드 키를 불러오고, 허용 목록을 준비
+	var nodeKey *NodeKey
+	allowedPeers := make(map[string]bool)
+	for _, id := range cfg.AllowPeers {
+		allowedPeers[strings.ToLower(id)] = true
+	}
+	if cfg.Encrypt || len(allowedPeers) > 0 {
+		nodeKey, err = LoadOrCreateNodeKey(cfg.DataDir.NodeKey())
+		if err != nil {
+			return fail(err)
+		}
+		logP2P.Info("P2P encryption enabled", "node_id", nodeKey.ID())
+		if len(allowedPeers) > 0 {
+			logP2P.Info("Allowlist mode", "node_ids", len(allowedPeers))
+		}
+	}
+
+	if len(cfg.Connect) == 0 {
+		for _, seed := range cfg.Seeds {
+			if seed != nodeAddr {
+				peerManager.AddSeed(seed)
+			}
+		}
+	}
 
-	// knownNodes 초기화
-	knownNodesMap := make(map[string]bool)
-	knownNodesMap["localhost:3000"] = true // 부트스트랩 노드는 하드코딩
+	maxOutbound := cfg.MaxOutbound
+	if maxOutbound <= 0 {
+		maxOutbound = targetOutboundPeers
+	}
+	maxInbound := cfg.MaxInbound
+	if maxInbound <= 0 {
+		maxInbound = maxInboundPeers
+	}
 
-	return &Server{
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
 		nodeAddress:   nodeAddr,
 		p2pPort:       port,
 		rpcPort:       fmt.Sprintf("%d", rpcPortNum),
-		miningAddress: minerAddress,
+		rpcBind:       rpcBind,
+		rpcUser:       cfg.RPCUser,
+		rpcPassword:   cfg.RPCPassword,
+		miningAddress: cfg.MinerAddress,
+		miningThreads: max(cfg.MiningThreads, 1),
+		dataDir:       cfg.DataDir,
+		magic:         cfg.DataDir.Magic(),
+		nonce:         newNodeNonce(),
 		bc:            bc,
 		mempool:       mempool,
-		knownNodes:    knownNodesMap,
-	}
+		peerManager:   peerManager,
+		banManager:    banManager,
+		connectOnly:   cfg.Connect,
+		addedNodes:    make(map[string]bool),
+		downloads:     newBlockDownloader(),
+		orphans:       newOrphanPool(),
+		txRequests:    newTxRequestTracker(),
+		compactBlocks: newCompactBlockPool(),
+		nodeKey:       nodeKey,
+		allowedPeers:  allowedPeers,
+		inboundConns:  newConnLimiter(maxInbound),
+		maxOutbound:   maxOutbound,
+		counters:      &netCounters{},
+		serveMempool:  !cfg.NoMempool,
+		transport:     transport,
+		rpcEnabled:    !cfg.NoRPC,
+		peers:         make(map[string]*Peer),
+		ctx:           ctx,
+		cancel:        cancel,
+		stopped:       make(chan struct{}),
+	}
+	s.loadMempool()
+	return s, nil
 }
 
-func (s *Server) Start() {
-	fmt.Printf("Starting server on %s (RPC: %s)\n", s.nodeAddress, s.rpcPort)
-
-	go s.startP2PListener()
-	go s.startRPCListener()
-
-	// 채굴자일 경우, 채굴 루프 시작
-	if s.miningAddress != "" {
-		fmt.Printf("Mining is enabled. Reward to: %s\n", s.miningAddress)
-		go s.startMining()
+// 연결 처리 핸들러 (다른 노드에서 이 노드로 연결했을 때 핸들링)
+// 연결을 피어로 등록하고, 연결이 유지되는 동안 메시지를 주고받음
+func (s *Server) handleP2PConnection(conn net.Conn) {
+	addr := conn.RemoteAddr().String()
+	if s.banManager.IsBanned(addr) {
+		logP2P.Info("Rejecting connection from banned address", "addr", addr)
+		s.counters.inboundRejected.Add(1)
+		conn.Close()
+		return
 	}
 
-	// 부트스트랩 노드에 버전 전송
-	go func() {
-		time.Sleep(2 * time.Second)
-		if s.nodeAddress != "localhost:3000" {
-			s.sendVersion("localhost:3000")
-		}
-	}()
-
-	// 메인 스레드 대기, 메인 스레드가 블로킹됨.
-	select {}
-}
+	// 연결 수는 연결이 닫힐 때 removePeer에서 줄어듦
+	host := hostOf(addr)
+	if reason := s.inboundConns.acquire(host); reason != "" {
+		logP2P.Info("Rejecting connection", "addr", addr, "reason", reason)
+		s.counters.inboundRejected.Add(1)
+		conn.Close()
+		return
+	}
 
-func (s *Server) startP2PListener() {
-	ln, err := net.Listen(protocol, s.nodeAddress)
+	conn, err := s.secureConn(conn, true)
 	if err != nil {
-		log.Panic(err)
+		logP2P.Info("Rejecting connection", "err", err)
+		s.counters.inboundRejected.Add(1)
+		s.inboundConns.release(host)
+		return
 	}
-	defer ln.Close()
+	s.counters.inboundAccepted.Add(1)
 
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			log.Panic(err)
-		}
-		go s.handleP2PConnection(conn)
+	peer := newPeer(conn, addr, true, s.counters)
+	if !s.addPeer(peer) {
+		conn.Close()
+		s.inboundConns.release(host)
+		return
 	}
+	peer.start(s.magic, s.recoverMessage(s.handleMessage), s.removePeer)
+	s.watchHandshake(peer)
 }
 
-// 연결 처리 핸들러 (다른 노드에서 이 노드로 연결했을 때 핸들링)
-func (s *Server) handleP2PConnection(conn net.Conn) {
-	request := make([]byte, 0, 4096) // 4KB 버퍼
-	tmp := make([]byte, 256)
+// 피어로부터 받은 메시지를 명령어별 핸들러로 전달
+func (s *Server) handleMessage(p *Peer, command string, payload []byte) {
+	logP2P.Debug("Received command", "command", command, "peer", p.String())
 
-	// conn으로부터 데이터 읽어들이기
-	for {
-		n, err := conn.Read(tmp) // n: 읽어들인 바이트 수
-		if err != nil {
-			// EOF Error 인 경우에는 에러로 처리할 필요없고, 그 외에만 에러로 처리
-			if err != io.EOF {
-				log.Panic(err)
-			}
-			break
-		}
-		request = append(request, tmp[:n]...)
+	// 핸드셰이크가 끝나기 전에는 version, verack 외의 메시지를 처리하지 않음
+	if !p.handshakeDone() && command != "version" && command != "verack" {
+		s.disconnectPeer(p, fmt.Sprintf("%s received before handshake", command))
+		return
 	}
 
-	// 메시지 파싱
-	command := bytesToCommand(request[:commandLen])
-	payload := request[commandLen:]
-
-	fmt.Printf("Received command: %s\n", command)
-
 	switch command {
 	case "version":
-		s.handleVersion(payload)
-	case "getblocks":
-		s.handleGetBlocks(payload)
+		s.handleVersion(p, payload)
+	case "verack":
+		s.handleVerack(p)
+	case "getheaders":
+		s.handleGetHeaders(p, payload)
+	case "headers":
+		s.handleHeaders(p, payload)
 	case "inv":
-		s.handleInv(payload)
+		s.handleInv(p, payload)
 	case "getdata":
-		s.handleGetData(payload)
+		s.handleGetData(p, payload)
+	case "notfound":
+		s.handleNotFound(p, payload)
 	case "block":
-		s.handleBlock(payload)
+		s.handleBlock(p, payload)
 	case "tx":
-		s.handleTx(payload)
+		s.handleTx(p, payload)
+	case "cmpctblock":
+		s.handleCmpctBlock(p, payload)
+	case "getblocktxn":
+		s.handleGetBlockTxn(p, payload)
+	case "blocktxn":
+		s.handleBlockTxn(p, payload)
+	case "ping":
+		s.handlePing(p, payload)
+	case "pong":
+		s.handlePong(p, payload)
+	case "mempool":
+		s.handleMempool(p)
+	case "getaddr":
+		s.handleGetAddr(p)
+	case "addr":
+		s.handleAddr(p, payload)
 	default:
-		fmt.Println("Unknown command!")
+		logP2P.Warn("Unknown command", "command", command, "peer", p.String())
 	}
 }
 
-func (s *Server) startMining() {
-	fmt.Println("Mining loop started...")
-
-	for {
-		time.Sleep(10 * time.Second)
-		// 멤풀에서 트랜잭션 수집
-		txs := s.mempool.GetTxs()
-		validTxs := []*Transaction{}
-		// 트랜잭션 검증
-		for _, tx := range txs {
-			if s.bc.VerifyTransaction(tx) {
-				validTxs = append(validTxs, tx)
-			}
-		}
+// addr에 연결된 피어를 반환. 연결이 없으면 새로 연결
+func (s *Server) connectPeer(addr string) (*Peer, error) {
+	if peer := s.findPeer(addr); peer != nil {
+		return peer, nil
+	}
+	if s.banManager.IsBanned(addr) {
+		return nil, fmt.Errorf("%s is banned", addr)
+	}
+	if s.ctx.Err() != nil {
+		return nil, errServerStopping
+	}
 
-		// 코인베이스 트랜잭션 추가
-		coinbaseTx := NewCoinbaseTX(s.miningAddress, "")
-		validTxs = append(validTxs, coinbaseTx) // 원래는 첫 번째 트랜잭션으로 포험되어야 함.
+	conn, err := s.transport.Dial(addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if conn, err = s.secureConn(conn, false); err != nil {
+		return nil, err
+	}
 
-		// 채굴(PoW)
-		tipHash, lastHeight := s.bc.GetTipInfo()
-		newBlock := NewBlock(validTxs, tipHash, lastHeight+1)
+	peer := newPeer(conn, addr, false, s.counters)
+	if !s.addPeer(peer) {
+		conn.Close()
+		return nil, errServerStopping
+	}
+	peer.start(s.magic, s.recoverMessage(s.handleMessage), s.removePeer)
+	s.watchHandshake(peer)
 
-		pow := NewProofOfWork(newBlock)
-		nonce, hash := pow.Run()
-		newBlock.Nonce = nonce
-		newBlock.Hash = hash
+	// 연결한 쪽이 먼저 version을 보냄
+	s.sendVersion(peer)
 
-		err := s.bc.AddBlock(newBlock)
-		if err != nil {
-			fmt.Printf("Error while mining (AddBlock failed): %v\n", err)
-			continue // 포크가 발생했거나 유효하지 않은 tx가 껴있을 수 있음
-		}
+	return peer, nil
+}
 
-		// 블록에 포함된 트랜잭션들을 멤풀에서 비우기
-		s.mempool.Clear(newBlock)
+// 피어를 등록. 서버가 종료 중이면 등록하지 않고 false
+// (Stop은 취소한 뒤 이 락을 잡고 피어 목록을 가져오므로, 등록된 피어는 모두 종료 대상이 됨)
+func (s *Server) addPeer(p *Peer) bool {
+	s.peersLock.Lock()
+	defer s.peersLock.Unlock()
 
-		// 새 블록 전파
-		s.broadcastInv("block", [][]byte{newBlock.Hash})
+	if s.ctx.Err() != nil {
+		return false
+	}
+	s.peers[p.addr] = p
+	logP2P.Info("Peer connected", "peer", p.String(), "inbound", p.inbound)
+	return true
+}
 
+func (s *Server) removePeer(p *Peer) {
+	s.peersLock.Lock()
+	if s.peers[p.addr] == p {
+		delete(s.peers, p.addr)
+		logP2P.Info("Peer disconnected", "peer", p.String())
+	}
+	s.peersLock.Unlock()
+
+	if p.inbound {
+		s.inboundConns.release(hostOf(p.addr))
+	}
+
+	s.onPeerDisconnected(p)
+
+	// 직접 연결했지만 핸드셰이크까지 가지 못한 주소는 실패로 기록
+	if !p.inbound && !p.handshakeDone() {
+		s.peerManager.MarkFailed(p.addr)
 	}
 }
 
-func (s *Server) broadcastInv(kind string, items [][]byte) {
-	for nodeAddr := range s.knownNodes {
-		if nodeAddr != s.nodeAddress {
-			s.sendInv(nodeAddr, kind, items)
+// 연결 주소 또는 P2P 주소로 연결된 피어 찾기
+func (s *Server) findPeer(addr string) *Peer {
+	s.peersLock.RLock()
+	defer s.peersLock.RUnlock()
+
+	if peer, ok := s.peers[addr]; ok {
+		return peer
+	}
+	for _, peer := range s.peers {
+		if peer.matches(addr) {
+			return peer
 		}
 	}
+	return nil
 }
 
-func commandToBytes(command string) []byte {
-	var bytes [commandLen]byte
+// 핸드셰이크가 끝난 피어 목록 (메시지를 전파할 대상)
+func (s *Server) connectedPeers() []*Peer {
+	s.peersLock.RLock()
+	defer s.peersLock.RUnlock()
 
-	for i, c := range command {
-		bytes[i] = byte(c)
+	peers := make([]*Peer, 0, len(s.peers))
+	for _, peer := range s.peers {
+		if peer.handshakeDone() {
+			peers = append(peers, peer)
+		}
 	}
+	return peers
+}
 
-	return bytes[:]
+// 피어에게 메시지 전송 (payload는 GOB으로 인코딩)
+func (s *Server) sendMessage(p *Peer, command string, payload any) {
+	if !p.send(encodeMessage(s.magic, command, gobEncode(payload))) {
+		logP2P.Debug("Peer is not available", "peer", p.String())
+	}
 }
 
-func bytesToCommand(bytes []byte) string {
-	var command []byte
+func (s *Server) startMining() {
+	logMiner.Info("Mining loop started")
 
-	// 0이 아닌 바이트만 추출
-	for _, b := range bytes {
-		if b != 0x0 {
-			command = append(command, b)
+	for s.sleep(10 * time.Second) {
+		if _, err := s.mineBlock(s.miningAddress); err != nil {
+			logMiner.Warn("Mining failed", "err", err)
+			continue // 포크가 발생했거나 유효하지 않은 tx가 껴있을 수 있음
 		}
 	}
-
-	return string(command)
 }
 
-func sendData(addr string, data []byte) {
-	conn, err := net.Dial(protocol, addr)
+// 멤풀의 유효한 트랜잭션으로 tip 위에 블록 하나를 채굴하고 추가한 뒤 전파
+// (채굴 루프와 시나리오 실행기가 사용)
+func (s *Server) mineBlock(rewardTo string) (*Block, error) {
+	// 멤풀에서 트랜잭션 수집
+	txs := s.mempool.GetTxs()
+	validTxs := []*Transaction{}
+	// 트랜잭션 검증
+	for _, tx := range txs {
+		if err := s.bc.VerifyTransaction(tx); err == nil {
+			validTxs = append(validTxs, tx)
+		}
+	}
+
+	// 코인베이스 트랜잭션 추가
+	coinbaseTx, err := NewCoinbaseTX(rewardTo, "")
 	if err != nil {
-		fmt.Printf("%s is not available\n", addr)
-		// 실제로는 knownNodes에서 제거하는 로직 필요
-		return
+		return nil, err
 	}
-	defer conn.Close()
+	validTxs = append(validTxs, coinbaseTx) // 원래는 첫 번째 트랜잭션으로 포험되어야 함.
 
-	_, err = io.Copy(conn, bytes.NewReader(data))
+	// 채굴(PoW)
+	tipHash, lastHeight, err := s.bc.GetTipInfo()
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
-}
+	newBlock := NewBlock(validTxs, tipHash, lastHeight+1)
 
-// 'version' 메시지 전송
-func (s *Server) sendVersion(addr string) {
-	bestHeight := s.bc.GetBestHeight()
+	pow := NewProofOfWork(newBlock)
+	nonce, hash := pow.RunParallel(s.miningThreads)
+	newBlock.Nonce = nonce
+	newBlock.Hash = hash
 
-	ver := Version{
-		Version:    nodeVersion,
-		BestHeight: bestHeight,
-		AddrFrom:   s.nodeAddress,
+	if err := s.bc.AddBlock(newBlock); err != nil {
+		return nil, err
 	}
-	verMsg := append(commandToBytes("version"), gobEncode(ver)...)
-	sendData(addr, verMsg)
+
+	// 블록에 포함된 트랜잭션들을 멤풀에서 비우기
+	s.mempool.Clear(newBlock)
+
+	// 새 블록 전파
+	s.announceBlock(newBlock)
+	return newBlock, nil
 }
 
-// 'version' 메시지 처리
-func (s *Server) handleVersion(payload []byte) {
-	var buf bytes.Buffer
-	var version Version
+func commandToBytes(command string) []byte {
+	var bytes [commandLen]byte
 
-	buf.Write(payload)
-	dec := gob.NewDecoder(&buf)
-	if err := dec.Decode(&version); err != nil {
-		log.Panic(err)
+	for i, c := range command {
+		bytes[i] = byte(c)
 	}
 
-	fmt.Printf("Received version: Height %d from %s\n", version.BestHeight, version.AddrFrom)
+	return bytes[:]
+}
 
-	myBestHeight := s.bc.GetBestHeight()
-	opBestHeight := int64(version.BestHeight)
+func bytesToCommand(bytes []byte) string {
+	var command []byte
 
-	// 상대방의 bestHeight가 나보다 높으면 getBlocks 메시지를 전송해서 받아오기
-	if myBestHeight < int64(version.BestHeight) {
-		s.sendGetBlocks(version.AddrFrom)
-	} else if myBestHeight > opBestHeight {
-		// 상대방의 bestHeight가 나보다 낮으면 내 version을 보내줌
-		s.sendVersion(version.AddrFrom)
+	// 0이 아닌 바이트만 추출
+	for _, b := range bytes {
+		if b != 0x0 {
+			command = append(command, b)
+		}
 	}
-	// 새로운 노드 주소를 knownNodes에 추가
-	s.knownNodes[version.AddrFrom] = true
+
+	return string(command)
 }
 
-func (s *Server) sendTx(tx *Transaction, addr string) {
+func (s *Server) sendTx(p *Peer, tx *Transaction) {
 	txMsg := TxMsg{
 		AddrFrom:    s.nodeAddress,
 		Transaction: gobEncode(tx),
 	}
 
-	request := append(commandToBytes("tx"), gobEncode(txMsg)...)
-	sendData(addr, request)
+	p.addKnownInventory(tx.ID)
+	s.sendMessage(p, "tx", txMsg)
 }
 
 // 트랜잭션 데이터를 수신
-func (s *Server) handleTx(payload []byte) {
+func (s *Server) handleTx(p *Peer, payload []byte) {
 	var txMsg TxMsg
 	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&txMsg); err != nil {
-		log.Panic(err)
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed tx message: %v", err))
+		return
 	}
 
 	var tx Transaction
 	if err := gob.NewDecoder(bytes.NewReader(txMsg.Transaction)).Decode(&tx); err != nil {
-		log.Panic(err)
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed transaction: %v", err))
+		return
 	}
 
 	txID := hex.EncodeToString(tx.ID)
+	s.txRequests.received(tx.ID)
+	p.addKnownInventory(tx.ID)
 
 	// 멤풀에 이미 있는지 확인
-	if _, ok := s.mempool.transactions[txID]; ok {
+	if s.mempool.Exists(txID) {
 		return // 이미 있는 트랜잭션이면 처리할 필요 없음. 종료
 	}
 
 	// 트랜잭션 검증, 유효한 트랜잭션이면
-	if !s.bc.VerifyTransaction(&tx) {
-		fmt.Printf("[Tx] Invalid transaction %x received.\n", tx.ID)
+	// 참조하는 트랜잭션을 모르면 우리 체인이 뒤처졌을 수 있으므로 피어의 잘못으로 보지 않음
+	if err := s.bc.VerifyTransaction(&tx); errors.Is(err, ErrTxNotFound) {
+		logMempool.Debug("Transaction spends unknown outputs, ignoring", hexAttr("txid", tx.ID), "err", err)
+		return
+	} else if err != nil {
+		logMempool.Warn("Invalid transaction received", hexAttr("txid", tx.ID), "peer", p.String(), "err", err)
+		s.misbehaving(p, scoreInvalidTx, fmt.Sprintf("invalid transaction %x: %v", tx.ID, err))
 		return
 	}
 
 	// 멤풀에 트랜잭션 추가
-	if added := s.mempool.Add(&tx); added {
-		fmt.Printf("[Tx] Added tx %x to mempool (size: %d)\n", tx.ID, len(s.mempool.transactions))
-		// 이 트랜잭션을 다른 노드들에게도 전파
-		s.broadcastTx(&tx, txMsg.AddrFrom)
+	if err := s.mempool.Add(&tx); errors.Is(err, ErrMempoolFull) {
+		logMempool.Info("Mempool is full, dropping transaction", hexAttr("txid", tx.ID), "err", err)
+		return
+	} else if err != nil {
+		return
 	}
+	count, size := s.mempool.Size()
+	logMempool.Info("Added transaction to mempool", hexAttr("txid", tx.ID), "count", count, "bytes", size)
+	// 이 트랜잭션을 다른 노드들에게도 전파
+	s.broadcastTx(&tx, p)
 
 }
 
-func (s *Server) broadcastTx(tx *Transaction, addrFrom string) {
-	log.Println("broadcasting tx..")
-	for node := range s.knownNodes {
-		log.Println(node, "is knownNodes")
-		// 나와 이 메시지를 보낸 노드를 제외하고 보내기
-		if node != s.nodeAddress && node != addrFrom {
-			s.sendTx(tx, node)
+// 트랜잭션을 피어들에게 알리도록 예약
+// 트랜잭션을 바로 보내지 않고, 피어별로 모아서 무작위 간격으로 inv를 보냄 (txRelayLoop)
+// from은 트랜잭션을 보낸 피어 (직접 만든 트랜잭션이면 nil)
+func (s *Server) broadcastTx(tx *Transaction, from *Peer) {
+	logMempool.Debug("Queueing transaction for relay", hexAttr("txid", tx.ID))
+	for _, peer := range s.connectedPeers() {
+		// 이 메시지를 보낸 피어와 트랜잭션을 전파하지 않는 피어를 제외하고 알리기
+		if peer != from && peer.hasService(ServiceTxRelay) {
+			peer.queueTxInv(tx.ID)
 		}
 	}
 }
 
 // 'Inv' 메시지 전송
-func (s *Server) sendInv(addr, kind string, items [][]byte) {
+func (s *Server) sendInv(p *Peer, kind string, items [][]byte) {
 	inv := Inv{
 		AddrFrom: s.nodeAddress,
 		Type:     kind,
 		Items:    items,
 	}
-	payload := gobEncode(inv)
-	request := append(commandToBytes("inv"), payload...)
 
-	sendData(addr, request)
+	p.addKnownInventory(items...)
+	s.sendMessage(p, "inv", inv)
 }
 
 // 'Inv' 메시지 처리
-// 다른 노드의 블록 해시 목록을 받아서, 나한테 없는 블록을 요청
-func (s *Server) handleInv(payload []byte) {
+// 다른 노드가 알려준 블록이나 트랜잭션 중 나한테 없는 것을 요청
+func (s *Server) handleInv(p *Peer, payload []byte) {
 	var inv Inv
 
 	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&inv); err != nil {
-		log.Panic(err)
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed inv: %v", err))
+		return
 	}
 
-	fmt.Printf("Received inventory with %d %s items from %s\n", len(inv.Items), inv.Type, inv.AddrFrom)
-
-	if inv.Type == "block" {
-		// 내가 가진 블록 해시를 맵으로 만듦 (빠른 조회를 위해)
-		myHashes := s.bc.GetBlockHashes()
-		myHashesMap := make(map[string]bool)
+	if len(inv.Items) > maxInvPerMsg {
+		s.misbehaving(p, scoreOversized, fmt.Sprintf("inv with %d items (maximum %d)", len(inv.Items), maxInvPerMsg))
+		return
+	}
 
-		for _, hash := range myHashes {
-			myHashesMap[hex.EncodeToString(hash)] = true
-		}
+	logP2P.Debug("Received inventory", "type", inv.Type, "count", len(inv.Items), "peer", p.String())
+	p.addKnownInventory(inv.Items...)
 
-		// 상대방이 보낸 해시 목록을 순회하며,
-		// 내가 없는 해시만 요청할 블록 슬라이스에 추가
-		var hashesToRequest [][]byte
+	// 모르는 블록이 있으면 헤더부터 받아옴 (헤더를 검증한 뒤 본문을 요청)
+	if inv.Type == "block" {
 		for _, hash := range inv.Items {
-			if !myHashesMap[hex.EncodeToString(hash)] {
-				hashesToRequest = append(hashesToRequest, hash)
+			if !s.bc.HasHeader(hash) {
+				s.sendGetHeaders(p)
+				break
 			}
 		}
-
-		// hashesToRequest가 비어있으면,
-		// 요청할 데이터가 없으므로 return
-		if len(hashesToRequest) == 0 {
-			fmt.Println("No new blocks to request. We are synced.")
-			return
-		}
-
-		// 목록 뒤집기
-		// inv.Items는 bc.Iterator()에 의해 만들어졌고, Iterator는 최근것부터 순회하므로
-		// hashesToRequest에 있는 값은 최근 블록해시부터 순차적으로 쌓인 값이기 때문에 목록을 뒤집이서,
-		// 가장 과거의 블록부터 요청할 수 있도록 해야함.
-		for i, j := 0, len(hashesToRequest)-1; i < j; i, j = i+1, j-1 {
-			hashesToRequest[i], hashesToRequest[j] = hashesToRequest[j], hashesToRequest[i]
-		}
-
-		// 뒤집힌 목록을 '다운로드 큐' 로 설정
-		blocksInTransit = hashesToRequest
-
-		hashToRequest := hashesToRequest[0]
-		s.sendGetData(inv.AddrFrom, "block", hashToRequest)
-
-		fmt.Printf("Requesting block %x from %s\n", hashToRequest, inv.AddrFrom)
 	}
 
+	// 멤풀에 없고 다른 피어에게 요청 중이지 않은 트랜잭션을 한 번에 요청
 	if inv.Type == "tx" {
-		txHash := hex.EncodeToString(inv.Items[0])
-		if !s.mempool.Exists(txHash) {
-			s.sendGetData(inv.AddrFrom, "tx", inv.Items[0])
+		now := time.Now()
+		var wanted [][]byte
+		for _, txid := range inv.Items {
+			if !s.mempool.Exists(hex.EncodeToString(txid)) && s.txRequests.announce(txid, p, now) {
+				wanted = append(wanted, txid)
+			}
+		}
+		if len(wanted) > 0 {
+			s.sendGetData(p, "tx", wanted...)
 		}
 	}
 }
 
-func (s *Server) sendGetBlocks(addr string) {
-	payload := gobEncode(GetBlocks{AddrFrom: s.nodeAddress})
-	request := append(commandToBytes("getblocks"), payload...)
-	sendData(addr, request)
-}
-
-func (s *Server) handleGetBlocks(payload []byte) {
-	var getBlocks GetBlocks
-	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&getBlocks); err != nil {
-		log.Panic(err)
-	}
-
-	blockHashes := s.bc.GetBlockHashes()
-
-	s.sendInv(getBlocks.AddrFrom, "block", blockHashes)
-}
-
-func (s *Server) sendGetData(addr, kind string, id []byte) {
+// 'getdata' 메시지 전송
+func (s *Server) sendGetData(p *Peer, kind string, items ...[]byte) {
 	getData := GetData{
 		AddrFrom: s.nodeAddress,
 		Type:     kind,
-		ID:       id,
+		Items:    items,
 	}
 
-	request := append(commandToBytes("getdata"), gobEncode(getData)...)
-	sendData(addr, request)
+	s.sendMessage(p, "getdata", getData)
 }
 
-// 'getData' 요청을 처리
-// 'getData'를 보낸 노드에게, 'block' 메시지로 응답
-func (s *Server) handleGetData(payload []byte) {
+// 'getdata' 요청을 처리
+// 요청한 블록/트랜잭션을 'block', 'tx' 메시지로 보내고, 없는 항목은 'notfound'로 알림
+func (s *Server) handleGetData(p *Peer, payload []byte) {
 	var getData GetData
 
 	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&getData); err != nil {
-		log.Panic(err)
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed getdata: %v", err))
+		return
+	}
+	if len(getData.Items) > maxInvPerMsg {
+		s.misbehaving(p, scoreOversized, fmt.Sprintf("getdata with %d items (maximum %d)", len(getData.Items), maxInvPerMsg))
+		return
 	}
 
-	if getData.Type == "block" {
-		block, err := s.bc.GetBlock(getData.ID)
-		if err != nil {
-			fmt.Printf("[GetData] Block %x not found\n", getData.ID)
-			return
+	var notFound [][]byte
+	for _, id := range getData.Items {
+		switch getData.Type {
+		case "block":
+			block, err := s.bc.GetBlock(id)
+			if errors.Is(err, ErrBlockPruned) {
+				// prune된 블록은 제공하지 않음
+				logP2P.Debug("Requested block has been pruned, not serving", hexAttr("hash", id), "peer", p.String())
+				notFound = append(notFound, id)
+				continue
+			}
+			if err != nil {
+				logP2P.Debug("Requested block not found", hexAttr("hash", id), "peer", p.String())
+				notFound = append(notFound, id)
+				continue
+			}
+			s.sendBlock(p, block)
+		case "tx":
+			tx := s.mempool.Get(hex.EncodeToString(id))
+			if tx == nil {
+				logP2P.Debug("Requested transaction not found in mempool", hexAttr("txid", id), "peer", p.String())
+				notFound = append(notFound, id)
+				continue
+			}
+			s.sendTx(p, tx)
 		}
-		s.sendBlock(getData.AddrFrom, block)
 	}
 
-	if getData.Type == "tx" {
-		tx := s.mempool.Get(hex.EncodeToString(getData.ID))
-		if tx == nil {
-			fmt.Printf("[GetData] TX %x not found in mempool\n", getData.ID)
-			return
-		}
-		s.sendTx(tx, getData.AddrFrom)
+	if len(notFound) > 0 {
+		s.sendNotFound(p, getData.Type, notFound)
 	}
 }
 
 // 'block' 메시지 전송
 // 블록 데이터를 전달
-func (s *Server) sendBlock(addr string, block *Block) {
+func (s *Server) sendBlock(p *Peer, block *Block) {
 	blockData := block.Serialize()
 	blockMsg := BlockMsg{
 		AddrFrom: s.nodeAddress,
 		Block:    blockData,
 	}
-	request := append(commandToBytes("block"), gobEncode(blockMsg)...)
-	sendData(addr, request)
+
+	p.addKnownInventory(block.Hash)
+	s.sendMessage(p, "block", blockMsg)
 }
 
 // 'block' 메시지를 처리
-// 블록을 검증하고, DB에 블록을 추가
-func (s *Server) handleBlock(payload []byte) {
+// 블록을 검증하고, DB에 블록을 추가 (순서 없이 도착한 블록은 다운로드 스케줄러가 보관)
+func (s *Server) handleBlock(p *Peer, payload []byte) {
 	var blockMsg BlockMsg
 
 	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&blockMsg); err != nil {
-		log.Panic(err)
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed block message: %v", err))
+		return
 	}
 
-	block := DeserializeBlock(blockMsg.Block)
-	fmt.Printf("Received a new block! Hash: %x, Height: %d\n", block.Hash, block.Height)
-
-	err := s.bc.AddBlock(block)
-	// 블록 추가 실패시
+	block, err := DeserializeBlock(blockMsg.Block)
 	if err != nil {
-		fmt.Printf("Error adding block %x: %v\n", block.Hash, err)
-
-		// 실패한 블록이 우리가 요청한 블록이면, 큐를 비워 이 피어로부터의 동기화를 중단
-		// 블록 추가에 실패했다는건, 해당 피어가 보낸 블록이 가짜이거나, 깨졌거나, 우리 체인과 호환되지 않는 블록이라는 뜻
-		// 따라서, 해당 피어로부터 계속 블록을 받는 것은 시간과 대역폭 낭비이고, 해당 피어가 보낸 해시 목록(Inv)도 신뢰할 수 없기 때문에
-		// blockInTransit도 비움 (fail-fast)
-		if len(blocksInTransit) > 0 && bytes.Equal(block.Hash, blocksInTransit[0]) {
-			blocksInTransit = [][]byte{} // 큐 비우기
-		}
-
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed block: %v", err))
 		return
 	}
+	logP2P.Debug("Received block", hexAttr("hash", block.Hash), "height", block.Height, "peer", p.String())
+	p.addKnownInventory(block.Hash)
 
-	// 블록 추가에 성공하면 해당 블록에 있는 트랜잭션을 멤풀에서 제거
-	s.mempool.Clear(block)
-
-	// 블록 추가 성공시
-	if len(blocksInTransit) > 0 {
-		// 방금 추가된 블록이 큐의 첫번째 항목(요청했던 블륵)인지 확인
-		if bytes.Equal(block.Hash, blocksInTransit[0]) {
-			// 큐에서 첫번째 항목 제거(pop)
-			blocksInTransit = blocksInTransit[1:]
-
-			// 아직 동기화해야 할 블록이 남아있으면,
-			if len(blocksInTransit) > 0 {
-				nextHash := blocksInTransit[0]
-				s.sendGetData(blockMsg.AddrFrom, "block", nextHash)
-				fmt.Printf("Requesting next block %x from %s\n", nextHash, blockMsg.AddrFrom)
-			} else {
-				// 큐가 비었다면
-				fmt.Println("Block sync complete.")
-				fmt.Println("Re-indexing UTXO set for consistency...")
-				// 대규모 동기화 후에는 UTXO Set을 Reindex 하여 상태를 확실히 맞추는 것이 안전함.
-				utxoSet := UTXOSet{s.bc}
-				utxoSet.Reindex()
-				fmt.Println("UTXO set re-indexed.")
-			}
+	// 재구성 중이던 compact block이면 더 기다리지 않음
+	s.compactBlocks.take(block.Hash, nil)
 
-		}
-	}
+	s.receiveBlock(p, block)
 }
 
 // gob encoding 헬퍼 함수
@@ -568,11 +768,3 @@ func gobEncode(data any) []byte {
 
 	return buf.Bytes()
 }
-
-func safeStringToInt(s string) int {
-	i, err := strconv.Atoi(s)
-	if err != nil {
-		log.Panic(err)
-	}
-	return i
-}
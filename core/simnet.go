@@ -0,0 +1,518 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	simAcceptBacklog    = 64                     // Accept 하지 않은 채로 쌓아둘 수 있는 연결 수
+	simFirstPort        = 40000                  // 연결한 쪽 주소에 붙이는 포트의 시작값
+	defaultReorderDelay = 100 * time.Millisecond // ReorderDelay를 지정하지 않았을 때 메시지를 더 늦추는 시간
+)
+
+var (
+	errSimPartitioned = errors.New("network is partitioned")
+	errSimReset       = errors.New("connection reset by peer")
+)
+
+// 가상 네트워크에서 한 방향 링크의 특성
+type LinkConfig struct {
+	Latency      time.Duration // 메시지가 도착하기까지 걸리는 시간
+	Jitter       time.Duration // 지연에 더해지는 0 ~ Jitter 사이의 무작위 시간
+	DropRate     float64       // 메시지를 버릴 확률 (0~1)
+	ReorderRate  float64       // 메시지를 ReorderDelay만큼 더 늦춰 뒤에 보낸 메시지가 먼저 도착하게 할 확률 (0~1)
+	ReorderDelay time.Duration // 0이면 defaultReorderDelay
+}
+
+// 가상 네트워크에서 오간 메시지 수
+type SimStats struct {
+	Sent        uint64 // 보낸 메시지
+	Delivered   uint64 // 도착한 메시지
+	Dropped     uint64 // DropRate에 따라 버린 메시지
+	Partitioned uint64 // 파티션으로 나뉜 노드 사이라서 버린 메시지
+}
+
+// 메모리 안의 가상 P2P 네트워크
+// 한 프로세스에서 여러 Server를 실행하는 테스트용으로, 노드마다 Transport(addr)를 ServerConfig에 지정함
+//   - 연결의 Write 한 번을 메시지 하나로 보고, 링크 설정에 따라 지연시키거나 버리거나 순서를 바꿈
+//     (Peer는 메시지마다 Write를 한 번 호출하므로 메시지 경계가 유지됨.
+//     TLS 레코드는 버리거나 순서를 바꾸면 연결이 깨지므로 암호화한 노드에는 지연만 사용)
+//   - Partition으로 노드들을 그룹으로 나누면 그룹 사이의 연결 시도는 실패하고 기존 연결의 메시지는 버려짐
+//     (연결 자체는 끊지 않으므로 Heal 하면 다시 메시지가 오가고, 오래 나뉘어 있으면 ping 타임아웃으로 끊김)
+//   - 무작위 결정은 seed로 만든 난수를 사용하므로, 같은 순서로 보낸 메시지에는 같은 결정이 내려짐
+type SimNetwork struct {
+	rng         *rand.Rand
+	listeners   map[string]*simListener
+	defaultLink LinkConfig
+	links       map[[2]string]LinkConfig // key: {보내는 노드, 받는 노드}
+	groups      map[string]int           // 파티션 그룹 (없는 노드는 0번 그룹)
+	nextPort    int
+	stats       SimStats
+	lock        sync.Mutex
+}
+
+func NewSimNetwork(seed int64) *SimNetwork {
+	return &SimNetwork{
+		rng:       rand.New(rand.NewSource(seed)),
+		listeners: make(map[string]*simListener),
+		links:     make(map[[2]string]LinkConfig),
+		groups:    make(map[string]int),
+		nextPort:  simFirstPort,
+	}
+}
+
+// addr 노드가 사용할 Transport (addr는 노드의 P2P 주소, 예: "localhost:3000")
+func (n *SimNetwork) Transport(addr string) Transport {
+	return &simTransport{net: n, local: addr}
+}
+
+// 따로 설정하지 않은 모든 링크에 적용할 설정
+func (n *SimNetwork) SetDefaultLink(cfg LinkConfig) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.defaultLink = cfg
+}
+
+// from 노드에서 to 노드로 가는 방향의 링크 설정 (양방향이면 두 번 호출)
+func (n *SimNetwork) SetLink(from, to string, cfg LinkConfig) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.links[[2]string{from, to}] = cfg
+}
+
+// 네트워크를 그룹으로 나눔. 같은 그룹의 노드끼리만 통신할 수 있음
+// 어느 그룹에도 넣지 않은 노드들은 함께 하나의 그룹이 됨. 다시 호출하면 이전 파티션을 대체함
+func (n *SimNetwork) Partition(groups ...[]string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, addr := range group {
+			n.groups[addr] = i + 1
+		}
+	}
+}
+
+// 파티션을 없애 모든 노드가 다시 통신할 수 있게 함
+func (n *SimNetwork) Heal() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.groups = make(map[string]int)
+}
+
+func (n *SimNetwork) Stats() SimStats {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.stats
+}
+
+// (n.lock을 잡은 상태에서 호출)
+func (n *SimNetwork) reachable(from, to string) bool {
+	return n.groups[from] == n.groups[to]
+}
+
+// (n.lock을 잡은 상태에서 호출)
+func (n *SimNetwork) link(from, to string) LinkConfig {
+	if cfg, ok := n.links[[2]string{from, to}]; ok {
+		return cfg
+	}
+	return n.defaultLink
+}
+
+func (n *SimNetwork) listen(addr string) (net.Listener, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if _, ok := n.listeners[addr]; ok {
+		return nil, fmt.Errorf("listen %s: address already in use", addr)
+	}
+	l := &simListener{
+		net:     n,
+		addr:    addr,
+		backlog: make(chan net.Conn, simAcceptBacklog),
+		done:    make(chan struct{}),
+	}
+	n.listeners[addr] = l
+	return l, nil
+}
+
+// from 노드에서 to 노드의 리스너로 연결
+// 받는 쪽에서 보이는 연결 주소는 TCP와 같이 127.0.0.1:<포트> 형태
+func (n *SimNetwork) dial(from, to string) (net.Conn, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	l, ok := n.listeners[to]
+	if !ok {
+		return nil, fmt.Errorf("dial %s: connection refused", to)
+	}
+	if !n.reachable(from, to) {
+		return nil, fmt.Errorf("dial %s: %w", to, errSimPartitioned)
+	}
+
+	n.nextPort++
+	fromAddr := simAddr(fmt.Sprintf("127.0.0.1:%d", n.nextPort))
+	out := newSimPipe(n, from, to)
+	in := newSimPipe(n, to, from)
+
+	select {
+	case l.backlog <- &simConn{local: simAddr(to), remote: fromAddr, r: out, w: in}:
+	default:
+		return nil, fmt.Errorf("dial %s: connection refused (backlog full)", to)
+	}
+	return &simConn{local: fromAddr, remote: simAddr(to), r: in, w: out}, nil
+}
+
+// 메시지 하나를 보낼 때 링크 설정과 파티션에 따른 결정
+// 반환값: 전달 여부, 지연, 순서를 바꿀지 여부
+func (n *SimNetwork) route(from, to string) (bool, time.Duration, bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.stats.Sent++
+	cfg := n.link(from, to)
+
+	delay := cfg.Latency
+	if cfg.Jitter > 0 {
+		delay += time.Duration(n.rng.Int63n(int64(cfg.Jitter) + 1))
+	}
+	drop := cfg.DropRate > 0 && n.rng.Float64() < cfg.DropRate
+	reorder := cfg.ReorderRate > 0 && n.rng.Float64() < cfg.ReorderRate
+	if reorder {
+		if cfg.ReorderDelay > 0 {
+			delay += cfg.ReorderDelay
+		} else {
+			delay += defaultReorderDelay
+		}
+	}
+
+	switch {
+	case !n.reachable(from, to):
+		n.stats.Partitioned++
+		return false, 0, false
+	case drop:
+		n.stats.Dropped++
+		return false, 0, false
+	}
+	return true, delay, reorder
+}
+
+func (n *SimNetwork) delivered(count int) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.stats.Delivered += uint64(count)
+}
+
+type simTransport struct {
+	net   *SimNetwork
+	local string // 이 노드의 P2P 주소
+}
+
+func (t *simTransport) Listen(addr string) (net.Listener, error) {
+	return t.net.listen(addr)
+}
+
+// 가상 네트워크의 연결은 바로 성공하거나 실패하므로 timeout은 사용하지 않음
+func (t *simTransport) Dial(addr string, _ time.Duration) (net.Conn, error) {
+	return t.net.dial(t.local, addr)
+}
+
+type simAddr string
+
+func (a simAddr) Network() string { return "sim" }
+func (a simAddr) String() string  { return string(a) }
+
+type simListener struct {
+	net       *SimNetwork
+	addr      string
+	backlog   chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *simListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.backlog:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// 리스너를 닫고 아직 Accept 하지 않은 연결도 닫음
+func (l *simListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.net.lock.Lock()
+		if l.net.listeners[l.addr] == l {
+			delete(l.net.listeners, l.addr)
+		}
+		l.net.lock.Unlock()
+
+		close(l.done)
+		for {
+			select {
+			case conn := <-l.backlog:
+				conn.Close()
+			default:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func (l *simListener) Addr() net.Addr { return simAddr(l.addr) }
+
+// 메시지가 도착할 예정인 시각
+type simPacket struct {
+	data []byte
+	at   time.Time
+	fin  bool // 보내는 쪽이 연결을 닫음 (앞서 보낸 메시지가 모두 도착한 뒤에 전달)
+}
+
+// 한 방향으로 메시지를 전달하는 통로
+type simPipe struct {
+	net      *SimNetwork
+	from, to string
+	pending  []simPacket   // 도착 예정인 메시지 (도착 시각 순)
+	buf      []byte        // 도착해서 읽을 수 있는 데이터
+	lastAt   time.Time     // 순서대로 보낸 마지막 메시지의 도착 시각 (뒤 메시지가 앞지르지 않도록)
+	timer    *time.Timer   // 다음 메시지가 도착할 때 deliver 호출
+	closing  bool          // 보내는 쪽이 연결을 닫음
+	eof      bool          // 보내는 쪽이 닫은 뒤 남은 메시지가 모두 도착함
+	closed   bool          // 받는 쪽이 연결을 닫음
+	deadline time.Time     // 읽기 데드라인
+	readable chan struct{} // 읽을 데이터가 생기거나 상태가 바뀌면 신호
+	lock     sync.Mutex
+}
+
+func newSimPipe(n *SimNetwork, from, to string) *simPipe {
+	return &simPipe{net: n, from: from, to: to, readable: make(chan struct{}, 1)}
+}
+
+func (p *simPipe) signal() {
+	select {
+	case p.readable <- struct{}{}:
+	default:
+	}
+}
+
+func (p *simPipe) write(data []byte) error {
+	p.lock.Lock()
+	closing, closed := p.closing, p.closed
+	p.lock.Unlock()
+	if closing {
+		return net.ErrClosed
+	}
+	if closed {
+		return errSimReset
+	}
+
+	ok, delay, reorder := p.net.route(p.from, p.to)
+	if !ok {
+		return nil
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	at := time.Now().Add(delay)
+	if !reorder {
+		if at.Before(p.lastAt) {
+			at = p.lastAt
+		}
+		p.lastAt = at
+	}
+	p.schedule(simPacket{data: slices.Clone(data), at: at})
+	return nil
+}
+
+// 보내는 쪽이 연결을 닫음. 늦춰진 메시지를 포함해 앞서 보낸 메시지가 모두 도착한 뒤 EOF
+func (p *simPipe) closeWrite() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closing {
+		return
+	}
+	p.closing = true
+
+	at := time.Now()
+	if at.Before(p.lastAt) {
+		at = p.lastAt
+	}
+	if n := len(p.pending); n > 0 && at.Before(p.pending[n-1].at) {
+		at = p.pending[n-1].at
+	}
+	p.schedule(simPacket{at: at, fin: true})
+}
+
+// 받는 쪽이 연결을 닫음. 도착하지 않은 메시지는 버림
+func (p *simPipe) closeRead() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.closed = true
+	p.buf = nil
+	p.pending = nil
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.signal()
+}
+
+// (p.lock을 잡은 상태에서 호출)
+func (p *simPipe) schedule(pkt simPacket) {
+	i := sort.Search(len(p.pending), func(i int) bool { return p.pending[i].at.After(pkt.at) })
+	p.pending = slices.Insert(p.pending, i, pkt)
+	p.deliverLocked()
+}
+
+func (p *simPipe) deliver() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.deliverLocked()
+}
+
+// 도착 시각이 된 메시지를 읽을 수 있게 하고, 다음 메시지의 도착에 맞춰 타이머를 설정
+// (p.lock을 잡은 상태에서 호출)
+func (p *simPipe) deliverLocked() {
+	if p.closed {
+		return
+	}
+
+	now := time.Now()
+	count := 0
+	for len(p.pending) > 0 && !p.pending[0].at.After(now) {
+		pkt := p.pending[0]
+		p.pending = p.pending[1:]
+		if pkt.fin {
+			p.eof = true
+		} else {
+			p.buf = append(p.buf, pkt.data...)
+			count++
+		}
+		p.signal()
+	}
+	if count > 0 {
+		p.net.delivered(count)
+	}
+
+	if len(p.pending) > 0 {
+		wait := p.pending[0].at.Sub(now)
+		if p.timer == nil {
+			p.timer = time.AfterFunc(wait, p.deliver)
+		} else {
+			p.timer.Reset(wait)
+		}
+	}
+}
+
+func (p *simPipe) read(b []byte) (int, error) {
+	for {
+		p.lock.Lock()
+		switch {
+		case p.closed:
+			p.lock.Unlock()
+			return 0, net.ErrClosed
+		case len(p.buf) > 0:
+			n := copy(b, p.buf)
+			p.buf = p.buf[n:]
+			p.lock.Unlock()
+			return n, nil
+		case p.eof:
+			p.lock.Unlock()
+			return 0, io.EOF
+		}
+		deadline := p.deadline
+		p.lock.Unlock()
+
+		if deadline.IsZero() {
+			<-p.readable
+			continue
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-p.readable:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (p *simPipe) setDeadline(t time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.deadline = t
+	p.signal()
+}
+
+// 가상 네트워크의 연결 한쪽 끝
+// 쓰기는 막히지 않으므로 쓰기 데드라인은 이미 지났는지만 확인함
+type simConn struct {
+	local, remote simAddr
+	r, w          *simPipe // r: 상대방 → 나, w: 나 → 상대방
+	writeDeadline time.Time
+	closeOnce     sync.Once
+	lock          sync.Mutex
+}
+
+func (c *simConn) Read(b []byte) (int, error) {
+	return c.r.read(b)
+}
+
+func (c *simConn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	deadline := c.writeDeadline
+	c.lock.Unlock()
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	if err := c.w.write(b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *simConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.w.closeWrite()
+		c.r.closeRead()
+	})
+	return nil
+}
+
+func (c *simConn) LocalAddr() net.Addr  { return c.local }
+func (c *simConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *simConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *simConn) SetReadDeadline(t time.Time) error {
+	c.r.setDeadline(t)
+	return nil
+}
+
+func (c *simConn) SetWriteDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.writeDeadline = t
+	return nil
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// a에서 b로 연결하고 양쪽 연결을 반환
+func simConnect(t *testing.T, sim *SimNetwork, a, b string) (net.Conn, net.Conn) {
+	t.Helper()
+	l, err := sim.Transport(b).Listen(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	out, err := sim.Transport(a).Dial(b, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		out.Close()
+		in.Close()
+	})
+	return out, in
+}
+
+// 메시지를 하나씩 보냄 (Write 한 번이 메시지 하나)
+func simSend(t *testing.T, conn net.Conn, msgs ...string) {
+	t.Helper()
+	for _, msg := range msgs {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// wait 동안 도착한 데이터를 모두 읽음
+func simReceive(t *testing.T, conn net.Conn, wait time.Duration) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(wait))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var got []byte
+	buf := make([]byte, 64)
+	for {
+		n, err := conn.Read(buf)
+		got = append(got, buf[:n]...)
+		if errors.Is(err, os.ErrDeadlineExceeded) || err == io.EOF {
+			return string(got)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSimNetworkDeliversInOrder(t *testing.T) {
+	sim := NewSimNetwork(1)
+	sim.SetDefaultLink(LinkConfig{Latency: 5 * time.Millisecond, Jitter: 5 * time.Millisecond})
+	out, in := simConnect(t, sim, "a:1", "b:1")
+
+	if host, _, err := net.SplitHostPort(in.RemoteAddr().String()); err != nil || host != "127.0.0.1" {
+		t.Fatalf("remote address seen by listener = %s, want 127.0.0.1:<port>", in.RemoteAddr())
+	}
+
+	// jitter가 있어도 순서는 유지됨
+	simSend(t, out, "1", "2", "3", "4", "5")
+	if got := simReceive(t, in, 100*time.Millisecond); got != "12345" {
+		t.Fatalf("received %q, want %q", got, "12345")
+	}
+
+	// 닫으면 앞서 보낸 메시지가 모두 도착한 뒤 EOF
+	simSend(t, out, "6")
+	out.Close()
+	if got := simReceive(t, in, time.Second); got != "6" {
+		t.Fatalf("received %q before EOF, want %q", got, "6")
+	}
+	if _, err := in.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read after close: err = %v, want EOF", err)
+	}
+
+	stats := sim.Stats()
+	if stats.Sent != 6 || stats.Delivered != 6 || stats.Dropped != 0 || stats.Partitioned != 0 {
+		t.Fatalf("stats = %+v, want 6 sent and delivered", stats)
+	}
+}
+
+func TestSimNetworkPartition(t *testing.T) {
+	sim := NewSimNetwork(1)
+	out, in := simConnect(t, sim, "a:1", "b:1")
+	if _, err := sim.Transport("c:1").Listen("c:1"); err != nil {
+		t.Fatal(err)
+	}
+
+	sim.Partition([]string{"a:1"}, []string{"b:1"})
+
+	// 다른 그룹으로는 연결할 수 없고, 어느 그룹에도 없는 노드끼리는 같은 그룹
+	if _, err := sim.Transport("a:1").Dial("b:1", time.Second); !errors.Is(err, errSimPartitioned) {
+		t.Fatalf("dial across partition: err = %v, want errSimPartitioned", err)
+	}
+	if _, err := sim.Transport("a:1").Dial("c:1", time.Second); !errors.Is(err, errSimPartitioned) {
+		t.Fatalf("dial to ungrouped node: err = %v, want errSimPartitioned", err)
+	}
+	if _, err := sim.Transport("d:1").Dial("c:1", time.Second); err != nil {
+		t.Fatalf("dial between ungrouped nodes: %v", err)
+	}
+
+	// 기존 연결은 유지되지만 메시지는 버려짐
+	simSend(t, out, "lost")
+	if got := simReceive(t, in, 50*time.Millisecond); got != "" {
+		t.Fatalf("received %q across partition", got)
+	}
+
+	sim.Heal()
+	simSend(t, out, "ok")
+	if got := simReceive(t, in, 50*time.Millisecond); got != "ok" {
+		t.Fatalf("received %q after heal, want %q", got, "ok")
+	}
+	if _, err := sim.Transport("a:1").Dial("b:1", time.Second); err != nil {
+		t.Fatalf("dial after heal: %v", err)
+	}
+
+	if stats := sim.Stats(); stats.Partitioned != 1 || stats.Delivered != 1 {
+		t.Fatalf("stats = %+v, want 1 partitioned and 1 delivered", stats)
+	}
+}
+
+func TestSimNetworkDrop(t *testing.T) {
+	sim := NewSimNetwork(1)
+	out, in := simConnect(t, sim, "a:1", "b:1")
+
+	sim.SetLink("a:1", "b:1", LinkConfig{DropRate: 1})
+	simSend(t, out, "x", "y")
+	if got := simReceive(t, in, 50*time.Millisecond); got != "" {
+		t.Fatalf("received %q with drop rate 1", got)
+	}
+
+	// 링크 설정은 방향별
+	simSend(t, in, "back")
+	if got := simReceive(t, out, 50*time.Millisecond); got != "back" {
+		t.Fatalf("received %q on reverse link, want %q", got, "back")
+	}
+
+	sim.SetLink("a:1", "b:1", LinkConfig{DropRate: 0.5})
+	for range 100 {
+		simSend(t, out, "m")
+	}
+	got := simReceive(t, in, 50*time.Millisecond)
+
+	stats := sim.Stats()
+	if stats.Dropped != 2+uint64(100-len(got)) {
+		t.Fatalf("dropped %d messages, received %d of 100 (stats %+v)", stats.Dropped-2, len(got), stats)
+	}
+	if len(got) < 25 || len(got) > 75 {
+		t.Fatalf("received %d of 100 messages with drop rate 0.5", len(got))
+	}
+	if stats.Sent != stats.Delivered+stats.Dropped {
+		t.Fatalf("stats = %+v, want sent = delivered + dropped", stats)
+	}
+}
+
+// 같은 seed로 같은 순서의 메시지를 보내면 같은 메시지가 버려짐
+func TestSimNetworkSeedIsDeterministic(t *testing.T) {
+	run := func() string {
+		sim := NewSimNetwork(42)
+		sim.SetDefaultLink(LinkConfig{DropRate: 0.3})
+		out, in := simConnect(t, sim, "a:1", "b:1")
+		for _, c := range "abcdefghijklmnopqrstuvwxyz" {
+			simSend(t, out, string(c))
+		}
+		return simReceive(t, in, 50*time.Millisecond)
+	}
+
+	first, second := run(), run()
+	if first != second {
+		t.Fatalf("same seed delivered %q and %q", first, second)
+	}
+	if len(first) == 26 || len(first) == 0 {
+		t.Fatalf("delivered %q with drop rate 0.3", first)
+	}
+}
+
+func TestSimNetworkReorder(t *testing.T) {
+	sim := NewSimNetwork(1)
+	out, in := simConnect(t, sim, "a:1", "b:1")
+
+	// 순서를 바꾸는 메시지는 ReorderDelay만큼 늦게 도착해 뒤에 보낸 메시지에 추월당함
+	sim.SetLink("a:1", "b:1", LinkConfig{ReorderRate: 1, ReorderDelay: 30 * time.Millisecond})
+	simSend(t, out, "1")
+	sim.SetLink("a:1", "b:1", LinkConfig{})
+	simSend(t, out, "2", "3")
+
+	if got := simReceive(t, in, 100*time.Millisecond); got != "231" {
+		t.Fatalf("received %q, want %q", got, "231")
+	}
+
+	// 닫을 때는 늦춰진 메시지가 도착한 뒤에 EOF
+	sim.SetLink("a:1", "b:1", LinkConfig{ReorderRate: 1, ReorderDelay: 30 * time.Millisecond})
+	simSend(t, out, "4")
+	out.Close()
+	if got := simReceive(t, in, time.Second); got != "4" {
+		t.Fatalf("received %q before EOF, want %q", got, "4")
+	}
+}
@@ -0,0 +1,125 @@
+package core
+
+// 블록체인 데이터 저장소 인터페이스
+// Blockchain, BlockchainIterator, UTXOSet은 bbolt에 직접 접근하지 않고 이 인터페이스만 사용
+// 기본 구현은 bbolt(BoltStorage)이며, 테스트/벤치마크용으로 메모리 구현(MemoryStorage)이 있음
+type Storage interface {
+	// 읽기 전용 트랜잭션
+	View(fn func(tx StorageTx) error) error
+	// 읽기/쓰기 트랜잭션. fn이 에러를 반환하면 모든 변경사항이 롤백됨
+	Update(fn func(tx StorageTx) error) error
+	Close() error
+}
+
+// 저장소 트랜잭션 안에서 사용할 수 있는 작업들
+// Get 계열 메서드는 값이 없으면 nil을 반환. 반환된 슬라이스는 트랜잭션이 끝난 뒤에도 사용할 수 있음
+type StorageTx interface {
+	// 블록 (key: 블록 해시, value: 직렬화된 블록)
+	GetBlock(hash []byte) []byte
+	PutBlock(hash, data []byte) error
+	DeleteBlock(hash []byte) error
+
+	// 마지막 블록 해시 (tip)
+	GetTip() []byte
+	SetTip(hash []byte) error
+
+	// UTXO (key: txID, value: 직렬화된 TXOutput 슬라이스)
+	GetUTXO(txID []byte) []byte
+	PutUTXO(txID, data []byte) error
+	DeleteUTXO(txID []byte) error
+	ForEachUTXO(fn func(txID, data []byte) error) error
+	ClearUTXO() error
+
+	// 스키마 버전 등 저장소 메타데이터
+	GetMeta(key string) []byte
+	PutMeta(key string, value []byte) error
+
+	// 이름으로 구분되는 보조 인덱스
+	GetIndex(index string, key []byte) []byte
+	PutIndex(index string, key, value []byte) error
+	DeleteIndex(index string, key []byte) error
+	ForEachIndex(index string, fn func(key, value []byte) error) error
+}
+
+const tipKey = "l"                 // blocksBucket 안에서 마지막 블록 해시를 가리키는 키
+const indexBucketPrefix = "index_" // 인덱스 버킷 이름 접두사
+const metadataBucket = "metadata"
+
+// 저장소 구현체가 제공하는 버킷 단위의 key/value 작업
+// 구현체는 이것만 구현하고, 블록/UTXO/인덱스 매핑은 kvStorageTx가 공통으로 처리
+type kvTx interface {
+	get(bucket string, key []byte) []byte
+	put(bucket string, key, value []byte) error
+	delete(bucket string, key []byte) error
+	forEach(bucket string, fn func(key, value []byte) error) error
+	clear(bucket string) error
+}
+
+// kvTx 위에 StorageTx를 구현
+type kvStorageTx struct {
+	kv kvTx
+}
+
+func (t kvStorageTx) GetBlock(hash []byte) []byte {
+	return t.kv.get(blocksBucket, hash)
+}
+
+func (t kvStorageTx) PutBlock(hash, data []byte) error {
+	return t.kv.put(blocksBucket, hash, data)
+}
+
+func (t kvStorageTx) DeleteBlock(hash []byte) error {
+	return t.kv.delete(blocksBucket, hash)
+}
+
+func (t kvStorageTx) GetTip() []byte {
+	return t.kv.get(blocksBucket, []byte(tipKey))
+}
+
+func (t kvStorageTx) SetTip(hash []byte) error {
+	return t.kv.put(blocksBucket, []byte(tipKey), hash)
+}
+
+func (t kvStorageTx) GetUTXO(txID []byte) []byte {
+	return t.kv.get(utxoBucket, txID)
+}
+
+func (t kvStorageTx) PutUTXO(txID, data []byte) error {
+	return t.kv.put(utxoBucket, txID, data)
+}
+
+func (t kvStorageTx) DeleteUTXO(txID []byte) error {
+	return t.kv.delete(utxoBucket, txID)
+}
+
+func (t kvStorageTx) ForEachUTXO(fn func(txID, data []byte) error) error {
+	return t.kv.forEach(utxoBucket, fn)
+}
+
+func (t kvStorageTx) ClearUTXO() error {
+	return t.kv.clear(utxoBucket)
+}
+
+func (t kvStorageTx) GetMeta(key string) []byte {
+	return t.kv.get(metadataBucket, []byte(key))
+}
+
+func (t kvStorageTx) PutMeta(key string, value []byte) error {
+	return t.kv.put(metadataBucket, []byte(key), value)
+}
+
+func (t kvStorageTx) GetIndex(index string, key []byte) []byte {
+	return t.kv.get(indexBucketPrefix+index, key)
+}
+
+func (t kvStorageTx) PutIndex(index string, key, value []byte) error {
+	return t.kv.put(indexBucketPrefix+index, key, value)
+}
+
+func (t kvStorageTx) DeleteIndex(index string, key []byte) error {
+	return t.kv.delete(indexBucketPrefix+index, key)
+}
+
+func (t kvStorageTx) ForEachIndex(index string, fn func(key, value []byte) error) error {
+	return t.kv.forEach(indexBucketPrefix+index, fn)
+}
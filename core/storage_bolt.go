@@ -0,0 +1,108 @@
+package core
+
+import (
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// bbolt 파일 기반 저장소 (기본 저장소)
+type BoltStorage struct {
+	db *bbolt.DB
+}
+
+// bbolt DB 파일을 열고 기본 버킷을 준비
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range []string{blocksBucket, utxoBucket, metadataBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStorage{db}, nil
+}
+
+func (s *BoltStorage) View(fn func(tx StorageTx) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return fn(kvStorageTx{boltTx{tx}})
+	})
+}
+
+func (s *BoltStorage) Update(fn func(tx StorageTx) error) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return fn(kvStorageTx{boltTx{tx}})
+	})
+}
+
+// 현재 DB의 일관된 스냅샷을 path에 파일로 복사
+func (s *BoltStorage) Backup(path string) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
+
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+type boltTx struct {
+	tx *bbolt.Tx
+}
+
+func (t boltTx) get(bucket string, key []byte) []byte {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	v := b.Get(key)
+	if v == nil {
+		return nil
+	}
+	// bbolt가 반환한 슬라이스는 트랜잭션 안에서만 유효하므로 복사
+	return append([]byte(nil), v...)
+}
+
+func (t boltTx) put(bucket string, key, value []byte) error {
+	b, err := t.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return err
+	}
+	return b.Put(key, value)
+}
+
+func (t boltTx) delete(bucket string, key []byte) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	return b.Delete(key)
+}
+
+func (t boltTx) forEach(bucket string, fn func(key, value []byte) error) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(fn)
+}
+
+func (t boltTx) clear(bucket string) error {
+	err := t.tx.DeleteBucket([]byte(bucket))
+	if err != nil && err != bbolt.ErrBucketNotFound {
+		return err
+	}
+	_, err = t.tx.CreateBucket([]byte(bucket))
+	return err
+}
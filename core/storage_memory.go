@@ -0,0 +1,146 @@
+package core
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// 메모리 기반 저장소
+// 디스크를 사용하지 않으므로 테스트나 벤치마크에서 여러 체인을 동시에 띄울 때 사용
+type MemoryStorage struct {
+	lock    sync.RWMutex
+	buckets map[string]map[string][]byte
+	closed  bool
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		buckets: make(map[string]map[string][]byte),
+	}
+}
+
+var errStorageClosed = errors.New("storage is closed")
+
+func (s *MemoryStorage) View(fn func(tx StorageTx) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.closed {
+		return errStorageClosed
+	}
+
+	return fn(kvStorageTx{&memoryTx{storage: s}})
+}
+
+// 변경되는 버킷은 복사본에 기록하고, fn이 성공했을 때만 원본과 교체 (copy-on-write)
+func (s *MemoryStorage) Update(fn func(tx StorageTx) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return errStorageClosed
+	}
+
+	tx := &memoryTx{storage: s, writable: true, dirty: make(map[string]map[string][]byte)}
+	if err := fn(kvStorageTx{tx}); err != nil {
+		return err
+	}
+
+	for name, bucket := range tx.dirty {
+		s.buckets[name] = bucket
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.closed = true
+	return nil
+}
+
+type memoryTx struct {
+	storage  *MemoryStorage
+	writable bool
+	dirty    map[string]map[string][]byte // 이 트랜잭션에서 변경된 버킷의 복사본
+}
+
+var errTxNotWritable = errors.New("storage tx not writable")
+
+func (t *memoryTx) bucket(name string) map[string][]byte {
+	if b, ok := t.dirty[name]; ok {
+		return b
+	}
+	return t.storage.buckets[name]
+}
+
+// 쓰기용 버킷 복사본을 반환
+func (t *memoryTx) writableBucket(name string) (map[string][]byte, error) {
+	if !t.writable {
+		return nil, errTxNotWritable
+	}
+	if b, ok := t.dirty[name]; ok {
+		return b, nil
+	}
+
+	b := make(map[string][]byte, len(t.storage.buckets[name]))
+	for k, v := range t.storage.buckets[name] {
+		b[k] = v
+	}
+	t.dirty[name] = b
+	return b, nil
+}
+
+func (t *memoryTx) get(bucket string, key []byte) []byte {
+	v, ok := t.bucket(bucket)[string(key)]
+	if !ok {
+		return nil
+	}
+	return append([]byte(nil), v...)
+}
+
+func (t *memoryTx) put(bucket string, key, value []byte) error {
+	b, err := t.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+	b[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (t *memoryTx) delete(bucket string, key []byte) error {
+	b, err := t.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+	delete(b, string(key))
+	return nil
+}
+
+// bbolt와 동일하게 key 순서대로 순회
+func (t *memoryTx) forEach(bucket string, fn func(key, value []byte) error) error {
+	b := t.bucket(bucket)
+
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := fn([]byte(k), append([]byte(nil), b[k]...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *memoryTx) clear(bucket string) error {
+	if !t.writable {
+		return errTxNotWritable
+	}
+	t.dirty[bucket] = make(map[string][]byte)
+	return nil
+}
@@ -12,7 +12,6 @@ import (
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	ecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
-	"github.com/mr-tron/base58"
 )
 
 const subsidy = 10 // 구현 간소화를 위해 10으로 고정
@@ -70,13 +69,13 @@ func (tx *Transaction) IsCoinbase() bool {
 }
 
 // 채굴 보상을 위한 코인베이스 트랜잭션 생성
-func NewCoinbaseTX(to, data string) *Transaction {
+func NewCoinbaseTX(to, data string) (*Transaction, error) {
 	// 코인베이스 트랜잭션의 데이터는 자유롭게 생성
 	if data == "" {
 		data = fmt.Sprintf("Tx created at '%s', Reward to '%s'", strconv.FormatInt(time.Now().UnixNano(), 10), to)
 	}
 
-	log.Println("coinbase tx data: ", data)
+	logMiner.Debug("Coinbase transaction data", "data", data)
 	// 코인베이스는 참조할 Output이 없으므로, Txid=nil, Vout=-1
 	txin := &TXInput{
 		Txid:      nil,
@@ -84,7 +83,10 @@ func NewCoinbaseTX(to, data string) *Transaction {
 		Signature: []byte(data),
 	}
 
-	txout := NewTXOutput(subsidy, to)
+	txout, err := NewTXOutput(subsidy, to)
+	if err != nil {
+		return nil, err
+	}
 
 	tx := &Transaction{
 		ID:   nil,
@@ -92,29 +94,30 @@ func NewCoinbaseTX(to, data string) *Transaction {
 		VOut: []*TXOutput{txout},
 	}
 	tx.SetID()
-	log.Println("Coinbase TX ID: ", hex.EncodeToString(tx.ID))
+	logMiner.Debug("Created coinbase transaction", hexAttr("txid", tx.ID), "reward_to", to)
 
-	return tx
+	return tx, nil
 }
 
 // 금액과 주소를 받아 새 TXOutput 생성
 // 주소를 통해 잠금
-func NewTXOutput(value int, address string) *TXOutput {
+func NewTXOutput(value int, address string) (*TXOutput, error) {
 	txo := &TXOutput{value, nil}
-	//
-	txo.Lock([]byte(address))
-	return txo
+	if err := txo.Lock([]byte(address)); err != nil {
+		return nil, err
+	}
+	return txo, nil
 }
 
-func (out *TXOutput) Lock(address []byte) {
-	// Base58 디코딩
-	pubKeyHash, err := base58.Decode(string(address))
+// 주소의 PubKeyHash로 출력을 잠금. 주소를 디코딩할 수 없으면 ErrInvalidAddress
+// (체크섬은 확인하지 않음. 주소를 입력받는 곳에서 ValidateAddress로 확인)
+func (out *TXOutput) Lock(address []byte) error {
+	pubKeyHash, err := decodeAddress(string(address))
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
-	// 체크섬(4바이트)와 버전(1바이트)를 제외하고 실제 PubKeyHash(20바이트)만 추출
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
 	out.PubKeyHash = pubKeyHash
+	return nil
 }
 
 func (out *TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
@@ -127,17 +130,16 @@ func (in *TXInput) UsesKey(pubKeyHash []byte) bool {
 }
 
 // 트랜잭션에 서명
-func (tx *Transaction) Sign(privKey *btcec.PrivateKey, prevTXs map[string]*Transaction) {
+// 입력이 참조하는 트랜잭션이 prevTXs에 없으면 ErrTxNotFound
+func (tx *Transaction) Sign(privKey *btcec.PrivateKey, prevTXs map[string]*Transaction) error {
 	// 코인베이스 트랜잭션은 서명하지 않음
 	if tx.IsCoinbase() {
-		return
+		return nil
 	}
 
 	// 입력(Input)에 사용된 이전 트랜잭션(prevTX)이 유효한지 확인
-	for _, vin := range tx.Vin {
-		if prevTXs[hex.EncodeToString(vin.Txid)] == nil {
-			log.Panic("ERROR: Previous transaction is not found")
-		}
+	if err := checkInputs(tx, prevTXs); err != nil {
+		return err
 	}
 
 	// 서명을 위한 복사본 생성
@@ -168,6 +170,22 @@ func (tx *Transaction) Sign(privKey *btcec.PrivateKey, prevTXs map[string]*Trans
 		tx.Vin[inID].Signature = signature.Serialize()
 		tx.Vin[inID].PubKey = privKey.PubKey().SerializeCompressed()
 	}
+
+	return nil
+}
+
+// 모든 입력이 참조하는 트랜잭션이 prevTXs에 있고, 출력 인덱스가 범위 안인지 확인
+func checkInputs(tx *Transaction, prevTXs map[string]*Transaction) error {
+	for inID, vin := range tx.Vin {
+		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
+		if prevTx == nil {
+			return fmt.Errorf("%w: input %d spends %x", ErrTxNotFound, inID, vin.Txid)
+		}
+		if vin.Vout < 0 || vin.Vout >= len(prevTx.VOut) {
+			return fmt.Errorf("%w: input %d spends output %d of %x which has %d outputs", ErrInvalidTransaction, inID, vin.Vout, vin.Txid, len(prevTx.VOut))
+		}
+	}
+	return nil
 }
 
 // 서명을 위해 트랜잭션 복사본 생성
@@ -186,16 +204,17 @@ func (tx *Transaction) TrimmedCopy() *Transaction {
 	}
 }
 
-func (tx *Transaction) Verify(prevTXs map[string]*Transaction) bool {
+// 트랜잭션의 서명을 검증
+// 참조하는 트랜잭션이 없으면 ErrTxNotFound, 서명이 틀리면 ErrInvalidSignature,
+// 그 외 형식이 잘못되었으면 ErrInvalidTransaction (다른 노드에서 온 데이터일 수 있으므로 패닉하지 않음)
+func (tx *Transaction) Verify(prevTXs map[string]*Transaction) error {
 	// 코인베이스 트랜잭션은 서명을 하지 않으므로 검증도 필요없음
 	if tx.IsCoinbase() {
-		return true
+		return nil
 	}
 
-	for _, vin := range tx.Vin {
-		if prevTXs[hex.EncodeToString(vin.Txid)] == nil {
-			log.Panic("ERROR: Previous transaction is not found")
-		}
+	if err := checkInputs(tx, prevTXs); err != nil {
+		return err
 	}
 
 	txCopy := tx.TrimmedCopy()
@@ -212,19 +231,19 @@ func (tx *Transaction) Verify(prevTXs map[string]*Transaction) bool {
 		// 서명을 []byte -> ecdsa.Signature로 역직렬화
 		signature, err := ecdsa.ParseSignature(vin.Signature)
 		if err != nil {
-			log.Panic(err)
+			return fmt.Errorf("%w: input %d: %v", ErrInvalidSignature, inID, err)
 		}
 
 		// 공개키를 []byte -> btcec.PublicKey로 역직렬화
 		pubKey, err := btcec.ParsePubKey(vin.PubKey)
 		if err != nil {
-			log.Panic(err)
+			return fmt.Errorf("%w: input %d: bad public key: %v", ErrInvalidSignature, inID, err)
 		}
 
 		if !signature.Verify(dataToVerify, pubKey) {
-			return false
+			return fmt.Errorf("%w: input %d of %x", ErrInvalidSignature, inID, tx.ID)
 		}
 	}
 
-	return true
+	return nil
 }
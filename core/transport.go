@@ -0,0 +1,27 @@
+package core
+
+import (
+	"net"
+	"time"
+)
+
+// P2P 연결을 만드는 방법
+// 기본은 TCP이고, 테스트에서는 메모리 안의 가상 네트워크(SimNetwork)를 사용해
+// 여러 노드를 한 프로세스에서 실행할 수 있음
+type Transport interface {
+	// addr에서 연결을 받음
+	Listen(addr string) (net.Listener, error)
+	// addr에 연결. timeout 안에 연결되지 않으면 에러
+	Dial(addr string, timeout time.Duration) (net.Conn, error)
+}
+
+// 실제 TCP 연결
+type tcpTransport struct{}
+
+func (tcpTransport) Listen(addr string) (net.Listener, error) {
+	return net.Listen(protocol, addr)
+}
+
+func (tcpTransport) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout(protocol, addr, timeout)
+}
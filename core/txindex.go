@@ -0,0 +1,130 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// 트랜잭션 인덱스 (key: 트랜잭션 ID, value: 트랜잭션이 들어있는 블록 해시)
+// 켜져 있으면 FindTransaction이 블록을 스캔하지 않고 바로 찾음
+const txsIndex = "txs"
+
+// 트랜잭션 인덱스에 반영된 마지막 블록 높이
+// 인덱스를 끈 채로 실행한 뒤 다시 켜면 이 높이 다음 블록부터 이어서 만듦
+const txIndexHeightKey = "txindexheight"
+
+// 인덱스를 만들 때 한 저장소 트랜잭션에서 처리하는 블록 수
+const txIndexBatchBlocks = 500
+
+// 트랜잭션 인덱스를 켜고, 아직 인덱스에 없는 블록들을 반영 (서버를 시작하기 전에 호출)
+// prune된 블록의 트랜잭션은 인덱스에 넣지 않음
+func (bc *Blockchain) EnableTxIndex() error {
+	bc.addLock.Lock()
+	defer bc.addLock.Unlock()
+
+	var indexed int64
+	if err := bc.store.View(func(tx StorageTx) error {
+		indexed = readTxIndexHeight(tx)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	_, tipHeight, err := bc.GetTipInfo()
+	if err != nil {
+		return err
+	}
+	if indexed < tipHeight {
+		logChain.Info("Building transaction index", "from", indexed+1, "to", tipHeight)
+	}
+	for indexed < tipHeight {
+		end := min(indexed+txIndexBatchBlocks, tipHeight)
+		err := bc.store.Update(func(tx StorageTx) error {
+			for height := indexed + 1; height <= end; height++ {
+				hash := tx.GetIndex(heightsIndex, heightKey(height))
+				if hash == nil {
+					return fmt.Errorf("Block at height %d not found", height)
+				}
+				blockData := tx.GetBlock(hash)
+				if blockData == nil {
+					continue // prune된 블록
+				}
+				block, err := DeserializeBlock(blockData)
+				if err != nil {
+					return err
+				}
+				if err := indexBlockTxs(tx, block); err != nil {
+					return err
+				}
+			}
+			return writeTxIndexHeight(tx, end)
+		})
+		if err != nil {
+			return fmt.Errorf("building transaction index: %w", err)
+		}
+		indexed = end
+	}
+
+	bc.txIndex = true
+	return nil
+}
+
+// 블록의 트랜잭션들을 인덱스에 기록 (블록 추가와 같은 저장소 트랜잭션에서 호출)
+func indexBlockTxs(tx StorageTx, block *Block) error {
+	for _, t := range block.Transactions {
+		if err := tx.PutIndex(txsIndex, t.ID, block.Hash); err != nil {
+			return err
+		}
+	}
+	return writeTxIndexHeight(tx, block.Height)
+}
+
+func readTxIndexHeight(tx StorageTx) int64 {
+	v := tx.GetMeta(txIndexHeightKey)
+	if v == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(v))
+}
+
+func writeTxIndexHeight(tx StorageTx, height int64) error {
+	return tx.PutMeta(txIndexHeightKey, heightKey(height))
+}
+
+// 트랜잭션 인덱스로 트랜잭션 조회
+// 인덱스에 없으면 ErrTxNotFound, 들어있는 블록이 prune되었으면 ErrTxNotFound와 ErrBlockPruned
+func findIndexedTransaction(tx StorageTx, txID []byte) (*Transaction, error) {
+	hash := tx.GetIndex(txsIndex, txID)
+	if hash == nil {
+		return nil, fmt.Errorf("%w: %x", ErrTxNotFound, txID)
+	}
+	blockData := tx.GetBlock(hash)
+	if blockData == nil {
+		return nil, fmt.Errorf("%w: %x in block %x: %w", ErrTxNotFound, txID, hash, ErrBlockPruned)
+	}
+	block, err := DeserializeBlock(blockData)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range block.Transactions {
+		if bytes.Equal(t.ID, txID) {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %x (index points to block %x)", ErrTxNotFound, txID, hash)
+}
+
+// reorg로 끊은 블록의 트랜잭션을 인덱스에서 지움
+// 인덱스를 끈 채로 실행 중이어도 이미 인덱스에 들어간 블록이면 지워서, 다시 켰을 때 끊긴 블록을 가리키지 않도록 함
+func unindexBlockTxs(tx StorageTx, block *Block) error {
+	if readTxIndexHeight(tx) < block.Height {
+		return nil
+	}
+	for _, t := range block.Transactions {
+		if err := tx.DeleteIndex(txsIndex, t.ID); err != nil {
+			return err
+		}
+	}
+	return writeTxIndexHeight(tx, block.Height-1)
+}
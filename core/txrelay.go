@@ -0,0 +1,248 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	maxInvPerMsg          = 1000                   // inv, getdata, notfound 메시지 하나에 담을 수 있는 최대 항목 수
+	maxKnownInventory     = 5000                   // 피어별로 기억하는 인벤토리 수 (넘으면 오래된 것부터 잊음)
+	inboundTxInvInterval  = 5 * time.Second        // inbound 피어에게 트랜잭션을 알리는 평균 간격
+	outboundTxInvInterval = 2 * time.Second        // outbound 피어에게 트랜잭션을 알리는 평균 간격
+	txRelayTickInterval   = 500 * time.Millisecond // 알릴 차례가 된 피어를 확인하는 주기
+	txRequestTimeout      = 30 * time.Second       // 이 시간 안에 오지 않은 트랜잭션은 알려준 다른 피어에게 요청
+)
+
+type NotFound struct {
+	AddrFrom string
+	Type     string   // "block" 또는 "tx"
+	Items    [][]byte // 가지고 있지 않은 해시 목록
+}
+
+// 피어가 가진 것으로 알려진 블록/트랜잭션 해시
+// 이미 아는 항목은 다시 알리지 않음. 가득 차면 가장 먼저 추가한 항목부터 잊음
+type inventorySet struct {
+	items map[string]struct{}
+	order []string
+	limit int
+}
+
+func newInventorySet(limit int) *inventorySet {
+	return &inventorySet{items: make(map[string]struct{}), limit: limit}
+}
+
+func (is *inventorySet) add(hash []byte) {
+	key := hex.EncodeToString(hash)
+	if _, ok := is.items[key]; ok {
+		return
+	}
+	if len(is.order) >= is.limit {
+		delete(is.items, is.order[0])
+		is.order = is.order[1:]
+	}
+	is.items[key] = struct{}{}
+	is.order = append(is.order, key)
+}
+
+func (is *inventorySet) has(hash []byte) bool {
+	_, ok := is.items[hex.EncodeToString(hash)]
+	return ok
+}
+
+// 다음 트랜잭션 inv를 보낼 때까지의 간격
+// 지수 분포로 무작위화하여 트랜잭션이 어느 노드에서 시작되었는지 추측하기 어렵게 함
+func txInvDelay(inbound bool) time.Duration {
+	interval := outboundTxInvInterval
+	if inbound {
+		interval = inboundTxInvInterval
+	}
+	return time.Duration(rand.ExpFloat64() * float64(interval))
+}
+
+// 요청 중인 트랜잭션 하나
+type txRequest struct {
+	txid       []byte
+	peer       *Peer     // 요청을 보낸 피어
+	requested  time.Time // 요청한 시각
+	announcers []*Peer   // 이 트랜잭션을 알려준 피어들 (요청이 실패하면 다음 피어에게 요청)
+}
+
+// 알림을 받은 트랜잭션의 요청 상태
+// 같은 트랜잭션을 여러 피어가 알려도 한 번에 한 피어에게만 요청함
+type txRequestTracker struct {
+	requests map[string]*txRequest // key: 트랜잭션 ID(hex)
+	lock     sync.Mutex
+}
+
+func newTxRequestTracker() *txRequestTracker {
+	return &txRequestTracker{requests: make(map[string]*txRequest)}
+}
+
+// p가 txid를 알려줌. p에게 지금 요청해야 하면 true
+func (t *txRequestTracker) announce(txid []byte, p *Peer, now time.Time) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := hex.EncodeToString(txid)
+	req, ok := t.requests[key]
+	if !ok {
+		t.requests[key] = &txRequest{txid: txid, peer: p, requested: now, announcers: []*Peer{p}}
+		return true
+	}
+
+	if !containsPeer(req.announcers, p) {
+		req.announcers = append(req.announcers, p)
+	}
+	return false
+}
+
+// 트랜잭션을 받았으면 요청 완료
+func (t *txRequestTracker) received(txid []byte) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.requests, hex.EncodeToString(txid))
+}
+
+// p가 txid를 가지고 있지 않다고 응답함. 다음으로 요청할 피어를 반환 (없으면 nil)
+func (t *txRequestTracker) notFound(txid []byte, p *Peer, now time.Time) *Peer {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := hex.EncodeToString(txid)
+	req, ok := t.requests[key]
+	if !ok || req.peer != p {
+		return nil
+	}
+	return t.reassign(key, req, now)
+}
+
+// p에게 보낸 요청들을 다른 피어에게 넘김 (연결이 끊긴 경우)
+// 반환값: 피어별로 새로 요청해야 하는 트랜잭션 ID
+func (t *txRequestTracker) releasePeer(p *Peer, now time.Time) map[*Peer][][]byte {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	requests := make(map[*Peer][][]byte)
+	for key, req := range t.requests {
+		if req.peer == p {
+			if next := t.reassign(key, req, now); next != nil {
+				requests[next] = append(requests[next], req.txid)
+			}
+			continue
+		}
+		req.announcers = withoutPeer(req.announcers, p)
+	}
+	return requests
+}
+
+// 오래 응답이 없는 요청을 다른 피어에게 넘김
+// 반환값: 피어별로 새로 요청해야 하는 트랜잭션 ID
+func (t *txRequestTracker) expire(now time.Time) map[*Peer][][]byte {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	requests := make(map[*Peer][][]byte)
+	for key, req := range t.requests {
+		if now.Sub(req.requested) <= txRequestTimeout {
+			continue
+		}
+		logMempool.Debug("Transaction request timed out", hexAttr("txid", req.txid), "peer", req.peer.String())
+		if next := t.reassign(key, req, now); next != nil {
+			requests[next] = append(requests[next], req.txid)
+		}
+	}
+	return requests
+}
+
+// 현재 요청한 피어를 빼고 알려준 다음 피어에게 요청을 넘김. 남은 피어가 없으면 요청을 포기
+func (t *txRequestTracker) reassign(key string, req *txRequest, now time.Time) *Peer {
+	req.announcers = withoutPeer(req.announcers, req.peer)
+	if len(req.announcers) == 0 {
+		delete(t.requests, key)
+		return nil
+	}
+	req.peer = req.announcers[0]
+	req.requested = now
+	return req.peer
+}
+
+func containsPeer(peers []*Peer, p *Peer) bool {
+	for _, peer := range peers {
+		if peer == p {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutPeer(peers []*Peer, p *Peer) []*Peer {
+	for i, peer := range peers {
+		if peer == p {
+			return append(peers[:i], peers[i+1:]...)
+		}
+	}
+	return peers
+}
+
+// 주기적으로 알릴 차례가 된 피어들에게 모아둔 트랜잭션을 inv로 알리고, 응답이 없는 요청을 다시 보냄
+func (s *Server) txRelayLoop() {
+	for s.sleep(txRelayTickInterval) {
+
+		now := time.Now()
+		for _, peer := range s.connectedPeers() {
+			txids := peer.takeTxInv(now)
+			for len(txids) > 0 {
+				n := min(len(txids), maxInvPerMsg)
+				s.sendInv(peer, "tx", txids[:n])
+				txids = txids[n:]
+			}
+		}
+
+		for peer, txids := range s.txRequests.expire(now) {
+			s.sendGetData(peer, "tx", txids...)
+		}
+	}
+}
+
+// 'notfound' 메시지 전송
+func (s *Server) sendNotFound(p *Peer, kind string, items [][]byte) {
+	s.sendMessage(p, "notfound", NotFound{AddrFrom: s.nodeAddress, Type: kind, Items: items})
+}
+
+// 'notfound' 메시지 처리
+// 요청한 블록이나 트랜잭션을 피어가 가지고 있지 않으면 다른 피어에게 요청
+func (s *Server) handleNotFound(p *Peer, payload []byte) {
+	var msg NotFound
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&msg); err != nil {
+		s.misbehaving(p, scoreMalformed, fmt.Sprintf("malformed notfound: %v", err))
+		return
+	}
+	if len(msg.Items) > maxInvPerMsg {
+		s.misbehaving(p, scoreOversized, fmt.Sprintf("notfound with %d items (maximum %d)", len(msg.Items), maxInvPerMsg))
+		return
+	}
+
+	logP2P.Debug("Peer does not have requested items", "peer", p.String(), "type", msg.Type, "count", len(msg.Items))
+
+	switch msg.Type {
+	case "block":
+		for _, hash := range msg.Items {
+			s.downloads.notFound(hash, p)
+			s.compactBlocks.take(hash, p)
+		}
+		s.scheduleDownloads()
+	case "tx":
+		now := time.Now()
+		for _, txid := range msg.Items {
+			if next := s.txRequests.notFound(txid, p, now); next != nil {
+				s.sendGetData(next, "tx", txid)
+			}
+		}
+	}
+}
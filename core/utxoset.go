@@ -2,11 +2,13 @@ package core
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/gob"
 	"encoding/hex"
-	"log"
-
-	"go.etcd.io/bbolt"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 )
 
 const utxoBucket = "utxoBucket"
@@ -15,212 +17,305 @@ type UTXOSet struct {
 	Blockchain *Blockchain
 }
 
+// UTXO Set에 저장되는 출력
+// 일부 출력이 사용되어도 Input이 참조하는 인덱스(Vout)가 바뀌지 않도록 원래 인덱스를 함께 저장
+type UTXOEntry struct {
+	Index  int // 트랜잭션 안에서의 출력 인덱스
+	Output *TXOutput
+}
+
+func encodeUTXOEntries(entries []UTXOEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entries); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeUTXOEntries(data []byte) ([]UTXOEntry, error) {
+	var entries []UTXOEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// prune된 체인의 UTXO Set을 다시 만들려고 함
+var ErrReindexPruned = errors.New("cannot reindex UTXO set of a pruned blockchain")
+
 // 모든 블록을 스캔하여 현재의 UTXO Set을 만듦
-func (u UTXOSet) Reindex() {
-	db := u.Blockchain.db
-	bucketName := []byte(utxoBucket)
-
-	err := db.Update(func(tx *bbolt.Tx) error {
-		// 기존 버킷 삭제
-		err := tx.DeleteBucket(bucketName)
-		if err != nil && err != bbolt.ErrBucketNotFound {
-			log.Panic(err)
-		}
+// prune된 노드는 블록 본문이 없으므로 Reindex 할 수 없음 (ErrReindexPruned)
+func (u UTXOSet) Reindex() error {
+	store := u.Blockchain.store
 
-		// 새 버킷 생성
-		_, err = tx.CreateBucket(bucketName)
-		if err != nil {
-			log.Panic(err)
-		}
-		return nil
-	})
+	prunedHeight, err := u.Blockchain.PrunedHeight()
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+	if prunedHeight > 0 {
+		return ErrReindexPruned
 	}
 
 	// 모든 블록을 스캔하여 모든 UTXO를 찾음
-	// map[string][]*TXOutput
-	// key: TXID, value: TXOutput Slice
-	allUTXOs := u.Blockchain.FindAllUTXO()
+	// map[string][]UTXOEntry
+	// key: TXID, value: UTXOEntry Slice
+	allUTXOs, err := u.Blockchain.FindAllUTXO()
+	if err != nil {
+		return err
+	}
 
-	// 새 버킷에 UTXO 저장
-	err = db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(bucketName)
+	// 기존 UTXO를 모두 지우고 새로 저장 (같은 트랜잭션 안에서 처리)
+	return store.Update(func(tx StorageTx) error {
+		return putAllUTXOs(tx, allUTXOs)
+	})
+}
 
-		for txID, outs := range allUTXOs {
-			// key 직렬화
-			key, err := hex.DecodeString(txID)
-			if err != nil {
-				log.Panic(err)
-			}
+// UTXO를 모두 지우고 allUTXOs로 교체
+func putAllUTXOs(tx StorageTx, allUTXOs map[string][]UTXOEntry) error {
+	if err := tx.ClearUTXO(); err != nil {
+		return err
+	}
 
-			// TXOutput 슬라이스 직렬화
-			var outsData bytes.Buffer
-			if err := gob.NewEncoder(&outsData).Encode(outs); err != nil {
-				log.Panic(err)
-			}
+	for txID, entries := range allUTXOs {
+		// key 직렬화
+		key, err := hex.DecodeString(txID)
+		if err != nil {
+			return err
+		}
 
-			err = b.Put(key, outsData.Bytes())
-			if err != nil {
-				log.Panic(err)
-			}
+		// UTXOEntry 슬라이스 직렬화
+		data, err := encodeUTXOEntries(entries)
+		if err != nil {
+			return err
 		}
 
-		return nil
-	})
-	if err != nil {
-		log.Panic(err)
+		if err := tx.PutUTXO(key, data); err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
 
 // UTXOSet에서 특정 PubKeyHash의 모든 UTXO 찾기
-func (u UTXOSet) FindUTXOs(pubKeyHash []byte) []*TXOutput {
+func (u UTXOSet) FindUTXOs(pubKeyHash []byte) ([]*TXOutput, error) {
 	var UTXOs []*TXOutput
-	db := u.Blockchain.db
+	store := u.Blockchain.store
 
-	err := db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
-		if b == nil {
-			log.Panic("UTXO Bucket not found. Please reindex.")
-		}
-
-		c := b.Cursor() // 버킷을 순회하는 커서
-
-		// utxoBucket을 처음부터 끝까지 스캔
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-
-			// v(value)를 역직렬화 (TXOutput 슬라이스))
-			var outs []*TXOutput
-			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&outs); err != nil {
-				log.Panic(err)
+	err := store.View(func(tx StorageTx) error {
+		// UTXO를 처음부터 끝까지 스캔
+		return tx.ForEachUTXO(func(k, v []byte) error {
+			// v(value)를 역직렬화 (UTXOEntry 슬라이스)
+			entries, err := decodeUTXOEntries(v)
+			if err != nil {
+				return err
 			}
 
 			// Output 슬라이스를 순회
-			for _, out := range outs {
+			for _, entry := range entries {
 				// 이 Output이 주어진 pubKeyHash로 잠겼는지 확인.
-				if out.IsLockedWithKey(pubKeyHash) {
-					UTXOs = append(UTXOs, out)
+				if entry.Output.IsLockedWithKey(pubKeyHash) {
+					UTXOs = append(UTXOs, entry.Output)
 				}
 			}
-		}
-		return nil
+			return nil
+		})
 	})
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	return UTXOs
+	return UTXOs, nil
 }
 
-func (u UTXOSet) GetBalance(pubKeyHash []byte) int {
+func (u UTXOSet) GetBalance(pubKeyHash []byte) (int, error) {
 	balance := 0
-	utxos := u.FindUTXOs(pubKeyHash)
+	utxos, err := u.FindUTXOs(pubKeyHash)
+	if err != nil {
+		return 0, err
+	}
 
 	for _, out := range utxos {
 		balance += out.Value
 	}
 
-	return balance
+	return balance, nil
 }
 
 // amount만큼 보낼 수 있는 UTXO 찾기
-func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
+func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int, error) {
 	spendableOutputs := make(map[string][]int) // (Key: TXID, Value: Output 인덱스 슬라이스)
 	accumulated := 0
-	db := u.Blockchain.db
-
-	err := db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
-		c := b.Cursor()
+	store := u.Blockchain.store
 
-		// UTXO 버킷 스캔
-		// key: TXID, value: []*TXOutput
-		for k, v := c.First(); k != nil; k, v = c.Next() {
+	err := store.View(func(tx StorageTx) error {
+		// UTXO 스캔
+		// key: TXID, value: []UTXOEntry
+		return tx.ForEachUTXO(func(k, v []byte) error {
 			txID := hex.EncodeToString(k)
 
-			var outs []*TXOutput
-			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&outs); err != nil {
-				log.Panic(err)
+			entries, err := decodeUTXOEntries(v)
+			if err != nil {
+				return err
 			}
 
-			for outIdx, out := range outs {
+			for _, entry := range entries {
 				// 내 PubKeyHash로 잠겨있고, 아직 다 안모였으면
-				if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-					accumulated += out.Value
-					spendableOutputs[txID] = append(spendableOutputs[txID], outIdx)
+				if entry.Output.IsLockedWithKey(pubKeyHash) && accumulated < amount {
+					accumulated += entry.Output.Value
+					spendableOutputs[txID] = append(spendableOutputs[txID], entry.Index)
 				}
 			}
-		}
-		return nil
+			return nil
+		})
 	})
 	if err != nil {
-		log.Panic(err)
+		return 0, nil, err
 	}
 
-	return accumulated, spendableOutputs
+	return accumulated, spendableOutputs, nil
+}
+
+// UTXO Set 전체의 해시 (노드들의 UTXO Set이 같은지 비교하는 용도)
+// 저장 순서나 인코딩과 관계없이 (txID, 인덱스, 금액, PubKeyHash)를 정렬해서 해시함
+func (u UTXOSet) Digest() (string, error) {
+	var outputs []string
+
+	err := u.Blockchain.store.View(func(tx StorageTx) error {
+		return tx.ForEachUTXO(func(k, v []byte) error {
+			entries, err := decodeUTXOEntries(v)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				outputs = append(outputs, fmt.Sprintf("%x:%d:%d:%x", k, entry.Index, entry.Output.Value, entry.Output.PubKeyHash))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(outputs)
+	hash := sha256.Sum256([]byte(strings.Join(outputs, "\n")))
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// UTXO Set에 남아있는 출력으로 트랜잭션을 구성
+// 서명 검증은 참조하는 출력(VOut[Vout])만 사용하므로, 블록 본문이 prune되어도 검증할 수 있음
+// 이미 사용된 출력 자리는 빈 TXOutput으로 채움. 해당 txID의 UTXO가 없으면 ErrTxNotFound
+func (u UTXOSet) FindTransaction(txID []byte) (*Transaction, error) {
+	var found *Transaction
+
+	err := u.Blockchain.store.View(func(tx StorageTx) error {
+		var err error
+		found, err = utxoTransaction(tx, txID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// 저장소 트랜잭션 안에서 UTXO Set에 남아있는 출력으로 트랜잭션을 구성 (UTXOSet.FindTransaction 참고)
+func utxoTransaction(tx StorageTx, txID []byte) (*Transaction, error) {
+	data := tx.GetUTXO(txID)
+	if data == nil {
+		return nil, fmt.Errorf("%w: no unspent outputs of %x", ErrTxNotFound, txID)
+	}
+	entries, err := decodeUTXOEntries(data)
+	if err != nil {
+		return nil, err
+	}
+
+	outs := make([]*TXOutput, entries[len(entries)-1].Index+1)
+	for i := range outs {
+		outs[i] = &TXOutput{}
+	}
+	for _, entry := range entries {
+		outs[entry.Index] = entry.Output
+	}
+
+	return &Transaction{ID: txID, VOut: outs}, nil
 }
 
 // 블록이 추가될 때 UTXO Set을 업데이트
-func (u UTXOSet) Update(block *Block) {
-	db := u.Blockchain.db
+func (u UTXOSet) Update(block *Block) error {
+	return u.Blockchain.store.Update(func(tx StorageTx) error {
+		return updateUTXOs(tx, block)
+	})
+}
 
-	err := db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
+// 저장소 트랜잭션 안에서 block의 트랜잭션들을 UTXO Set에 반영
+// AddBlock이 블록 저장과 같은 트랜잭션에서 호출하여 블록과 UTXO Set이 항상 일치하도록 함
+// 사용한 출력은 블록의 undo 데이터로 기록하여 reorg 때 블록을 끊으면서 되돌림
+func updateUTXOs(tx StorageTx, block *Block) error {
+	var spent []spentOutput
 
+	for _, transaction := range block.Transactions {
 		// 사용된 Output을 UTXO Set에서 제거
-		for _, transaction := range block.Transactions {
-			if !transaction.IsCoinbase() {
-
-				for _, vin := range transaction.Vin {
-					remainingOuts := []*TXOutput{}
-					rawOuts := b.Get(vin.Txid)
-					var outs []*TXOutput
+		if !transaction.IsCoinbase() {
+			for _, vin := range transaction.Vin {
+				// 서명 검증은 이미 사용된 출력도 통과하므로 (블록을 스캔해서 찾음) 여기서 이중 지불을 거부
+				data := tx.GetUTXO(vin.Txid)
+				if data == nil {
+					return fmt.Errorf("%w: transaction %x spends missing or spent output %x:%d", ErrInvalidBlock, transaction.ID, vin.Txid, vin.Vout)
+				}
+				entries, err := decodeUTXOEntries(data)
+				if err != nil {
+					return err
+				}
 
-					if err := gob.NewDecoder(bytes.NewReader(rawOuts)).Decode(&outs); err != nil {
-						log.Panic(err)
+				// 사용된 Output(vin의 vout index와 일치하는 index의 output)을 제외한 Output 목록을 만듦
+				remaining := []UTXOEntry{}
+				found := false
+				for _, entry := range entries {
+					if entry.Index != vin.Vout {
+						remaining = append(remaining, entry)
+					} else {
+						spent = append(spent, spentOutput{Txid: vin.Txid, Entry: entry})
+						found = true
 					}
+				}
+				if !found {
+					return fmt.Errorf("%w: transaction %x spends missing or spent output %x:%d", ErrInvalidBlock, transaction.ID, vin.Txid, vin.Vout)
+				}
 
-					// 사용된 Output(vin의 vout index와 일치하는 index의 output)을 제외한 Output 목록을 만듦
-					for outIdx, out := range outs {
-						if outIdx != vin.Vout {
-							remainingOuts = append(remainingOuts, out)
-						}
+				// 어떤 txID의 UTXO를 모두 소진한 경우
+				if len(remaining) == 0 {
+					// 해당 txID를 Key로 하는 데이터를 UTXO 버킷에서 제거
+					if err := tx.DeleteUTXO(vin.Txid); err != nil {
+						return err
 					}
-
-					// 어떤 txID의 UTXO를 모두 소진한 경우
-					if len(remainingOuts) == 0 {
-						// 해당 txID를 Key로 하는 데이터를 UTXO 버킷에서 제거
-						if err := b.Delete(vin.Txid); err != nil {
-							log.Panic(err)
-						}
-					} else { // 일부만 소진된 경우
-						var remainingOutsBin bytes.Buffer
-						if err := gob.NewEncoder(&remainingOutsBin).Encode(remainingOuts); err != nil {
-							log.Panic(err)
-						}
-						// 남은 Output으로 덮어쓰기
-						if err := b.Put(vin.Txid, remainingOutsBin.Bytes()); err != nil {
-							log.Panic(err)
-						}
+				} else { // 일부만 소진된 경우
+					data, err := encodeUTXOEntries(remaining)
+					if err != nil {
+						return err
+					}
+					// 남은 Output으로 덮어쓰기
+					if err := tx.PutUTXO(vin.Txid, data); err != nil {
+						return err
 					}
 				}
 			}
-			// 새로 생성된 Output을 UTXO Set에 추가
-			var newOuts []*TXOutput
-			var newOutsBin bytes.Buffer
-			newOuts = append(newOuts, transaction.VOut...)
+		}
 
-			if err := gob.NewEncoder(&newOutsBin).Encode(newOuts); err != nil {
-				log.Panic(err)
-			}
-			if err := b.Put(transaction.ID, newOutsBin.Bytes()); err != nil {
-				log.Panic(err)
-			}
+		// 새로 생성된 Output을 UTXO Set에 추가
+		var newEntries []UTXOEntry
+		for outIdx, out := range transaction.VOut {
+			newEntries = append(newEntries, UTXOEntry{Index: outIdx, Output: out})
 		}
 
-		return nil
-	})
-	if err != nil {
-		log.Panic(err)
+		data, err := encodeUTXOEntries(newEntries)
+		if err != nil {
+			return err
+		}
+		if err := tx.PutUTXO(transaction.ID, data); err != nil {
+			return err
+		}
 	}
+
+	return putUndo(tx, block.Hash, spent)
 }
@@ -3,6 +3,7 @@ package core
 import (
 	"bytes"
 	"crypto/sha256"
+	"fmt"
 	"log"
 
 	"github.com/btcsuite/btcd/btcec/v2"
@@ -63,10 +64,7 @@ func HashPubKey(pubKey []byte) []byte {
 	pubSHA256 := sha256.Sum256(pubKey)
 
 	RIPEMD160Hasher := ripemd160.New()
-	_, err := RIPEMD160Hasher.Write(pubSHA256[:])
-	if err != nil {
-		log.Panic(err)
-	}
+	RIPEMD160Hasher.Write(pubSHA256[:]) // hash.Hash의 Write는 에러를 반환하지 않음
 
 	return RIPEMD160Hasher.Sum(nil)
 }
@@ -81,7 +79,8 @@ func checksum(payload []byte) []byte {
 
 func ValidateAddress(address string) bool {
 	pubKeyHash, err := base58.Decode(address)
-	if err != nil {
+	// 버전(1바이트)과 체크섬이 들어갈 길이가 되지 않으면 잘못된 주소
+	if err != nil || len(pubKeyHash) <= 1+addressChecksumLen {
 		return false
 	}
 
@@ -91,3 +90,23 @@ func ValidateAddress(address string) bool {
 
 	return bytes.Equal(actualChecksum, targetChecksum)
 }
+
+// 주소에서 PubKeyHash를 추출 (버전 1바이트와 체크섬 4바이트를 제외한 부분)
+// 주소 형식이나 체크섬이 틀리면 ErrInvalidAddress
+func AddressToPubKeyHash(address string) ([]byte, error) {
+	if !ValidateAddress(address) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAddress, address)
+	}
+	return decodeAddress(address)
+}
+
+// 체크섬을 확인하지 않고 PubKeyHash를 추출
+// 출력 잠금(TXOutput.Lock)에 사용. 제네시스 블록의 보상 주소는 체크섬이 맞지 않으므로
+// 체크섬을 확인하면 제네시스 트랜잭션을 만들 수 없음
+func decodeAddress(address string) ([]byte, error) {
+	payload, err := base58.Decode(address)
+	if err != nil || len(payload) <= 1+addressChecksumLen {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAddress, address)
+	}
+	return payload[1 : len(payload)-addressChecksumLen], nil
+}
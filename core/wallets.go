@@ -4,14 +4,11 @@ import (
 	"bytes"
 	"encoding/gob"
 	"fmt"
-	"log"
 	"os"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 )
 
-const walletFileFormat = "wallet_%s.dat"
-
 type Wallets struct {
 	Wallets map[string]*Wallet // key: address
 }
@@ -22,27 +19,22 @@ type walletRecord struct {
 }
 
 // wallet.dat 파일에서 지갑들을 불러옴(Load)
-func NewWallets(port string) (*Wallets, error) {
-	walletFile := fmt.Sprintf(walletFileFormat, port)
+// 파일이 없으면 빈 Wallets. 읽거나 해석할 수 없으면 에러 (덮어쓰지 않도록)
+func NewWallets(walletFile string) (*Wallets, error) {
 	// wallet.dat 파일이 있는지 확인하고 없으면, 새로운 Wallets 구조체를 반환
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
-		wallets := &Wallets{}
-		wallets.Wallets = make(map[string]*Wallet)
-		return wallets, err
-	}
-
-	// 파일이 있으면 파일 읽기
 	fileContent, err := os.ReadFile(walletFile)
+	if os.IsNotExist(err) {
+		return &Wallets{Wallets: make(map[string]*Wallet)}, nil
+	}
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
 	// gob으로 역직렬화
 	var stored map[string]walletRecord
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
-	err = decoder.Decode(&stored)
-	if err != nil {
-		log.Panic(err)
+	if err := decoder.Decode(&stored); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", walletFile, err)
 	}
 
 	wallets := &Wallets{Wallets: make(map[string]*Wallet)}
@@ -67,7 +59,7 @@ func (ws *Wallets) CreateWallet() string {
 	address := string(wallet.GetAddress())
 	ws.Wallets[address] = wallet
 
-	fmt.Printf("New wallet created. Address: %s\n", address)
+	logWallet.Info("New wallet created", "address", address)
 	return address
 }
 
@@ -78,9 +70,7 @@ func (ws *Wallets) GetWallet(address string) (*Wallet, bool) {
 }
 
 // 지갑 맵을 파일에 GOB으로 저장(Save)
-func (ws *Wallets) SaveToFile(port string) {
-	walletFile := fmt.Sprintf(walletFileFormat, port)
-
+func (ws *Wallets) SaveToFile(walletFile string) error {
 	var content bytes.Buffer
 
 	if ws.Wallets == nil {
@@ -100,13 +90,9 @@ func (ws *Wallets) SaveToFile(port string) {
 	}
 
 	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(stored)
-	if err != nil {
-		log.Panic(err)
+	if err := encoder.Encode(stored); err != nil {
+		return err
 	}
 
-	err = os.WriteFile(walletFile, content.Bytes(), 0644)
-	if err != nil {
-		log.Panic(err)
-	}
+	return os.WriteFile(walletFile, content.Bytes(), 0600)
 }
@@ -3,10 +3,13 @@ module github.com/jinsy731/go-chain-study
 go 1.25.3
 
 require (
-	github.com/btcsuite/btcd/btcec/v2 v2.3.6 // indirect
+	github.com/btcsuite/btcd/btcec/v2 v2.3.6
+	github.com/mr-tron/base58 v1.2.0
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/crypto v0.43.0
+)
+
+require (
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
-	github.com/mr-tron/base58 v1.2.0 // indirect
-	go.etcd.io/bbolt v1.4.3 // indirect
-	golang.org/x/crypto v0.43.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 )